@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt only looks at the first 72 bytes, so anything longer is rejected instead of silently cut off
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// HashPassword returns the bcrypt hash that gets stored in users.password_hash
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword compares a plain password against a stored hash
+func CheckPassword(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+// dummyHash is compared against when the username does not exist, so a failed login
+// takes about the same time whether or not the account is real
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("campuscommons-dummy-password"), bcrypt.DefaultCost)
+
+// WastePasswordCheck burns the same amount of time as CheckPassword
+func WastePasswordCheck(password string) {
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
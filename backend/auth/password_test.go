@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPasswords(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == "correct horse" {
+		t.Fatal("the password was stored as is")
+	}
+	if err := CheckPassword(hash, "correct horse"); err != nil {
+		t.Errorf("right password: %v", err)
+	}
+	if err := CheckPassword(hash, "battery staple"); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("wrong password: got %v, want ErrPasswordMismatch", err)
+	}
+	if err := CheckPassword("", "correct horse"); err == nil || errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("broken hash: got %v, want an error other than a mismatch", err)
+	}
+}
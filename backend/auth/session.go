@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// CookieName is the cookie the session token is stored in for browser clients.
+// API clients can send the same token as "Authorization: Bearer <token>" instead.
+const CookieName = "campuscommons_session"
+
+// SessionTTL is how long a token stays valid after login
+const SessionTTL = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidToken = errors.New("invalid session token")
+	ErrExpiredToken = errors.New("session token has expired")
+)
+
+// Claims is what gets signed into a session token
+type Claims struct {
+	UserID    int   `json:"uid"`
+	IssuedAt  int64 `json:"iat"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+var secret []byte
+
+// InitSessions sets the HMAC key used to sign session tokens (session_secret in the config).
+// If it is empty a random key is generated, which means everyone gets logged out when the
+// server restarts. The config package has already checked it is long enough.
+func InitSessions(s string) {
+	if s != "" {
+		secret = []byte(s)
+		return
+	}
+
+	secret = make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatal("Failed to generate session secret:", err)
+	}
+	log.Println("No session secret configured, using a random one (sessions will not survive a restart)")
+}
+
+// SignSession issues a token for the given user, valid for SessionTTL
+func SignSession(userID int) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(SessionTTL)
+	payload, err := json.Marshal(Claims{UserID: userID, IssuedAt: now.Unix(), ExpiresAt: expires.Unix()})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + sign(encoded), expires, nil
+}
+
+// VerifySession checks the signature and expiry of a token and returns its claims
+func VerifySession(token string) (Claims, error) {
+	var claims Claims
+
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || encoded == "" || sig == "" {
+		return claims, ErrInvalidToken
+	}
+	// compare in constant time so the signature can't be guessed byte by byte
+	if !hmac.Equal([]byte(sig), []byte(sign(encoded))) {
+		return claims, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.UserID <= 0 {
+		return claims, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+func sign(encoded string) string {
+	if secret == nil {
+		panic("auth: InitSessions must be called before signing or verifying sessions")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// token signs claims as they are, so tests can make tokens SignSession never would
+func token(t *testing.T, claims Claims) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + sign(encoded)
+}
+
+func TestSessions(t *testing.T) {
+	InitSessions(strings.Repeat("a", 32))
+	valid, expires, err := SignSession(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expires); d < SessionTTL-time.Minute || d > SessionTTL {
+		t.Errorf("expires in %v, want %v", d, SessionTTL)
+	}
+	payload, sig, _ := strings.Cut(valid, ".")
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name    string
+		token   string
+		secret  string // verify with another secret than the token was signed with
+		wantErr error
+	}{
+		{"round trip", valid, "", nil},
+		{"wrong secret", valid, strings.Repeat("b", 32), ErrInvalidToken},
+		{"tampered payload", base64.RawURLEncoding.EncodeToString([]byte(`{"uid":1,"exp":99999999999}`)) + "." + sig, "", ErrInvalidToken},
+		{"tampered signature", payload + "." + strings.Repeat("A", len(sig)), "", ErrInvalidToken},
+		{"signature of another token", payload + "." + sign("other"), "", ErrInvalidToken},
+		{"no signature", payload, "", ErrInvalidToken},
+		{"empty", "", "", ErrInvalidToken},
+		{"expired", token(t, Claims{UserID: 42, IssuedAt: now - 100, ExpiresAt: now - 1}), "", ErrExpiredToken},
+		{"no user", token(t, Claims{IssuedAt: now, ExpiresAt: now + 100}), "", ErrInvalidToken},
+		{"not JSON", "bm90IGpzb24." + sign("bm90IGpzb24"), "", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.secret != "" {
+				InitSessions(tt.secret)
+				defer InitSessions(strings.Repeat("a", 32))
+			}
+			claims, err := VerifySession(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (claims.UserID != 42 || claims.ExpiresAt != expires.Unix()) {
+				t.Errorf("got claims %+v", claims)
+			}
+		})
+	}
+}
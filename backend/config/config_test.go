@@ -0,0 +1,197 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "campuscommons.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDefaults(t *testing.T) {
+	cfg, rest, err := Load("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != ":8080" || cfg.Database.Driver != "sqlite" || !cfg.Features.Registration {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+	// left unset search follows what the database can do
+	if cfg.Features.Search != nil {
+		t.Errorf("search defaults to %v, want unset", *cfg.Features.Search)
+	}
+	if !slices.Equal(cfg.CORS.AllowedOrigins, []string{"http://localhost:3000"}) {
+		t.Errorf("default origins are %v", cfg.CORS.AllowedOrigins)
+	}
+	if len(rest) != 0 {
+		t.Errorf("left over args %v", rest)
+	}
+}
+
+// the file beats the defaults, the environment beats the file and flags beat everything
+func TestPrecedence(t *testing.T) {
+	path := writeFile(t, `
+listen: ":9000"
+database:
+  driver: postgres
+  dsn: postgres://file/campuscommons
+cors:
+  allowed_origins: [https://file.example.com]
+log:
+  level: warn
+server:
+  write_timeout: 1m
+  shutdown_timeout: 5s
+features:
+  search: false
+`)
+	t.Setenv("CAMPUSCOMMONS_CONFIG", path)
+	t.Setenv("CAMPUSCOMMONS_DB_DSN", "postgres://env/campuscommons")
+	t.Setenv("CAMPUSCOMMONS_CORS_ORIGINS", "https://env.example.com, https://other.example.com")
+	t.Setenv("CAMPUSCOMMONS_REGISTRATION", "false")
+	t.Setenv("CAMPUSCOMMONS_SHUTDOWN_TIMEOUT", "20s")
+
+	cfg, rest, err := Load("test", []string{"-listen", "127.0.0.1:9100", "-search", "status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Listen != "127.0.0.1:9100" {
+		t.Errorf("listen is %q, want the flag", cfg.Listen)
+	}
+	if cfg.Database.Driver != "postgres" || cfg.Log.Level != "warn" {
+		t.Errorf("driver %q and log level %q should come from the file", cfg.Database.Driver, cfg.Log.Level)
+	}
+	if cfg.Database.DSN != "postgres://env/campuscommons" {
+		t.Errorf("dsn is %q, want the environment", cfg.Database.DSN)
+	}
+	if !slices.Equal(cfg.CORS.AllowedOrigins, []string{"https://env.example.com", "https://other.example.com"}) {
+		t.Errorf("origins are %v, want the environment", cfg.CORS.AllowedOrigins)
+	}
+	if cfg.Features.Registration || cfg.Features.Search == nil || !*cfg.Features.Search {
+		t.Errorf("features are %+v, want registration off from the environment and search on from the flag", cfg.Features)
+	}
+	if cfg.Server.WriteTimeout != time.Minute || cfg.Server.ShutdownTimeout != 20*time.Second {
+		t.Errorf("write timeout %v should come from the file and shutdown timeout %v from the environment", cfg.Server.WriteTimeout, cfg.Server.ShutdownTimeout)
+	}
+	if cfg.Server.ReadTimeout != Default().Server.ReadTimeout {
+		t.Errorf("read timeout %v should keep its default", cfg.Server.ReadTimeout)
+	}
+	if !slices.Equal(rest, []string{"status"}) {
+		t.Errorf("left over args are %v", rest)
+	}
+}
+
+func TestMemoryFlag(t *testing.T) {
+	cfg, _, err := Load("test", []string{"-memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.Driver != "memory" {
+		t.Errorf("driver is %q", cfg.Database.Driver)
+	}
+}
+
+// search can be turned off or insisted on from anywhere, and stays unset otherwise
+func TestSearchSetting(t *testing.T) {
+	for _, tt := range []struct {
+		name, file, env string
+		args            []string
+		want            string
+	}{
+		{"nothing", "", "", nil, "unset"},
+		{"file", "features:\n  search: true\n", "", nil, "true"},
+		{"environment", "", "false", nil, "false"},
+		{"flag", "", "", []string{"-search"}, "true"},
+		{"flag off", "features:\n  search: true\n", "", []string{"-search=false"}, "false"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, tt.file)}, args...)
+			}
+			if tt.env != "" {
+				t.Setenv("CAMPUSCOMMONS_SEARCH", tt.env)
+			}
+			cfg, _, err := Load("test", args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := "unset"
+			if cfg.Features.Search != nil {
+				got = strconv.FormatBool(*cfg.Features.Search)
+			}
+			if got != tt.want {
+				t.Errorf("search is %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownKey(t *testing.T) {
+	path := writeFile(t, "lisen: \":9000\"\n")
+	if _, _, err := Load("test", []string{"-config", path}); err == nil || !strings.Contains(err.Error(), "lisen") {
+		t.Errorf("got %v, want an error about the unknown key", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Listen = "8080"
+	cfg.Database = Database{Driver: "postgres"}
+	cfg.CORS.AllowedOrigins = []string{"*", "localhost:3000"}
+	cfg.TLS.CertFile = "cert.pem"
+	cfg.Log.Level = "loud"
+	cfg.Log.Format = "xml"
+	cfg.SessionSecret = "short"
+	cfg.Server.IdleTimeout = 0
+	cfg.Server.MaxHeaderBytes = 10
+	cfg.Server.MaxBodyBytes = 0
+	cfg.Health.Timeout = -time.Second
+	cfg.RateLimit.Writes.Burst = 0
+	cfg.RateLimit.TrustedProxies = []string{"10.0.0.0/8", "proxy.local"}
+	cfg.WebSocket.MaxSubscriptions = 0
+	cfg.Feeds = Feeds{Items: 500, SiteURL: "campus.example", APIURL: "ftp://api.campus.example"}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted a broken config")
+	}
+	for _, want := range []string{"listen", "database.dsn", "cors.allowed_origins: *", `"localhost:3000"`, "tls: cert_file and key_file",
+		"log.level", "log.format", "session_secret", "server.idle_timeout", "server.max_header_bytes", "server.max_body_bytes", "health.timeout",
+		"rate_limit.writes", `"proxy.local"`, "websocket", "feeds.items", "feeds.site_url", "feeds.api_url"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error doesn't mention %s:\n%v", want, err)
+		}
+	}
+
+	if err := Default().Validate(); err != nil {
+		t.Errorf("the defaults don't validate: %v", err)
+	}
+}
+
+func TestAPIURL(t *testing.T) {
+	cfg := Default()
+	if got := cfg.APIURL(); got != "http://localhost:8080" {
+		t.Errorf("default is %q", got)
+	}
+	cfg.Listen = "127.0.0.1:9443"
+	cfg.TLS = TLS{CertFile: "cert.pem", KeyFile: "key.pem"}
+	if got := cfg.APIURL(); got != "https://localhost:9443" {
+		t.Errorf("with TLS got %q", got)
+	}
+	cfg.Feeds.APIURL = "https://api.campus.example"
+	if got := cfg.APIURL(); got != "https://api.campus.example" {
+		t.Errorf("configured got %q", got)
+	}
+}
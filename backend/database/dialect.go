@@ -0,0 +1,35 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect is the SQL flavour of the database that is open, the queries are written for SQLite
+// and Rebind adapts them for the others
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// Rebind rewrites the ? placeholders of a query into $1, $2, ... for Postgres.
+// None of our queries have a ? inside a string literal, so a plain scan is enough.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
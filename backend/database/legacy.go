@@ -0,0 +1,491 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// Before migrations the schema came from createTables, which only ever ran CREATE TABLE IF NOT EXISTS.
+// A database keeps the tables of whichever version first created them, so one from before
+// migrations can be anything from the very first schema up to 0001. Postgres support came after
+// migrations, so only SQLite databases can be like that.
+
+// legacyColumns are the columns the schema changes before migrations added to existing tables.
+// CREATE TABLE IF NOT EXISTS never added them to databases that already had the table, so
+// upgradeLegacySchema does. SQLite can't add a NOT NULL column without a default, so the
+// password hash of accounts from before logins is empty until the operator sets one.
+var legacyColumns = []struct {
+	table, column, definition string
+}{
+	{"users", "password_hash", "TEXT NOT NULL DEFAULT ''"},
+	{"users", "role", "TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('member', 'moderator', 'admin'))"},
+	{"comments", "parent_id", "INTEGER REFERENCES comments(id) ON DELETE CASCADE"},
+	{"comments", "edited_at", "DATETIME"},
+	{"posts", "upvotes", "INTEGER NOT NULL DEFAULT 0"},
+	{"posts", "downvotes", "INTEGER NOT NULL DEFAULT 0"},
+	{"posts", "score", "INTEGER NOT NULL DEFAULT 0"},
+	{"posts", "hot_rank", "REAL NOT NULL DEFAULT 0"},
+	{"posts", "controversy", "REAL NOT NULL DEFAULT 0"},
+	{"comments", "upvotes", "INTEGER NOT NULL DEFAULT 0"},
+	{"comments", "downvotes", "INTEGER NOT NULL DEFAULT 0"},
+	{"comments", "score", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// adoptLegacySchema upgrades a database from before migrations to what the first migration
+// creates and records it as applied, or refuses with everything that still doesn't match
+func adoptLegacySchema(first migration) error {
+	if Driver != SQLite {
+		return nil
+	}
+
+	var hasMigrations, hasTables bool
+	err := DB.QueryRow(`SELECT
+			EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'),
+			EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'users')`).Scan(&hasMigrations, &hasTables)
+	if err != nil || hasMigrations || !hasTables {
+		return err
+	}
+
+	reference, err := referenceSchema(first)
+	if err != nil {
+		return err
+	}
+	defer reference.Close()
+	if err := upgradeLegacySchema(reference); err != nil {
+		return fmt.Errorf("upgrading the database from before migrations: %w", err)
+	}
+	if err := rebuildLegacyTables(reference); err != nil {
+		return fmt.Errorf("rebuilding the tables from before migrations: %w", err)
+	}
+	if err := compareSchema(reference); err != nil {
+		return fmt.Errorf("the database was created before migrations and doesn't match %04d_%s, so it can't be upgraded:\n%w",
+			first.version, first.name, err)
+	}
+
+	log.Printf("Found tables from before migrations, marking %04d_%s as applied", first.version, first.name)
+	return inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(migrationsTable[Driver]); err != nil {
+			return err
+		}
+		_, err := tx.Exec("INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)", first.version, first.name, first.checksum)
+		return err
+	})
+}
+
+// referenceSchema is an in-memory database with just the first migration applied, what a
+// legacy database is held up against
+func referenceSchema(first migration) (*sql.DB, error) {
+	reference, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// every connection to :memory: is a database of its own
+	reference.SetMaxOpenConns(1)
+	if _, err := reference.Exec(first.up); err != nil {
+		reference.Close()
+		return nil, fmt.Errorf("building the schema of %04d_%s: %w", first.version, first.name, err)
+	}
+	return reference, nil
+}
+
+// upgradeLegacySchema adds the columns, tables, indexes and triggers a database from before
+// migrations is missing, and fills in what the new columns can't default to
+func upgradeLegacySchema(reference *sql.DB) error {
+	want, err := schemaObjects(reference)
+	if err != nil {
+		return err
+	}
+	got, err := schemaObjects(DB)
+	if err != nil {
+		return err
+	}
+	have := map[string]bool{}
+	for _, o := range got {
+		have[o.typ+" "+o.name] = true
+	}
+	columns := map[string]map[string]column{}
+	for _, o := range got {
+		if o.typ == "table" {
+			if columns[o.name], err = tableColumns(DB, o.name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return inTx(func(tx *sql.Tx) error {
+		added := map[string]bool{}
+		for _, c := range legacyColumns {
+			if _, ok := columns[c.table][c.column]; ok || columns[c.table] == nil {
+				continue
+			}
+			log.Printf("Adding column %s.%s", c.table, c.column)
+			if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+				return err
+			}
+			added[c.table+"."+c.column] = true
+		}
+
+		// in the order the first migration creates them, tables come before their indexes and triggers
+		for _, o := range want {
+			if have[o.typ+" "+o.name] {
+				continue
+			}
+			log.Printf("Creating %s %s", o.typ, o.name)
+			if _, err := tx.Exec(o.sql); err != nil {
+				return err
+			}
+		}
+
+		if added["users.role"] {
+			// everyone starts as a member, which account gets to be admin is the operator's call
+			log.Printf("Accounts from before roles are all members now, make one the admin with `go run . user set-role <username> admin`")
+		}
+		if added["posts.hot_rank"] {
+			return backfillRanking(tx)
+		}
+		return nil
+	})
+}
+
+// backfillRanking works out hot_rank and controversy for the posts there were before ranking.
+// The formulas are in Go, so they can't be a single UPDATE.
+func backfillRanking(tx *sql.Tx) error {
+	type ranking struct {
+		id          int
+		hot, contro float64
+	}
+	rows, err := tx.Query("SELECT id, upvotes, downvotes, created_at FROM posts")
+	if err != nil {
+		return err
+	}
+	var rankings []ranking
+	for rows.Next() {
+		var id, ups, downs int
+		var createdAt time.Time
+		if err := rows.Scan(&id, &ups, &downs, &createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		rankings = append(rankings, ranking{id, store.HotRank(ups, downs, createdAt), store.Controversy(ups, downs)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range rankings {
+		if _, err := tx.Exec("UPDATE posts SET hot_rank = ?, controversy = ? WHERE id = ?", r.hot, r.contro, r.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildLegacyTables recreates the tables whose foreign keys differ from the first migration's,
+// which is how the ON DELETE CASCADE gets onto tables made before it. SQLite can't change the
+// constraints of a table, so each one is created again and its rows copied over.
+func rebuildLegacyTables(reference *sql.DB) error {
+	want, err := schemaObjects(reference)
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for _, o := range want {
+		if o.typ != "table" {
+			continue
+		}
+		same, err := sameForeignKeys(reference, o.name)
+		if err != nil {
+			return err
+		}
+		if !same {
+			tables = append(tables, o.name)
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	// foreign_keys can't change inside a transaction, so it takes a connection of its own.
+	// With it off the rows can be copied in any order, and with legacy_alter_table on renaming a
+	// table leaves the foreign keys of the other tables pointing at the name, not the old table.
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF; PRAGMA legacy_alter_table = ON"); err != nil {
+		return err
+	}
+	// the connection goes back to the pool, it has to be as Open left it
+	defer conn.ExecContext(ctx, "PRAGMA legacy_alter_table = OFF; PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		log.Printf("Rebuilding table %s for its foreign keys", table)
+		if err := rebuildTable(tx, want, table); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+
+	rows, err := tx.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	var problems []error
+	for rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fk int
+		if err := rows.Scan(&table, &rowid, &parent, &fk); err != nil {
+			rows.Close()
+			return err
+		}
+		problems = append(problems, fmt.Errorf("row %d of %s points at a missing row of %s", rowid.Int64, table, parent))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return errors.Join(problems...)
+	}
+	return tx.Commit()
+}
+
+// rebuildTable swaps table for the first migration's version of it with the same rows in it
+func rebuildTable(tx *sql.Tx, want []schemaObject, table string) error {
+	legacy := "legacy_" + table
+
+	// the indexes and triggers go with the old table, the first migration's come back afterwards
+	rows, err := tx.Query("SELECT type, name FROM sqlite_master WHERE type IN ('index', 'trigger') AND tbl_name = ? AND sql IS NOT NULL", table)
+	if err != nil {
+		return err
+	}
+	var drops []string
+	for rows.Next() {
+		var typ, name string
+		if err := rows.Scan(&typ, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		drops = append(drops, fmt.Sprintf("DROP %s %q", typ, name))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, drop := range drops {
+		if _, err := tx.Exec(drop); err != nil {
+			return err
+		}
+	}
+
+	columns := []string{}
+	var create string
+	for _, o := range want {
+		if o.typ == "table" && o.name == table {
+			create = o.sql
+		}
+	}
+	rows, err = tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		columns = append(columns, fmt.Sprintf("%q", name))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	steps := []string{
+		fmt.Sprintf("ALTER TABLE %q RENAME TO %q", table, legacy),
+		create,
+		fmt.Sprintf("INSERT INTO %q (%s) SELECT %[2]s FROM %[3]q", table, strings.Join(columns, ", "), legacy),
+		// the AUTOINCREMENT counter comes along, so IDs of deleted rows don't get handed out again
+		fmt.Sprintf("DELETE FROM sqlite_sequence WHERE name = '%s'", table),
+		fmt.Sprintf("UPDATE sqlite_sequence SET name = '%s' WHERE name = '%s'", table, legacy),
+		fmt.Sprintf("DROP TABLE %q", legacy),
+	}
+	for _, o := range want {
+		if o.typ != "table" && o.table == table {
+			steps = append(steps, o.sql)
+		}
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// foreignKey is one line of PRAGMA foreign_key_list
+type foreignKey struct {
+	from, table, to, onDelete string
+}
+
+func foreignKeys(db *sql.DB, table string) ([]foreignKey, error) {
+	rows, err := db.Query(`SELECT "from", "table", coalesce("to", ''), on_delete FROM pragma_foreign_key_list(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []foreignKey
+	for rows.Next() {
+		var k foreignKey
+		if err := rows.Scan(&k.from, &k.table, &k.to, &k.onDelete); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// sameForeignKeys compares the foreign keys of a table in the reference and in DB, a table that
+// isn't in DB has nothing to compare
+func sameForeignKeys(reference *sql.DB, table string) (bool, error) {
+	want, err := foreignKeys(reference, table)
+	if err != nil {
+		return false, err
+	}
+	got, err := foreignKeys(DB, table)
+	if err != nil {
+		return false, err
+	}
+	if len(got) == 0 {
+		var exists bool
+		if err := DB.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)", table).Scan(&exists); err != nil || !exists {
+			return true, err
+		}
+	}
+	byColumn := func(a, b foreignKey) int { return strings.Compare(a.from, b.from) }
+	slices.SortFunc(want, byColumn)
+	slices.SortFunc(got, byColumn)
+	return slices.Equal(want, got), nil
+}
+
+// schemaObject is a table, index or trigger as sqlite_master lists it, table is the one an
+// index or trigger belongs to
+type schemaObject struct {
+	typ, name, table, sql string
+}
+
+// schemaObjects lists the tables, indexes and triggers in the order they were created,
+// leaving out the ones SQLite makes for itself
+func schemaObjects(db *sql.DB) ([]schemaObject, error) {
+	rows, err := db.Query(`SELECT type, name, tbl_name, sql FROM sqlite_master
+		WHERE type IN ('table', 'index', 'trigger') AND name NOT LIKE 'sqlite_%' AND sql IS NOT NULL
+		ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objects []schemaObject
+	for rows.Next() {
+		var o schemaObject
+		if err := rows.Scan(&o.typ, &o.name, &o.table, &o.sql); err != nil {
+			return nil, err
+		}
+		objects = append(objects, o)
+	}
+	return objects, rows.Err()
+}
+
+// column is one line of PRAGMA table_info
+type column struct {
+	notNull bool
+}
+
+func tableColumns(db *sql.DB, table string) (map[string]column, error) {
+	rows, err := db.Query(`SELECT name, "notnull" FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := map[string]column{}
+	for rows.Next() {
+		var name string
+		var c column
+		if err := rows.Scan(&name, &c.notNull); err != nil {
+			return nil, err
+		}
+		columns[name] = c
+	}
+	return columns, rows.Err()
+}
+
+// compareSchema lists everything the reference has that DB is missing or has differently
+func compareSchema(reference *sql.DB) error {
+	want, err := schemaObjects(reference)
+	if err != nil {
+		return err
+	}
+	got, err := schemaObjects(DB)
+	if err != nil {
+		return err
+	}
+	have := map[string]bool{}
+	for _, o := range got {
+		have[o.typ+" "+o.name] = true
+	}
+
+	var problems []error
+	for _, o := range want {
+		if !have[o.typ+" "+o.name] {
+			problems = append(problems, fmt.Errorf("%s %s is missing", o.typ, o.name))
+			continue
+		}
+		if o.typ != "table" {
+			continue
+		}
+
+		wantColumns, err := tableColumns(reference, o.name)
+		if err != nil {
+			return err
+		}
+		gotColumns, err := tableColumns(DB, o.name)
+		if err != nil {
+			return err
+		}
+		if same, err := sameForeignKeys(reference, o.name); err != nil {
+			return err
+		} else if !same {
+			problems = append(problems, fmt.Errorf("the foreign keys of %s are different", o.name))
+		}
+		for name, c := range wantColumns {
+			got, ok := gotColumns[name]
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Errorf("column %s.%s is missing", o.name, name))
+			case got.notNull != c.notNull:
+				problems = append(problems, fmt.Errorf("column %s.%s allows NULL where it shouldn't, or the other way round", o.name, name))
+			}
+		}
+	}
+	return errors.Join(problems...)
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// baselineSchema is what createTables made before any of the schema changes, the oldest
+// database there can be
+const baselineSchema = `
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE topics (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	description TEXT,
+	created_by INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(created_by) REFERENCES users(id)
+);
+
+CREATE TABLE posts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	topic_id INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	body TEXT NOT NULL,
+	created_by INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(topic_id) REFERENCES topics(id),
+	FOREIGN KEY(created_by) REFERENCES users(id)
+);
+
+CREATE TABLE comments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	post_id INTEGER NOT NULL,
+	body TEXT NOT NULL,
+	created_by INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(post_id) REFERENCES posts(id),
+	FOREIGN KEY(created_by) REFERENCES users(id)
+);`
+
+// openLegacy opens a new database with schema in it and no schema_migrations
+func openLegacy(t *testing.T, schema string) {
+	t.Helper()
+	Open(Config{Driver: SQLite, DSN: filepath.Join(t.TempDir(), "legacy.db")})
+	t.Cleanup(func() { DB.Close() })
+	if _, err := DB.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacySchema(t *testing.T) {
+	Driver = SQLite
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("current", func(t *testing.T) {
+		openLegacy(t, migrations[0].up)
+		if err := Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := CheckMigrations(context.Background()); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("baseline", func(t *testing.T) {
+		openLegacy(t, baselineSchema+`
+			INSERT INTO users (username) VALUES ('alice'), ('bob');
+			INSERT INTO topics (title, description, created_by) VALUES ('Golang', 'about Golang', 1);
+			INSERT INTO posts (topic_id, title, body, created_by, created_at) VALUES (1, 'Generics', 'hi', 2, '2026-03-02 09:30:00');
+			INSERT INTO comments (post_id, body, created_by) VALUES (1, 'hello', 1);`)
+		if err := Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := CheckMigrations(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		var role, hash string
+		if err := DB.QueryRow("SELECT role, password_hash FROM users WHERE username = 'alice'").Scan(&role, &hash); err != nil {
+			t.Fatal(err)
+		}
+		// nobody is made admin behind the operator's back, not even the oldest account
+		if role != store.RoleMember || hash != "" {
+			t.Errorf("the oldest user got role %q and hash %q, want member and none", role, hash)
+		}
+		var hot float64
+		if err := DB.QueryRow("SELECT hot_rank FROM posts WHERE id = 1").Scan(&hot); err != nil {
+			t.Fatal(err)
+		}
+		created := time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+		if want := store.HotRank(0, 0, created); hot != want {
+			t.Errorf("hot_rank is %v, want %v", hot, want)
+		}
+		// the tables added on the way work
+		if _, err := DB.Exec("INSERT INTO votes (user_id, target_type, target_id, value) VALUES (1, 'post', 1, 1)"); err != nil {
+			t.Error(err)
+		}
+		if _, err := DB.Exec("INSERT INTO comment_revisions (comment_id, body, edited_by) VALUES (1, 'hi', 1)"); err != nil {
+			t.Error(err)
+		}
+
+		// the rebuilt tables cascade, where the old ones refused to delete a topic with posts
+		if _, err := DB.Exec("DELETE FROM topics WHERE id = 1"); err != nil {
+			t.Fatal(err)
+		}
+		var left int
+		err := DB.QueryRow(`SELECT (SELECT count(*) FROM posts) + (SELECT count(*) FROM comments)
+			+ (SELECT count(*) FROM votes) + (SELECT count(*) FROM comment_revisions)`).Scan(&left)
+		if err != nil || left != 0 {
+			t.Errorf("%d rows left after deleting the topic, %v", left, err)
+		}
+		// IDs carry on from where the old tables were
+		var id int
+		if err := DB.QueryRow("INSERT INTO topics (title, created_by) VALUES ('Rust', 1) RETURNING id").Scan(&id); err != nil || id != 2 {
+			t.Errorf("the next topic got ID %d, %v", id, err)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		// no version of createTables required a description, so there is no upgrade for it
+		openLegacy(t, strings.Replace(baselineSchema, "description TEXT,", "description TEXT NOT NULL,", 1))
+		err := Migrate()
+		if err == nil || !strings.Contains(err.Error(), "column topics.description allows NULL") {
+			t.Errorf("got %v, want the required description reported", err)
+		}
+	})
+}
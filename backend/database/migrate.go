@@ -0,0 +1,355 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Migrations live in migrations/<dialect>/ as NNNN_name.up.sql and NNNN_name.down.sql and are
+// built into the binary. Every migration is written once per dialect, with the same number and name. Never edit one that has been released, add a new one instead: the checksum of every
+// applied migration is kept in schema_migrations and a changed file stops the server from starting.
+// An up file whose first line is "-- requires: <name>" only runs when the database has that feature
+// (see requirements), otherwise it is skipped and applied by the first build that has it.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type migration struct {
+	version  int
+	name     string
+	up       string
+	down     string
+	checksum string // sha256 of the up file, that is what ran against the database
+	requires string // from the "-- requires:" line, empty for most
+}
+
+// what a migration can require, and the query that says whether this database has it
+var requirements = map[string]string{
+	// go-sqlite3 only builds FTS5 in with -tags sqlite_fts5
+	"fts5": "SELECT sqlite_compileoption_used('ENABLE_FTS5')",
+}
+
+// requirementMet says whether the database has a migration's requirement, no requirement is always met
+func requirementMet(ctx context.Context, name string) (bool, error) {
+	if name == "" {
+		return true, nil
+	}
+	var met bool
+	err := DB.QueryRowContext(ctx, requirements[name]).Scan(&met)
+	return met, err
+}
+
+// MigrationState is one migration as MigrationStatus reports it
+type MigrationState struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"` // nil while pending
+	Modified  bool       `json:"modified"`   // applied, but the file has changed since
+	Requires  string     `json:"requires,omitempty"`
+	Skipped   bool       `json:"skipped"` // pending, but the database doesn't have what it requires
+}
+
+var migrationsTable = map[Dialect]string{
+	SQLite: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+	Postgres: `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP
+		);`,
+}
+
+// loadMigrations reads the embedded files for the open database, sorted by version
+func loadMigrations() ([]migration, error) {
+	dir := "migrations/" + string(Driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		parts := migrationName.FindStringSubmatch(entry.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("migration %s isn't named NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		var version int
+		fmt.Sscan(parts[1], &version)
+
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{version: version, name: parts[2]}
+			byVersion[version] = m
+		} else if m.name != parts[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, m.name, parts[2])
+		}
+
+		content, err := migrationFiles.ReadFile(dir + "/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		if parts[3] == "up" {
+			m.up = string(content)
+			sum := sha256.Sum256(content)
+			m.checksum = hex.EncodeToString(sum[:])
+			firstLine, _, _ := strings.Cut(m.up, "\n")
+			if name, ok := strings.CutPrefix(strings.TrimSpace(firstLine), "-- requires:"); ok {
+				m.requires = strings.TrimSpace(name)
+				if _, known := requirements[m.requires]; !known {
+					return nil, fmt.Errorf("migration %s requires %q, which isn't something a migration can require", entry.Name(), m.requires)
+				}
+			}
+		} else {
+			m.down = string(content)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+type appliedMigration struct {
+	checksum  string
+	appliedAt time.Time
+}
+
+// appliedMigrations makes sure schema_migrations exists and returns what it holds
+func appliedMigrations() (map[int]appliedMigration, error) {
+	if _, err := DB.Exec(migrationsTable[Driver]); err != nil {
+		return nil, err
+	}
+
+	rows, err := DB.Query("SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// checkApplied fails if an applied migration was edited, or if the database has migrations
+// from a newer build than this one
+func checkApplied(migrations []migration, applied map[int]appliedMigration) error {
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.version] = true
+		if a, ok := applied[m.version]; ok && a.checksum != m.checksum {
+			return fmt.Errorf("migration %04d_%s was changed after it was applied, add a new migration instead", m.version, m.name)
+		}
+	}
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("database has migration %04d applied, which this build doesn't know about", version)
+		}
+	}
+	return nil
+}
+
+// Migrate applies every pending migration in order, each in its own transaction
+func Migrate() error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	if err := adoptLegacySchema(migrations[0]); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+	if err := checkApplied(migrations, applied); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+		met, err := requirementMet(context.Background(), m.requires)
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s: checking for %s: %w", m.version, m.name, m.requires, err)
+		}
+		if !met {
+			log.Printf("Skipped migration %04d_%s, the database has no %s", m.version, m.name, m.requires)
+			continue
+		}
+		err = inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(Driver.Rebind("INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)"), m.version, m.name, m.checksum)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.version, m.name, err)
+		}
+		log.Printf("Applied migration %04d_%s", m.version, m.name)
+	}
+	return nil
+}
+
+// MigrateDown rolls back the latest steps migrations, newest first
+func MigrateDown(steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+	if err := checkApplied(migrations, applied); err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.version]; !ok {
+			continue
+		}
+		err := inTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(Driver.Rebind("DELETE FROM schema_migrations WHERE version = ?"), m.version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("rolling back migration %04d_%s: %w", m.version, m.name, err)
+		}
+		log.Printf("Rolled back migration %04d_%s", m.version, m.name)
+		steps--
+	}
+	return nil
+}
+
+// MigrationStatus lists every migration this build has and whether the database has it
+func MigrationStatus() ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{Version: m.version, Name: m.name, Requires: m.requires}
+		if a, ok := applied[m.version]; ok {
+			appliedAt := a.appliedAt
+			state.AppliedAt = &appliedAt
+			state.Modified = a.checksum != m.checksum
+		} else {
+			met, err := requirementMet(context.Background(), m.requires)
+			if err != nil {
+				return nil, err
+			}
+			state.Skipped = !met
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// CheckMigrations fails unless the database has exactly the migrations this build has, unchanged.
+// Migrations the database can't run (see requirements) don't count as pending.
+// Unlike the others it only reads, so the readiness probe can call it as often as it likes.
+func CheckMigrations(ctx context.Context) (version int, err error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := DB.QueryContext(ctx, "SELECT version, checksum FROM schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	applied := map[int]appliedMigration{}
+	for rows.Next() {
+		var v int
+		var a appliedMigration
+		if err := rows.Scan(&v, &a.checksum); err != nil {
+			return 0, err
+		}
+		applied[v] = a
+		version = max(version, v)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := checkApplied(migrations, applied); err != nil {
+		return version, err
+	}
+	pending := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+		met, err := requirementMet(ctx, m.requires)
+		if err != nil {
+			return version, err
+		}
+		if met {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return version, fmt.Errorf("%d migration(s) pending, run the migrate command", pending)
+	}
+	return version, nil
+}
+
+// inTx runs fn in a transaction, committing if it returns nil and rolling back otherwise
+func inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckMigrations(t *testing.T) {
+	Open(Config{Driver: SQLite, DSN: filepath.Join(t.TempDir(), "test.db")})
+	defer DB.Close()
+	ctx := context.Background()
+
+	if _, err := CheckMigrations(ctx); err == nil {
+		t.Error("an empty database passed")
+	}
+
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	latest := latestMigration(t)
+	if version, err := CheckMigrations(ctx); err != nil || version != latest {
+		t.Errorf("after Migrate got version %d, %v, want %d and no error", version, err, latest)
+	}
+
+	if err := MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckMigrations(ctx); err == nil || !strings.Contains(err.Error(), "1 migration(s) pending") {
+		t.Errorf("got %v, want the pending migration reported", err)
+	}
+
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec("UPDATE schema_migrations SET checksum = 'edited' WHERE version = ?", latest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckMigrations(ctx); err == nil || !strings.Contains(err.Error(), "was changed") {
+		t.Errorf("got %v, want the edited migration reported", err)
+	}
+}
+
+// latestMigration is the newest migration the open database can run, 0004 needs FTS5
+func latestMigration(t *testing.T) int {
+	t.Helper()
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := 0
+	for _, m := range migrations {
+		met, err := requirementMet(context.Background(), m.requires)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if met {
+			latest = m.version
+		}
+	}
+	return latest
+}
+
+// the search index migration only runs with FTS5 (go test -tags sqlite_fts5), without it
+// it has to stay out of the way
+func TestSearchMigration(t *testing.T) {
+	Open(Config{Driver: SQLite, DSN: filepath.Join(t.TempDir(), "test.db")})
+	defer DB.Close()
+	ctx := context.Background()
+	fts5, err := requirementMet(ctx, "fts5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckMigrations(ctx); err != nil {
+		t.Errorf("got %v, a migration the database can't run isn't pending", err)
+	}
+	states, err := MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	search := states[3]
+	if search.Name != "search_index" || search.Requires != "fts5" || search.Skipped == fts5 || (search.AppliedAt != nil) != fts5 {
+		t.Fatalf("with FTS5 %v got %+v", fts5, search)
+	}
+	if !fts5 {
+		return
+	}
+
+	// rows from before the index are filled in, later ones are kept up to date by the triggers
+	if err := MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		"INSERT INTO users (username, password_hash) VALUES ('alice', 'hash')",
+		"INSERT INTO topics (title, description, created_by) VALUES ('Gophers', 'all about them', 1)",
+		"INSERT INTO posts (topic_id, title, body, created_by) VALUES (1, 'Channels', 'unbuffered gophers', 1)",
+	} {
+		if _, err := DB.Exec(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DB.Exec("INSERT INTO comments (post_id, body, created_by) VALUES (1, 'gophers everywhere', 1)"); err != nil {
+		t.Fatal(err)
+	}
+	var found []string
+	rows, err := DB.Query("SELECT doc_type FROM search_index WHERE search_index MATCH 'gophers' ORDER BY rowid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var docType string
+		rows.Scan(&docType)
+		found = append(found, docType)
+	}
+	if strings.Join(found, ",") != "topic,post,comment" {
+		t.Errorf("search for gophers found %v", found)
+	}
+}
@@ -0,0 +1,15 @@
+-- children before parents because of the foreign keys. Triggers go with their table,
+-- the functions they call have to be dropped separately.
+DROP TABLE IF EXISTS search_index;
+DROP TABLE IF EXISTS topic_moderators;
+DROP TABLE IF EXISTS comment_revisions;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS votes;
+DROP TABLE IF EXISTS topics;
+DROP TABLE IF EXISTS users;
+
+DROP FUNCTION IF EXISTS topics_search();
+DROP FUNCTION IF EXISTS posts_search();
+DROP FUNCTION IF EXISTS comments_search();
+DROP FUNCTION IF EXISTS delete_target_votes();
@@ -0,0 +1,168 @@
+-- the same schema as sqlite/0001_initial_schema.up.sql, written for Postgres.
+-- Timestamps are TIMESTAMP(0) in UTC (database.Open sets the session time zone), which matches
+-- SQLite's CURRENT_TIMESTAMP: whole seconds, no zone. The search index is part of the schema
+-- here since Postgres always has full-text search.
+
+CREATE TABLE users (
+	id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	username TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('member', 'moderator', 'admin')),
+	created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE topics (
+	id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	title TEXT NOT NULL,
+	description TEXT,
+	created_by INTEGER NOT NULL REFERENCES users(id),
+	created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE posts (
+	id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	topic_id INTEGER NOT NULL REFERENCES topics(id) ON DELETE CASCADE,
+	title TEXT NOT NULL,
+	body TEXT NOT NULL,
+	created_by INTEGER NOT NULL REFERENCES users(id),
+	created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP,
+	upvotes INTEGER NOT NULL DEFAULT 0,
+	downvotes INTEGER NOT NULL DEFAULT 0,
+	score INTEGER NOT NULL DEFAULT 0,
+	hot_rank DOUBLE PRECISION NOT NULL DEFAULT 0,
+	controversy DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE TABLE comments (
+	id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+	parent_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+	body TEXT NOT NULL,
+	created_by INTEGER NOT NULL REFERENCES users(id),
+	created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP,
+	edited_at TIMESTAMP(0),
+	upvotes INTEGER NOT NULL DEFAULT 0,
+	downvotes INTEGER NOT NULL DEFAULT 0,
+	score INTEGER NOT NULL DEFAULT 0
+);
+
+-- one vote per user per post/comment, upvotes/downvotes/score on the target rows are kept in sync with it
+CREATE TABLE votes (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+	target_id INTEGER NOT NULL,
+	value INTEGER NOT NULL CHECK (value IN (-1, 1)),
+	created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(user_id, target_type, target_id)
+);
+
+-- target_id points at posts or comments depending on target_type, so it can't be a foreign key.
+-- These triggers do the cascading instead, and they also fire for rows removed by a cascade.
+CREATE FUNCTION delete_target_votes() RETURNS trigger AS $$
+BEGIN
+	DELETE FROM votes WHERE target_type = TG_ARGV[0] AND target_id = OLD.id;
+	RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_delete_votes AFTER DELETE ON posts
+	FOR EACH ROW EXECUTE FUNCTION delete_target_votes('post');
+CREATE TRIGGER comments_delete_votes AFTER DELETE ON comments
+	FOR EACH ROW EXECUTE FUNCTION delete_target_votes('comment');
+
+CREATE INDEX idx_votes_target ON votes(target_type, target_id);
+
+CREATE INDEX idx_comments_parent ON comments(parent_id);
+
+-- listings page through (sort column, id), these keep that from scanning whole tables
+CREATE INDEX idx_topics_created ON topics(created_at, id);
+CREATE INDEX idx_posts_topic_created ON posts(topic_id, created_at, id);
+CREATE INDEX idx_posts_topic_score ON posts(topic_id, score, id);
+CREATE INDEX idx_posts_topic_hot ON posts(topic_id, hot_rank, id);
+CREATE INDEX idx_posts_topic_controversy ON posts(topic_id, controversy, id);
+CREATE INDEX idx_comments_post_created ON comments(post_id, created_at, id);
+
+CREATE TABLE comment_revisions (
+	id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	comment_id INTEGER NOT NULL REFERENCES comments(id) ON DELETE CASCADE,
+	body TEXT NOT NULL,
+	edited_by INTEGER NOT NULL REFERENCES users(id),
+	created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_comment_revisions_comment ON comment_revisions(comment_id);
+
+CREATE TABLE topic_moderators (
+	topic_id INTEGER NOT NULL REFERENCES topics(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(topic_id, user_id)
+);
+
+-- search_index holds topics, posts and comments together so one query can rank all of them,
+-- like the FTS5 table on SQLite. document is what gets searched, titles weigh more than bodies.
+CREATE TABLE search_index (
+	doc_type TEXT NOT NULL,
+	doc_id INTEGER NOT NULL,
+	topic_id INTEGER NOT NULL,
+	post_id INTEGER,
+	created_by INTEGER NOT NULL,
+	created_at TIMESTAMP(0),
+	title TEXT NOT NULL,
+	body TEXT NOT NULL,
+	document tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('simple', title), 'A') || setweight(to_tsvector('simple', body), 'B')
+	) STORED,
+	PRIMARY KEY(doc_type, doc_id)
+);
+
+CREATE INDEX idx_search_document ON search_index USING GIN (document);
+
+-- one trigger function per table keeps its rows in the index
+CREATE FUNCTION topics_search() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		DELETE FROM search_index WHERE doc_type = 'topic' AND doc_id = OLD.id;
+		RETURN OLD;
+	END IF;
+	INSERT INTO search_index (doc_type, doc_id, topic_id, post_id, created_by, created_at, title, body)
+	VALUES ('topic', NEW.id, NEW.id, NULL, NEW.created_by, NEW.created_at, NEW.title, COALESCE(NEW.description, ''))
+	ON CONFLICT (doc_type, doc_id) DO UPDATE SET title = excluded.title, body = excluded.body;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION posts_search() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		DELETE FROM search_index WHERE doc_type = 'post' AND doc_id = OLD.id;
+		RETURN OLD;
+	END IF;
+	INSERT INTO search_index (doc_type, doc_id, topic_id, post_id, created_by, created_at, title, body)
+	VALUES ('post', NEW.id, NEW.topic_id, NEW.id, NEW.created_by, NEW.created_at, NEW.title, NEW.body)
+	ON CONFLICT (doc_type, doc_id) DO UPDATE SET title = excluded.title, body = excluded.body;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION comments_search() RETURNS trigger AS $$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		DELETE FROM search_index WHERE doc_type = 'comment' AND doc_id = OLD.id;
+		RETURN OLD;
+	END IF;
+	INSERT INTO search_index (doc_type, doc_id, topic_id, post_id, created_by, created_at, title, body)
+	VALUES ('comment', NEW.id, (SELECT topic_id FROM posts WHERE id = NEW.post_id), NEW.post_id,
+		NEW.created_by, NEW.created_at, '', NEW.body)
+	ON CONFLICT (doc_type, doc_id) DO UPDATE SET body = excluded.body;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER topics_search AFTER INSERT OR UPDATE OF title, description OR DELETE ON topics
+	FOR EACH ROW EXECUTE FUNCTION topics_search();
+CREATE TRIGGER posts_search AFTER INSERT OR UPDATE OF title, body OR DELETE ON posts
+	FOR EACH ROW EXECUTE FUNCTION posts_search();
+CREATE TRIGGER comments_search AFTER INSERT OR UPDATE OF body OR DELETE ON comments
+	FOR EACH ROW EXECUTE FUNCTION comments_search();
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS post_follows;
+DROP TABLE IF EXISTS topic_follows;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notifications;
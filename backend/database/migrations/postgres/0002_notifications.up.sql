@@ -0,0 +1,43 @@
+-- the same tables as sqlite/0002_notifications.up.sql, written for Postgres
+
+CREATE TABLE notifications (
+	id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type TEXT NOT NULL CHECK (type IN ('reply', 'mention', 'new_post', 'new_comment')),
+	actor_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	topic_id INTEGER NOT NULL REFERENCES topics(id) ON DELETE CASCADE,
+	post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+	comment_id INTEGER REFERENCES comments(id) ON DELETE CASCADE,
+	created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP,
+	read_at TIMESTAMP(0)
+);
+
+CREATE INDEX idx_notifications_user_created ON notifications(user_id, created_at, id);
+CREATE INDEX idx_notifications_post ON notifications(post_id);
+CREATE INDEX idx_notifications_comment ON notifications(comment_id);
+
+-- only the types a user has changed are stored, every type is on until turned off
+CREATE TABLE notification_preferences (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type TEXT NOT NULL CHECK (type IN ('reply', 'mention', 'new_post', 'new_comment')),
+	enabled BOOLEAN NOT NULL,
+	PRIMARY KEY(user_id, type)
+);
+
+CREATE TABLE topic_follows (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	topic_id INTEGER NOT NULL REFERENCES topics(id) ON DELETE CASCADE,
+	created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(user_id, topic_id)
+);
+
+CREATE TABLE post_follows (
+	user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	post_id INTEGER NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+	created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(user_id, post_id)
+);
+
+-- the dispatcher looks followers up by what they follow
+CREATE INDEX idx_topic_follows_topic ON topic_follows(topic_id);
+CREATE INDEX idx_post_follows_post ON post_follows(post_id);
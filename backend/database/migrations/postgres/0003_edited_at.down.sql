@@ -0,0 +1,2 @@
+ALTER TABLE topics DROP COLUMN edited_at;
+ALTER TABLE posts DROP COLUMN edited_at;
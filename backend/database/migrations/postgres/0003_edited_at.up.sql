@@ -0,0 +1,3 @@
+-- the same columns as sqlite/0003_edited_at.up.sql, written for Postgres
+ALTER TABLE posts ADD COLUMN edited_at TIMESTAMP(0);
+ALTER TABLE topics ADD COLUMN edited_at TIMESTAMP(0);
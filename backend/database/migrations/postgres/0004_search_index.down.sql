@@ -0,0 +1,2 @@
+-- nothing to undo, see the up file
+SELECT 1;
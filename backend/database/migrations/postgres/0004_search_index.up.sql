@@ -0,0 +1,3 @@
+-- the search index has been part of 0001_initial_schema here from the start, since Postgres always
+-- has full-text search. This only keeps the versions the same as on SQLite.
+SELECT 1;
@@ -0,0 +1,23 @@
+-- the search index hangs off these tables, so it goes first. 0004 drops it when rolled back, this is
+-- for databases from before 0004 where the server built it at startup. Its triggers have to be dropped
+-- before it, or SQLite leaves the table locked. Dropping the index needs a build with FTS5 if it exists.
+DROP TRIGGER IF EXISTS topics_search_insert;
+DROP TRIGGER IF EXISTS topics_search_update;
+DROP TRIGGER IF EXISTS topics_search_delete;
+DROP TRIGGER IF EXISTS posts_search_insert;
+DROP TRIGGER IF EXISTS posts_search_update;
+DROP TRIGGER IF EXISTS posts_search_delete;
+DROP TRIGGER IF EXISTS comments_search_insert;
+DROP TRIGGER IF EXISTS comments_search_update;
+DROP TRIGGER IF EXISTS comments_search_delete;
+DROP TABLE IF EXISTS search_index;
+
+-- children before parents, the foreign keys are enforced. votes goes after posts and comments
+-- because their delete triggers still write to it while those tables are dropped.
+DROP TABLE IF EXISTS topic_moderators;
+DROP TABLE IF EXISTS comment_revisions;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS votes;
+DROP TABLE IF EXISTS topics;
+DROP TABLE IF EXISTS users;
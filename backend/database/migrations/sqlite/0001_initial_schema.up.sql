@@ -0,0 +1,104 @@
+-- the schema as it was when migrations were introduced
+
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('member', 'moderator', 'admin')),
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE topics (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	description TEXT,
+	created_by INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(created_by) REFERENCES users(id)
+);
+
+CREATE TABLE posts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	topic_id INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	body TEXT NOT NULL,
+	created_by INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	upvotes INTEGER NOT NULL DEFAULT 0,
+	downvotes INTEGER NOT NULL DEFAULT 0,
+	score INTEGER NOT NULL DEFAULT 0,
+	hot_rank REAL NOT NULL DEFAULT 0,
+	controversy REAL NOT NULL DEFAULT 0,
+	FOREIGN KEY(topic_id) REFERENCES topics(id) ON DELETE CASCADE,
+	FOREIGN KEY(created_by) REFERENCES users(id)
+);
+
+CREATE TABLE comments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	post_id INTEGER NOT NULL,
+	parent_id INTEGER,
+	body TEXT NOT NULL,
+	created_by INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	edited_at DATETIME,
+	upvotes INTEGER NOT NULL DEFAULT 0,
+	downvotes INTEGER NOT NULL DEFAULT 0,
+	score INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE,
+	FOREIGN KEY(parent_id) REFERENCES comments(id) ON DELETE CASCADE,
+	FOREIGN KEY(created_by) REFERENCES users(id)
+);
+
+-- one vote per user per post/comment, upvotes/downvotes/score on the target rows are kept in sync with it
+CREATE TABLE votes (
+	user_id INTEGER NOT NULL,
+	target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+	target_id INTEGER NOT NULL,
+	value INTEGER NOT NULL CHECK (value IN (-1, 1)),
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(user_id, target_type, target_id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- target_id points at posts or comments depending on target_type, so it can't be a foreign key.
+-- These triggers do the cascading instead, and they also fire for rows removed by a cascade.
+CREATE TRIGGER posts_delete_votes AFTER DELETE ON posts BEGIN
+	DELETE FROM votes WHERE target_type = 'post' AND target_id = OLD.id;
+END;
+CREATE TRIGGER comments_delete_votes AFTER DELETE ON comments BEGIN
+	DELETE FROM votes WHERE target_type = 'comment' AND target_id = OLD.id;
+END;
+
+CREATE INDEX idx_votes_target ON votes(target_type, target_id);
+
+CREATE INDEX idx_comments_parent ON comments(parent_id);
+
+-- listings page through (sort column, id), these keep that from scanning whole tables
+CREATE INDEX idx_topics_created ON topics(created_at, id);
+CREATE INDEX idx_posts_topic_created ON posts(topic_id, created_at, id);
+CREATE INDEX idx_posts_topic_score ON posts(topic_id, score, id);
+CREATE INDEX idx_posts_topic_hot ON posts(topic_id, hot_rank, id);
+CREATE INDEX idx_posts_topic_controversy ON posts(topic_id, controversy, id);
+CREATE INDEX idx_comments_post_created ON comments(post_id, created_at, id);
+
+CREATE TABLE comment_revisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	comment_id INTEGER NOT NULL,
+	body TEXT NOT NULL,
+	edited_by INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY(comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+	FOREIGN KEY(edited_by) REFERENCES users(id)
+);
+
+CREATE INDEX idx_comment_revisions_comment ON comment_revisions(comment_id);
+
+CREATE TABLE topic_moderators (
+	topic_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(topic_id, user_id),
+	FOREIGN KEY(topic_id) REFERENCES topics(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
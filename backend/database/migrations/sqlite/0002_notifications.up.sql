@@ -0,0 +1,53 @@
+-- notifications tell user_id that actor_id did something on a post: replied to them, mentioned
+-- them, or added to a topic or post they follow. comment_id is empty when it was the post itself.
+CREATE TABLE notifications (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	type TEXT NOT NULL CHECK (type IN ('reply', 'mention', 'new_post', 'new_comment')),
+	actor_id INTEGER NOT NULL,
+	topic_id INTEGER NOT NULL,
+	post_id INTEGER NOT NULL,
+	comment_id INTEGER,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	read_at DATETIME,
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(actor_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(topic_id) REFERENCES topics(id) ON DELETE CASCADE,
+	FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE,
+	FOREIGN KEY(comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_notifications_user_created ON notifications(user_id, created_at, id);
+CREATE INDEX idx_notifications_post ON notifications(post_id);
+CREATE INDEX idx_notifications_comment ON notifications(comment_id);
+
+-- only the types a user has changed are stored, every type is on until turned off
+CREATE TABLE notification_preferences (
+	user_id INTEGER NOT NULL,
+	type TEXT NOT NULL CHECK (type IN ('reply', 'mention', 'new_post', 'new_comment')),
+	enabled BOOLEAN NOT NULL,
+	PRIMARY KEY(user_id, type),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE topic_follows (
+	user_id INTEGER NOT NULL,
+	topic_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(user_id, topic_id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(topic_id) REFERENCES topics(id) ON DELETE CASCADE
+);
+
+CREATE TABLE post_follows (
+	user_id INTEGER NOT NULL,
+	post_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY(user_id, post_id),
+	FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+	FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+-- the dispatcher looks followers up by what they follow
+CREATE INDEX idx_topic_follows_topic ON topic_follows(topic_id);
+CREATE INDEX idx_post_follows_post ON post_follows(post_id);
@@ -0,0 +1,4 @@
+-- posts and topics remember when they were last edited, like comments already do.
+-- Empty until the first edit, the feeds use it for <updated>.
+ALTER TABLE posts ADD COLUMN edited_at DATETIME;
+ALTER TABLE topics ADD COLUMN edited_at DATETIME;
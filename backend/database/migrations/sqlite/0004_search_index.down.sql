@@ -0,0 +1,11 @@
+-- the triggers go before the table, or SQLite leaves it locked
+DROP TRIGGER IF EXISTS topics_search_insert;
+DROP TRIGGER IF EXISTS topics_search_update;
+DROP TRIGGER IF EXISTS topics_search_delete;
+DROP TRIGGER IF EXISTS posts_search_insert;
+DROP TRIGGER IF EXISTS posts_search_update;
+DROP TRIGGER IF EXISTS posts_search_delete;
+DROP TRIGGER IF EXISTS comments_search_insert;
+DROP TRIGGER IF EXISTS comments_search_update;
+DROP TRIGGER IF EXISTS comments_search_delete;
+DROP TABLE IF EXISTS search_index;
@@ -0,0 +1,76 @@
+-- requires: fts5
+-- search_index holds topics, posts and comments together so one query can rank all of them.
+-- The rowid is the row's id*4 plus 1 for topics, 2 for posts and 3 for comments, so the
+-- triggers can find a row's entry without scanning the index.
+--
+-- It needs FTS5, which go-sqlite3 only includes with -tags sqlite_fts5. Without it this migration
+-- is skipped and search stays off, it runs the first time the server starts on a build that has it.
+-- Servers from before this migration built the index themselves at startup, that copy is dropped and
+-- rebuilt here so every database ends up with the same one.
+DROP TRIGGER IF EXISTS topics_search_insert;
+DROP TRIGGER IF EXISTS topics_search_update;
+DROP TRIGGER IF EXISTS topics_search_delete;
+DROP TRIGGER IF EXISTS posts_search_insert;
+DROP TRIGGER IF EXISTS posts_search_update;
+DROP TRIGGER IF EXISTS posts_search_delete;
+DROP TRIGGER IF EXISTS comments_search_insert;
+DROP TRIGGER IF EXISTS comments_search_update;
+DROP TRIGGER IF EXISTS comments_search_delete;
+DROP TABLE IF EXISTS search_index;
+
+CREATE VIRTUAL TABLE search_index USING fts5(
+	title,
+	body,
+	doc_type UNINDEXED,
+	doc_id UNINDEXED,
+	topic_id UNINDEXED,
+	post_id UNINDEXED,
+	created_by UNINDEXED,
+	created_at UNINDEXED,
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER topics_search_insert AFTER INSERT ON topics BEGIN
+	INSERT INTO search_index (rowid, title, body, doc_type, doc_id, topic_id, post_id, created_by, created_at)
+	VALUES (NEW.id * 4 + 1, NEW.title, COALESCE(NEW.description, ''), 'topic', NEW.id, NEW.id, NULL, NEW.created_by, NEW.created_at);
+END;
+CREATE TRIGGER topics_search_update AFTER UPDATE OF title, description ON topics BEGIN
+	UPDATE search_index SET title = NEW.title, body = COALESCE(NEW.description, '') WHERE rowid = NEW.id * 4 + 1;
+END;
+CREATE TRIGGER topics_search_delete AFTER DELETE ON topics BEGIN
+	DELETE FROM search_index WHERE rowid = OLD.id * 4 + 1;
+END;
+
+CREATE TRIGGER posts_search_insert AFTER INSERT ON posts BEGIN
+	INSERT INTO search_index (rowid, title, body, doc_type, doc_id, topic_id, post_id, created_by, created_at)
+	VALUES (NEW.id * 4 + 2, NEW.title, NEW.body, 'post', NEW.id, NEW.topic_id, NEW.id, NEW.created_by, NEW.created_at);
+END;
+CREATE TRIGGER posts_search_update AFTER UPDATE OF title, body ON posts BEGIN
+	UPDATE search_index SET title = NEW.title, body = NEW.body WHERE rowid = NEW.id * 4 + 2;
+END;
+CREATE TRIGGER posts_search_delete AFTER DELETE ON posts BEGIN
+	DELETE FROM search_index WHERE rowid = OLD.id * 4 + 2;
+END;
+
+CREATE TRIGGER comments_search_insert AFTER INSERT ON comments BEGIN
+	INSERT INTO search_index (rowid, title, body, doc_type, doc_id, topic_id, post_id, created_by, created_at)
+	VALUES (NEW.id * 4 + 3, '', NEW.body, 'comment', NEW.id,
+		(SELECT topic_id FROM posts WHERE id = NEW.post_id), NEW.post_id, NEW.created_by, NEW.created_at);
+END;
+CREATE TRIGGER comments_search_update AFTER UPDATE OF body ON comments BEGIN
+	UPDATE search_index SET body = NEW.body WHERE rowid = NEW.id * 4 + 3;
+END;
+CREATE TRIGGER comments_search_delete AFTER DELETE ON comments BEGIN
+	DELETE FROM search_index WHERE rowid = OLD.id * 4 + 3;
+END;
+
+-- everything already in the database
+INSERT INTO search_index (rowid, title, body, doc_type, doc_id, topic_id, post_id, created_by, created_at)
+SELECT id * 4 + 1, title, COALESCE(description, ''), 'topic', id, id, NULL, created_by, created_at FROM topics;
+
+INSERT INTO search_index (rowid, title, body, doc_type, doc_id, topic_id, post_id, created_by, created_at)
+SELECT id * 4 + 2, title, body, 'post', id, topic_id, id, created_by, created_at FROM posts;
+
+INSERT INTO search_index (rowid, title, body, doc_type, doc_id, topic_id, post_id, created_by, created_at)
+SELECT c.id * 4 + 3, '', c.body, 'comment', c.id, p.topic_id, c.post_id, c.created_by, c.created_at
+FROM comments c JOIN posts p ON p.id = c.post_id;
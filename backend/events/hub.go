@@ -0,0 +1,325 @@
+// Package events is the in-process pub/sub behind the live streams. The handlers publish what
+// changed to a channel per topic and per post, and every stream subscribed to that channel gets it.
+//
+// Each channel keeps its recent events so a client that lost its connection can pick up where it
+// left off. When that isn't possible any more (the events are too old, or the server restarted in
+// between) the client gets a Resync event instead and should reload what it is showing.
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// History is how many events each channel keeps for resuming
+	History = 100
+	// MaxAge is how long events are kept for resuming
+	MaxAge = 5 * time.Minute
+	// Buffer is how many events a subscriber can fall behind by before it is dropped.
+	// Dropped streams end, and the client resumes from the history when it reconnects.
+	Buffer = 32
+)
+
+// Resync is the type of the event sent in place of events that can't be replayed
+const Resync = "resync"
+
+// TopicChannel and PostChannel are the channel names the handlers publish to
+func TopicChannel(id int) string { return "topic:" + strconv.Itoa(id) }
+func PostChannel(id int) string  { return "post:" + strconv.Itoa(id) }
+
+// ParseChannel splits a channel name from a client, e.g. post:12, into "post" and 12
+func ParseChannel(name string) (kind string, id int, ok bool) {
+	kind, idStr, found := strings.Cut(name, ":")
+	id, err := strconv.Atoi(idStr)
+	if !found || err != nil || id <= 0 || (kind != "topic" && kind != "post") {
+		return "", 0, false
+	}
+	return kind, id, true
+}
+
+// Event is one change. IDs increase across the whole hub, so they also order events between channels.
+// Events sent with Broadcast have ID 0, they aren't kept and can't be resumed from.
+type Event struct {
+	ID   uint64
+	Type string          // e.g. comment.created
+	Data json.RawMessage // the JSON sent to clients
+	Last bool            // what the channel is about is gone, streams end after this event
+}
+
+type stored struct {
+	Event
+	at time.Time
+}
+
+type channel struct {
+	history   []stored // oldest first
+	truncated uint64   // the newest ID dropped from history, anything up to it can't be replayed
+	subs      map[*Subscription]bool
+}
+
+// Hub hands events from publishers to subscribers. The zero value isn't usable, call NewHub.
+type Hub struct {
+	mu        sync.Mutex
+	channels  map[string]*channel
+	within    map[string]map[*Subscription]bool // open subscriptions by the channel theirs belongs to
+	first     uint64 // the first ID this hub hands out
+	last      uint64 // the newest ID handed out so far, first-1 before any
+	pruned    uint64 // the newest ID of a channel that was forgotten altogether
+	lastSweep time.Time
+	closed    bool
+	done      chan struct{}
+	now       func() time.Time
+}
+
+// NewHub starts IDs from the current time in microseconds, so the IDs of one run of the server
+// are all above those of the runs before it and a Last-Event-ID from before a restart is recognised
+func NewHub() *Hub {
+	h := &Hub{channels: map[string]*channel{}, within: map[string]map[*Subscription]bool{}, done: make(chan struct{}), now: time.Now}
+	h.first = uint64(h.now().UnixMicro())
+	h.last = h.first - 1
+	return h
+}
+
+// Publish sends an event to everyone subscribed to the channel, data is encoded as JSON
+func (h *Hub) Publish(name, typ string, data any) {
+	h.publish(name, typ, data, false)
+}
+
+// PublishLast is Publish for the end of a channel, e.g. post.deleted on the post's channel.
+// Subscribers get the event and then their subscription is closed, and so do the subscribers
+// of the channels that belong to it (see SubscribeWithin).
+func (h *Hub) PublishLast(name, typ string, data any) {
+	h.publish(name, typ, data, true)
+}
+
+// Broadcast sends an event to whoever is subscribed right now without keeping it, for things
+// that mean nothing later on like who is typing. Nobody resuming gets it.
+func (h *Hub) Broadcast(name, typ string, data any) {
+	ev := Event{Type: typ, Data: encode(typ, data)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ch, ok := h.channels[name]; ok && !h.closed {
+		h.send(ch, ev)
+	}
+}
+
+func encode(typ string, data any) json.RawMessage {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		// everything published is one of our own structs, this can't fail
+		panic("events: can't encode " + typ + ": " + err.Error())
+	}
+	return raw
+}
+
+func (h *Hub) publish(name, typ string, data any, last bool) {
+	raw := encode(typ, data)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	now := h.now()
+	if now.Sub(h.lastSweep) >= MaxAge/2 {
+		h.sweep(now)
+	}
+
+	h.last++
+	ev := Event{ID: h.last, Type: typ, Data: raw, Last: last}
+	ch := h.channel(name)
+	ch.history = append(ch.history, stored{ev, now})
+	if len(ch.history) > History {
+		ch.truncated = ch.history[0].ID
+		ch.history = append(ch.history[:0:0], ch.history[1:]...)
+	}
+	h.send(ch, ev)
+	if last {
+		for sub := range h.within[name] {
+			h.end(sub, ev)
+		}
+	}
+}
+
+// send hands ev to every subscriber of ch without waiting on any of them
+func (h *Hub) send(ch *channel, ev Event) {
+	for sub := range ch.subs {
+		if ev.Last {
+			h.end(sub, ev)
+			continue
+		}
+		select {
+		case sub.c <- ev:
+		default:
+			// too slow, it will catch up from the history when the client reconnects
+			h.unsubscribe(sub)
+		}
+	}
+}
+
+// end hands a subscriber the last event it gets and closes it. One too far behind to take it
+// is closed all the same, and finds the channel gone when it reconnects.
+func (h *Hub) end(sub *Subscription, last Event) {
+	select {
+	case sub.c <- last:
+	default:
+	}
+	h.unsubscribe(sub)
+}
+
+// ending is the last event of a channel that has ended, or of the channel it belongs to,
+// for as long as the history still has it
+func (h *Hub) ending(ch *channel, parent string) (Event, bool) {
+	for _, c := range []*channel{ch, h.channels[parent]} {
+		if c != nil && len(c.history) > 0 && c.history[len(c.history)-1].Last {
+			return c.history[len(c.history)-1].Event, true
+		}
+	}
+	return Event{}, false
+}
+
+func (h *Hub) channel(name string) *channel {
+	ch, ok := h.channels[name]
+	if !ok {
+		ch = &channel{subs: map[*Subscription]bool{}}
+		h.channels[name] = ch
+	}
+	return ch
+}
+
+// sweep drops events older than MaxAge, and channels with nothing left and nobody listening
+func (h *Hub) sweep(now time.Time) {
+	for name, ch := range h.channels {
+		keep := 0
+		for keep < len(ch.history) && now.Sub(ch.history[keep].at) >= MaxAge {
+			ch.truncated = ch.history[keep].ID
+			keep++
+		}
+		ch.history = ch.history[keep:]
+		if len(ch.history) == 0 && len(ch.subs) == 0 {
+			h.pruned = max(h.pruned, ch.truncated)
+			delete(h.channels, name)
+		}
+	}
+	h.lastSweep = now
+}
+
+// Subscription is one subscriber to one channel. C is closed when the subscription ends:
+// after Close, after a PublishLast, when the subscriber fell too far behind, or when the hub closes.
+type Subscription struct {
+	C       <-chan Event
+	c       chan Event
+	hub     *Hub
+	channel string
+	parent  string // the channel this one belongs to, if any
+}
+
+// Subscribe starts listening to a channel. lastID is the last event the client saw, 0 if it
+// is new. The events it missed come back as replay, or as a single Resync event when they
+// can't be replayed. ok is false once the hub is closed.
+func (h *Hub) Subscribe(name string, lastID uint64) (sub *Subscription, replay []Event, ok bool) {
+	return h.SubscribeWithin(name, "", lastID)
+}
+
+// SubscribeWithin is Subscribe for a channel that belongs to another one, like a post's channel
+// to its topic's. The subscription also ends with the last event of parent, so deleting a topic
+// ends the streams of its posts without anyone having to list them.
+func (h *Hub) SubscribeWithin(name, parent string, lastID uint64) (sub *Subscription, replay []Event, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, nil, false
+	}
+
+	c := make(chan Event, Buffer)
+	sub = &Subscription{C: c, c: c, hub: h, channel: name, parent: parent}
+	ch := h.channel(name)
+	ch.subs[sub] = true
+	if parent != "" {
+		if h.within[parent] == nil {
+			h.within[parent] = map[*Subscription]bool{}
+		}
+		h.within[parent][sub] = true
+	}
+
+	switch {
+	case lastID == 0 || lastID == h.last:
+	case lastID < h.first || lastID > h.last || lastID < ch.truncated || (len(ch.history) == 0 && lastID < h.pruned):
+		// the resync moves the client up to now, so it doesn't get another one next time
+		replay = []Event{{ID: h.last, Type: Resync, Data: json.RawMessage("{}")}}
+	default:
+		for _, ev := range ch.history {
+			if ev.ID > lastID {
+				replay = append(replay, ev.Event)
+			}
+		}
+	}
+
+	// it may have ended between the caller checking the post or topic exists and getting here,
+	// the last event then comes through C like it would have a moment later
+	if last, ended := h.ending(ch, parent); ended {
+		if n := len(replay); n > 0 && replay[n-1].Last {
+			replay = replay[:n-1]
+		}
+		h.end(sub, last)
+	}
+	return sub, replay, true
+}
+
+// Close ends the subscription, it is fine to call more than once
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.unsubscribe(s)
+}
+
+func (h *Hub) unsubscribe(sub *Subscription) {
+	ch, ok := h.channels[sub.channel]
+	if !ok || !ch.subs[sub] {
+		return
+	}
+	delete(ch.subs, sub)
+	if sub.parent != "" {
+		delete(h.within[sub.parent], sub)
+		if len(h.within[sub.parent]) == 0 {
+			delete(h.within, sub.parent)
+		}
+	}
+	close(sub.c)
+}
+
+// Close ends every subscription and refuses new ones, for shutting down. The streams would
+// otherwise keep their connections open until the shutdown timeout cuts them off.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	close(h.done)
+	for _, ch := range h.channels {
+		for sub := range ch.subs {
+			h.unsubscribe(sub)
+		}
+	}
+}
+
+// Done is closed when the hub closes, for connections that need to end even with nothing subscribed
+func (h *Hub) Done() <-chan struct{} {
+	return h.done
+}
+
+// Subscribers counts the open subscriptions of a channel
+func (h *Hub) Subscribers(name string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ch, ok := h.channels[name]; ok {
+		return len(ch.subs)
+	}
+	return 0
+}
@@ -0,0 +1,208 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+// receive takes whatever is waiting on the subscription without blocking
+func receive(sub *Subscription) (events []Event, open bool) {
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				return events, false
+			}
+			events = append(events, ev)
+		default:
+			return events, true
+		}
+	}
+}
+
+func types(events []Event) []string {
+	var out []string
+	for _, ev := range events {
+		out = append(out, ev.Type)
+	}
+	return out
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	h := NewHub()
+	post, _, _ := h.Subscribe(PostChannel(1), 0)
+	other, _, _ := h.Subscribe(PostChannel(2), 0)
+
+	h.Publish(PostChannel(1), "comment.created", map[string]int{"id": 7})
+	got, open := receive(post)
+	if len(got) != 1 || !open || got[0].Type != "comment.created" || string(got[0].Data) != `{"id":7}` {
+		t.Fatalf("got %+v (open %v)", got, open)
+	}
+	if got, _ := receive(other); got != nil {
+		t.Errorf("the other channel got %+v", got)
+	}
+
+	post.Close()
+	post.Close()
+	if _, open := receive(post); open {
+		t.Error("closed subscription is still open")
+	}
+	if n := h.Subscribers(PostChannel(1)); n != 0 {
+		t.Errorf("%d subscribers left", n)
+	}
+
+	h.PublishLast(PostChannel(2), "post.deleted", map[string]int{"id": 2})
+	if got, open := receive(other); len(got) != 1 || open {
+		t.Errorf("after the last event got %v, open %v", types(got), open)
+	}
+}
+
+func TestSubscribeWithin(t *testing.T) {
+	h := NewHub()
+	post, _, _ := h.SubscribeWithin(PostChannel(1), TopicChannel(1), 0)
+	elsewhere, _, _ := h.SubscribeWithin(PostChannel(2), TopicChannel(2), 0)
+	topic, _, _ := h.Subscribe(TopicChannel(1), 0)
+
+	// the topic's events are its own, only its end reaches the posts in it
+	h.Publish(TopicChannel(1), "topic.updated", nil)
+	if got, open := receive(post); got != nil || !open {
+		t.Errorf("the post got %v, open %v", types(got), open)
+	}
+	receive(topic)
+	h.PublishLast(TopicChannel(1), "topic.deleted", map[string]int{"id": 1})
+	for name, sub := range map[string]*Subscription{"topic": topic, "post": post} {
+		if got, open := receive(sub); len(got) != 1 || got[0].Type != "topic.deleted" || open {
+			t.Errorf("%s got %v, open %v", name, types(got), open)
+		}
+	}
+	if got, open := receive(elsewhere); got != nil || !open {
+		t.Errorf("a post in another topic got %v, open %v", types(got), open)
+	}
+	if n := len(h.within); n != 1 {
+		t.Errorf("%d parents still tracked, want the other topic's", n)
+	}
+
+	// subscribing just after the topic went gets its end rather than waiting forever
+	late, replay, _ := h.SubscribeWithin(PostChannel(3), TopicChannel(1), 0)
+	if got, open := receive(late); replay != nil || len(got) != 1 || got[0].Type != "topic.deleted" || open {
+		t.Errorf("a late subscriber got %v then %v, open %v", types(replay), types(got), open)
+	}
+
+	elsewhere.Close()
+	if n := len(h.within); n != 0 {
+		t.Errorf("%d parents still tracked after every subscription closed", n)
+	}
+}
+
+func TestResume(t *testing.T) {
+	h := NewHub()
+	now := time.Now()
+	h.now = func() time.Time { return now }
+
+	for _, typ := range []string{"a", "b", "c"} {
+		h.Publish(TopicChannel(1), typ, nil)
+		h.Publish(TopicChannel(2), "elsewhere", nil)
+	}
+	first := h.first
+
+	// after a, b and c only the later events of this channel come back
+	_, replay, _ := h.Subscribe(TopicChannel(1), first)
+	if got := types(replay); len(got) != 2 || got[0] != "b" || got[1] != "c" {
+		t.Errorf("resuming after a got %v", got)
+	}
+	if _, replay, _ := h.Subscribe(TopicChannel(1), h.last); replay != nil {
+		t.Errorf("an up to date client got %v", types(replay))
+	}
+
+	// IDs from before a restart, or that were never handed out, can't be resumed from
+	for _, lastID := range []uint64{first - 5, h.last + 1} {
+		_, replay, _ := h.Subscribe(TopicChannel(1), lastID)
+		if len(replay) != 1 || replay[0].Type != Resync || replay[0].ID != h.last {
+			t.Errorf("resuming from %d got %+v", lastID, replay)
+		}
+	}
+
+	// nor can events that fell out of the history
+	for range History {
+		h.Publish(TopicChannel(1), "more", nil)
+	}
+	if _, replay, _ := h.Subscribe(TopicChannel(1), first); len(replay) != 1 || replay[0].Type != Resync {
+		t.Errorf("resuming from before the history got %v", types(replay))
+	}
+
+	// or that got too old, once the channel is swept away
+	now = now.Add(MaxAge)
+	h.Publish(TopicChannel(3), "sweep", nil)
+	if _, ok := h.channels[TopicChannel(2)]; ok {
+		t.Fatal("an old channel with nobody listening wasn't swept")
+	}
+	if _, replay, _ := h.Subscribe(TopicChannel(2), first); len(replay) != 1 || replay[0].Type != Resync {
+		t.Errorf("resuming a swept channel got %v", types(replay))
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	h := NewHub()
+	slow, _, _ := h.Subscribe(PostChannel(1), 0)
+	for range Buffer + 1 {
+		h.Publish(PostChannel(1), "comment.created", nil)
+	}
+	got, open := receive(slow)
+	if open || len(got) != Buffer {
+		t.Errorf("slow subscriber got %d events and is open: %v", len(got), open)
+	}
+
+	// it picks up the one it missed when it comes back
+	_, replay, _ := h.Subscribe(PostChannel(1), got[len(got)-1].ID)
+	if len(replay) != 1 {
+		t.Errorf("resuming got %d events, want 1", len(replay))
+	}
+}
+
+func TestClose(t *testing.T) {
+	h := NewHub()
+	sub, _, _ := h.Subscribe(PostChannel(1), 0)
+	h.Close()
+	if _, open := receive(sub); open {
+		t.Error("subscription outlived the hub")
+	}
+	if _, _, ok := h.Subscribe(PostChannel(1), 0); ok {
+		t.Error("closed hub took a subscription")
+	}
+	h.Publish(PostChannel(1), "ignored", nil)
+	sub.Close()
+}
+
+func TestBroadcast(t *testing.T) {
+	h := NewHub()
+	h.Broadcast(PostChannel(1), "typing", nil) // nobody listening, nothing kept
+	sub, _, _ := h.Subscribe(PostChannel(1), 0)
+	h.Broadcast(PostChannel(1), "typing", map[string]int{"user_id": 3})
+	got, _ := receive(sub)
+	if len(got) != 1 || got[0].ID != 0 || got[0].Type != "typing" {
+		t.Errorf("got %+v", got)
+	}
+	if n := len(h.channels[PostChannel(1)].history); n != 0 {
+		t.Errorf("%d broadcasts kept for replaying", n)
+	}
+
+	select {
+	case <-h.Done():
+		t.Fatal("Done before Close")
+	default:
+	}
+	h.Close()
+	h.Close()
+	<-h.Done()
+}
+
+func TestParseChannel(t *testing.T) {
+	if kind, id, ok := ParseChannel(PostChannel(12)); !ok || kind != "post" || id != 12 {
+		t.Errorf("got %s %d %v", kind, id, ok)
+	}
+	for _, name := range []string{"", "post", "post:", "post:0", "post:x", "user:1", "topic:-1"} {
+		if _, _, ok := ParseChannel(name); ok {
+			t.Errorf("%q parsed", name)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package feeds writes Atom and RSS documents. The handlers fill in a Feed from the store and
+// pick the format, everything about the XML is in here.
+package feeds
+
+import (
+	"bytes"
+	"encoding/xml"
+	"html"
+	"strings"
+	"time"
+)
+
+const generator = "CampusCommons"
+
+// Feed is one feed in either format. Link is the page the feed follows and Self is the URL the
+// feed itself is served on, which also serves as the Atom ID.
+type Feed struct {
+	Title    string
+	Subtitle string
+	Link     string
+	Self     string
+	Updated  time.Time // the newest change in the feed, used for Last-Modified too
+	Entries  []Entry
+}
+
+// Entry is a post, comment or topic. Link is the page it is on and doubles as its ID.
+// Content is plain text, it is escaped for the formats that expect HTML.
+type Entry struct {
+	Title     string
+	Link      string
+	Author    string
+	Content   string
+	Published time.Time
+	Updated   time.Time // Published when it was never edited
+}
+
+// Add appends an entry and moves Updated up to it when it is newer
+func (f *Feed) Add(e Entry) {
+	f.Entries = append(f.Entries, e)
+	if updated := e.updated(); updated.After(f.Updated) {
+		f.Updated = updated
+	}
+}
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	Updated   string      `xml:"updated"`
+	Links     []atomLink  `xml:"link"`
+	Generator string      `xml:"generator"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Link      atomLink   `xml:"link"`
+	Author    atomAuthor `xml:"author"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Atom writes the feed as Atom 1.0 (RFC 4287)
+func Atom(f Feed) ([]byte, error) {
+	doc := atomFeed{
+		ID:       f.Self,
+		Title:    f.Title,
+		Subtitle: f.Subtitle,
+		Updated:  atomTime(f.Updated),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.Self},
+			{Rel: "alternate", Type: "text/html", Href: f.Link},
+		},
+		Generator: generator,
+	}
+	for _, e := range f.Entries {
+		doc.Entries = append(doc.Entries, atomEntry{
+			ID:        e.Link,
+			Title:     e.Title,
+			Link:      atomLink{Rel: "alternate", Type: "text/html", Href: e.Link},
+			Author:    atomAuthor{Name: e.Author},
+			Published: atomTime(e.Published),
+			Updated:   atomTime(e.updated()),
+			Content:   atomText{Type: "text", Body: e.Content},
+		})
+	}
+	return encode(doc)
+}
+
+type rssDoc struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          rssSelf   `xml:"atom:link"`
+	Generator     string    `xml:"generator"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssSelf is the atom:link RSS feeds borrow to say where they are served
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	Creator     string  `xml:"dc:creator"` // <author> has to be an email address
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+// RSS writes the feed as RSS 2.0. RSS has no edit time, so an edited entry only shows up
+// in the channel's lastBuildDate.
+func RSS(f Feed) ([]byte, error) {
+	description := f.Subtitle
+	if description == "" {
+		description = f.Title
+	}
+	doc := rssDoc{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   description,
+			LastBuildDate: rssTime(f.Updated),
+			Self:          rssSelf{Href: f.Self, Rel: "self", Type: "application/rss+xml"},
+			Generator:     generator,
+		},
+	}
+	for _, e := range f.Entries {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       e.Title,
+			Link:        e.Link,
+			GUID:        rssGUID{IsPermaLink: true, ID: e.Link},
+			Creator:     e.Author,
+			PubDate:     rssTime(e.Published),
+			Description: textToHTML(e.Content),
+		})
+	}
+	return encode(doc)
+}
+
+func (e Entry) updated() time.Time {
+	if e.Updated.IsZero() {
+		return e.Published
+	}
+	return e.Updated
+}
+
+func encode(doc any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func rssTime(t time.Time) string {
+	return t.UTC().Format(time.RFC1123Z)
+}
+
+// textToHTML keeps the line breaks of a plain text body, readers show RSS descriptions as HTML
+func textToHTML(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>\n")
+}
@@ -0,0 +1,100 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	created = time.Date(2026, 3, 2, 9, 30, 0, 0, time.UTC)
+	edited  = created.Add(time.Hour)
+)
+
+var feed = Feed{
+	Title:   "Golang",
+	Link:    "http://localhost:3000/topics/1",
+	Self:    "http://localhost:8080/topics/1/feed.atom",
+	Updated: edited,
+	Entries: []Entry{
+		{Title: "Channels", Link: "http://localhost:3000/posts/2", Author: "alice", Content: "a < b\nright?", Published: created, Updated: edited},
+		{Title: "Generics", Link: "http://localhost:3000/posts/1", Author: "bob", Content: "hi", Published: created},
+	},
+}
+
+func TestAtom(t *testing.T) {
+	out, err := Atom(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		ID      string `xml:"id"`
+		Updated string `xml:"updated"`
+		Links   []struct {
+			Rel  string `xml:"rel,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"link"`
+		Entries []struct {
+			ID        string `xml:"id"`
+			Author    string `xml:"author>name"`
+			Published string `xml:"published"`
+			Updated   string `xml:"updated"`
+			Content   string `xml:"content"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(out, &got); err != nil {
+		t.Fatalf("%v in\n%s", err, out)
+	}
+	if got.ID != feed.Self || got.Updated != "2026-03-02T10:30:00Z" || len(got.Links) != 2 || got.Links[0].Rel != "self" {
+		t.Errorf("feed %+v", got)
+	}
+	if len(got.Entries) != 2 {
+		t.Fatalf("%d entries", len(got.Entries))
+	}
+	first, second := got.Entries[0], got.Entries[1]
+	if first.ID != feed.Entries[0].Link || first.Author != "alice" || first.Content != "a < b\nright?" ||
+		first.Published != "2026-03-02T09:30:00Z" || first.Updated != "2026-03-02T10:30:00Z" {
+		t.Errorf("first entry %+v", first)
+	}
+	// never edited, so updated is when it was published
+	if second.Updated != second.Published {
+		t.Errorf("second entry %+v", second)
+	}
+}
+
+func TestRSS(t *testing.T) {
+	out, err := RSS(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `<atom:link href="`+feed.Self+`" rel="self"`) || !strings.Contains(string(out), "<dc:creator>alice</dc:creator>") {
+		t.Errorf("namespaced elements missing in\n%s", out)
+	}
+	var got struct {
+		Version string `xml:"version,attr"`
+		Channel struct {
+			Description   string `xml:"description"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				GUID        string `xml:"guid"`
+				PubDate     string `xml:"pubDate"`
+				Description string `xml:"description"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(out, &got); err != nil {
+		t.Fatalf("%v in\n%s", err, out)
+	}
+	if got.Version != "2.0" || got.Channel.Description != "Golang" || got.Channel.LastBuildDate != "Mon, 02 Mar 2026 10:30:00 +0000" {
+		t.Errorf("channel %+v", got.Channel)
+	}
+	if len(got.Channel.Items) != 2 {
+		t.Fatalf("%d items", len(got.Channel.Items))
+	}
+	// the description is HTML, so the text is escaped once more and keeps its line breaks
+	if item := got.Channel.Items[0]; item.GUID != feed.Entries[0].Link || item.PubDate != "Mon, 02 Mar 2026 09:30:00 +0000" ||
+		item.Description != "a &lt; b<br>\nright?" {
+		t.Errorf("item %+v", item)
+	}
+}
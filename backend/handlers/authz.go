@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// Roles live on the user (see store.RoleMember and friends). Moderators only have extra powers
+// in the topics they are assigned to, admins can do anything.
+func validRole(role string) bool {
+	return role == store.RoleMember || role == store.RoleModerator || role == store.RoleAdmin
+}
+
+// isTopicModerator checks if the user is a moderator assigned to this topic
+func (s *Server) isTopicModerator(ctx context.Context, user store.User, topicID int) (bool, error) {
+	if user.Role != store.RoleModerator {
+		return false, nil
+	}
+	return s.topics.IsTopicModerator(ctx, topicID, user.ID)
+}
+
+// canEdit: only the author or an admin can change content
+func canEdit(user store.User, authorID int) bool {
+	return user.Role == store.RoleAdmin || user.ID == authorID
+}
+
+// canModerate: the author, an admin, or a moderator of the topic the content is in can remove it
+func (s *Server) canModerate(ctx context.Context, user store.User, authorID, topicID int) (bool, error) {
+	if canEdit(user, authorID) {
+		return true, nil
+	}
+	return s.isTopicModerator(ctx, user, topicID)
+}
+
+// requireAdmin is like requireUser but the user also needs the admin role
+func requireAdmin(w http.ResponseWriter, r *http.Request) (store.User, bool) {
+	user, ok := requireUser(w, r)
+	if !ok {
+		return user, false
+	}
+	if user.Role != store.RoleAdmin {
+		WriteError(w, r, forbidden("Only admins can do that"))
+		return user, false
+	}
+	return user, true
+}
+
+// topicAuthor looks up who created a topic, writes the 404/500 itself if it can't
+func (s *Server) topicAuthor(w http.ResponseWriter, r *http.Request, topicID int) (int, bool) {
+	topic, err := s.topics.GetTopic(r.Context(), topicID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(w, r, notFound("topic"))
+		return 0, false
+	} else if err != nil {
+		serverError(w, r, "DB error checking topic", err)
+		return 0, false
+	}
+	return topic.CreatedBy, true
+}
+
+// postAuthor looks up who created a post and which topic it is in
+func (s *Server) postAuthor(w http.ResponseWriter, r *http.Request, postID int) (authorID, topicID int, ok bool) {
+	post, err := s.posts.GetPost(r.Context(), postID, 0)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(w, r, notFound("post"))
+		return 0, 0, false
+	} else if err != nil {
+		serverError(w, r, "DB error checking post", err)
+		return 0, 0, false
+	}
+	return post.CreatedBy, post.TopicID, true
+}
+
+// commentAuthor looks up who wrote a comment, which post it is on and which topic that post is in
+func (s *Server) commentAuthor(w http.ResponseWriter, r *http.Request, commentID int) (authorID, postID, topicID int, ok bool) {
+	comment, err := s.comments.GetComment(r.Context(), commentID, 0)
+	if err == nil {
+		var post store.Post
+		post, err = s.posts.GetPost(r.Context(), comment.PostID, 0)
+		topicID = post.TopicID
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(w, r, notFound("comment"))
+		return 0, 0, 0, false
+	} else if err != nil {
+		serverError(w, r, "DB error checking comment", err)
+		return 0, 0, 0, false
+	}
+	return comment.CreatedBy, comment.PostID, topicID, true
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/auth"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func TestAuthorization(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mux.HandleFunc("PUT /topics/{id}", ts.UpdateTopic)
+	ts.mux.HandleFunc("DELETE /topics/{id}", ts.DeleteTopic)
+	ts.mux.HandleFunc("PUT /posts/{id}", ts.UpdatePost)
+	ts.mux.HandleFunc("DELETE /posts/{id}", ts.DeletePost)
+
+	ctx := context.Background()
+	admin := ts.user("admin")
+	author := ts.user("author")
+	other := ts.user("other")
+	mod := ts.user("mod")
+	mod, err := ts.st.SetRole(ctx, mod.ID, store.RoleModerator)
+	ts.check(err)
+
+	const (
+		topicEdit = `{"title": "Renamed", "description": "new"}`
+		postEdit  = `{"title": "Renamed", "body": "new"}`
+	)
+	tests := []struct {
+		name    string
+		user    store.User
+		method  string
+		onPost  bool
+		body    string
+		want    int
+		message string
+	}{
+		{"author edits topic", author, http.MethodPut, false, topicEdit, http.StatusOK, ""},
+		{"admin edits topic", admin, http.MethodPut, false, topicEdit, http.StatusOK, ""},
+		{"other edits topic", other, http.MethodPut, false, topicEdit, http.StatusForbidden, "Only the author of this topic or an admin can edit it"},
+		{"moderator edits topic", mod, http.MethodPut, false, topicEdit, http.StatusForbidden, "Only the author of this topic or an admin can edit it"},
+		{"logged out edits topic", store.User{}, http.MethodPut, false, topicEdit, http.StatusUnauthorized, ""},
+		{"author deletes topic", author, http.MethodDelete, false, "", http.StatusNoContent, ""},
+		{"admin deletes topic", admin, http.MethodDelete, false, "", http.StatusNoContent, ""},
+		{"other deletes topic", other, http.MethodDelete, false, "", http.StatusForbidden, "Only the author of this topic or an admin can delete it"},
+		{"moderator deletes topic", mod, http.MethodDelete, false, "", http.StatusForbidden, "Only the author of this topic or an admin can delete it"},
+
+		{"author edits post", author, http.MethodPut, true, postEdit, http.StatusOK, ""},
+		{"admin edits post", admin, http.MethodPut, true, postEdit, http.StatusOK, ""},
+		{"other edits post", other, http.MethodPut, true, postEdit, http.StatusForbidden, "Only the author of this post or an admin can edit it"},
+		{"moderator edits post", mod, http.MethodPut, true, postEdit, http.StatusForbidden, "Only the author of this post or an admin can edit it"},
+		{"author deletes post", author, http.MethodDelete, true, "", http.StatusNoContent, ""},
+		{"admin deletes post", admin, http.MethodDelete, true, "", http.StatusNoContent, ""},
+		{"moderator deletes post", mod, http.MethodDelete, true, "", http.StatusNoContent, ""},
+		{"other deletes post", other, http.MethodDelete, true, "", http.StatusForbidden, "Only the author of this post, a moderator of this topic or an admin can delete it"},
+		{"logged out deletes post", store.User{}, http.MethodDelete, true, "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// new content every time, so the deletes don't take it away from the next case
+			topic := ts.topic("Golang", author)
+			ts.check(ts.st.AddTopicModerator(ctx, topic.ID, mod.ID))
+			path := "/topics/" + strconv.Itoa(topic.ID)
+			if tt.onPost {
+				path = "/posts/" + strconv.Itoa(ts.post(topic, "Channels", "body", author).ID)
+			}
+
+			rec := ts.send(tt.user, tt.method, path, tt.body)
+			if rec.Code != tt.want {
+				t.Fatalf("got %d %s, want %d", rec.Code, rec.Body, tt.want)
+			}
+			if tt.message != "" {
+				got := decode[errorResponse](t, rec)
+				if got.Error.Code != "forbidden" || got.Error.Message != tt.message {
+					t.Errorf("got %+v, want forbidden with %q", got.Error, tt.message)
+				}
+			}
+		})
+	}
+
+	// a moderator of another topic is just a member here
+	topic := ts.topic("Rust", author)
+	post := ts.post(topic, "Ownership", "body", author)
+	if rec := ts.send(mod, http.MethodDelete, "/posts/"+strconv.Itoa(post.ID), ""); rec.Code != http.StatusForbidden {
+		t.Errorf("moderator of another topic got %d", rec.Code)
+	}
+}
+
+func TestFirstUserIsAdmin(t *testing.T) {
+	auth.InitSessions(strings.Repeat("k", 32))
+	ts := newTestServer(t)
+	ts.mux.HandleFunc("POST /register", ts.Register)
+
+	for i, want := range []string{store.RoleAdmin, store.RoleMember, store.RoleMember} {
+		rec := ts.send(store.User{}, http.MethodPost, "/register", `{"username": "user`+strconv.Itoa(i)+`", "password": "correct horse"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("register got %d %s", rec.Code, rec.Body)
+		}
+		if got := decode[sessionResponse](t, rec); got.User.Role != want {
+			t.Errorf("user %d got role %q, want %q", i, got.User.Role, want)
+		}
+	}
+
+	if rec := ts.send(store.User{}, http.MethodPost, "/register", `{"username": "user0", "password": "correct horse"}`); rec.Code != http.StatusConflict {
+		t.Errorf("taken username got %d %s", rec.Code, rec.Body)
+	}
+}
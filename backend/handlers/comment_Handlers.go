@@ -1,176 +1,317 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
-	"time"
 
-	"github.com/archonward/CampusCommons/backend/database"
+	"github.com/archonward/CampusCommons/backend/events"
+	"github.com/archonward/CampusCommons/backend/metrics"
+	"github.com/archonward/CampusCommons/backend/store"
 )
 
-// Comment represents a forum comment
-type Comment struct {
-	ID        int       `json:"id"`
-	PostID    int       `json:"post_id"`
-	Body      string    `json:"body"`
-	CreatedBy int       `json:"created_by"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// this func handles GET /posts/{id}/comments
-func GetCommentsByPost(writer http.ResponseWriter, request *http.Request) {
+// this func handles GET /posts/{id}/comments, paginated with ?limit= and ?cursor= over the top level comments
+func (s *Server) GetCommentsByPost(writer http.ResponseWriter, request *http.Request) {
 	writer.Header().Set("Content-Type", "application/json")
 
 	postIDStr := request.PathValue("id")
 	if postIDStr == "" {
-		http.Error(writer, "Post ID is required", http.StatusBadRequest)  // if no ID in the path
+		WriteError(writer, request, invalidID("post"))  // if no ID in the path
 		return
 	}
 
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil || postID <= 0 {
-		http.Error(writer, "Invalid post ID", http.StatusBadRequest)
+		WriteError(writer, request, invalidID("post"))
 		return
 	}
 
 	// Check if post exists in database
-	var exists bool
-	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM posts WHERE id = ?)", postID).Scan(&exists)
-	if err != nil {
-		log.Printf("Error checking post existence: %v", err)
-		http.Error(writer, "Database error", http.StatusInternalServerError)
+	_, err = s.posts.GetPost(request.Context(), postID, 0)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("post"))
 		return
-	}
-	if !exists {
-		http.Error(writer, "Post not found", http.StatusNotFound)
+	} else if err != nil {
+		serverError(writer, request, "Error checking post existence", err)
 		return
 	}
 
-	// Fetch all comments that is under this post, from oldest to the latest
-	rows, err := database.DB.Query(`
-		SELECT id, post_id, body, created_by, created_at
-		FROM comments
-		WHERE post_id = ?
-		ORDER BY created_at ASC
-	`, postID)
-
-	if err != nil {		//if query fails
-		log.Printf("Failed to fetch comments: %v", err)
-		http.Error(writer, "Failed to fetch comments", http.StatusInternalServerError)
+	// view=flat (the default) gives a list in thread order, view=tree nests replies inside their parent
+	query := request.URL.Query()
+	view := query.Get("view")
+	if view == "" {
+		view = "flat"
+	}
+	if view != "flat" && view != "tree" {
+		WriteError(writer, request, invalidField("view", "view must be flat or tree"))
 		return
 	}
-	
-	//close rows when we're done to avoid leaking DB resources
-	defer rows.Close()
 
-	//var comments []Comment
-	comments := []Comment{} // special fix, so that backend does not return null when there are no comments
-	for rows.Next() {	// loop through every row once
-		var c Comment
-		// copy row columns into Comment struct fields
-		err := rows.Scan(&c.ID, &c.PostID, &c.Body, &c.CreatedBy, &c.CreatedAt)
-		if err != nil {
-			log.Printf("Row scan error: %v", err)
-			http.Error(writer, "Data parsing error", http.StatusInternalServerError)
+	// how many levels of replies to load below the starting comments
+	maxDepth := defaultThreadDepth
+	if depthStr := query.Get("max_depth"); depthStr != "" {
+		maxDepth, err = strconv.Atoi(depthStr)
+		if err != nil || maxDepth < 0 || maxDepth > maxThreadDepth {
+			WriteError(writer, request, invalidField("max_depth", "max_depth must be between 0 and 10"))
 			return
 		}
-		comments = append(comments, c)	// append the comment to the list
 	}
 
-	//check for any errors during iteration
-	if err = rows.Err(); err != nil {
-		log.Printf("Rows iteration error: %v", err)
-		http.Error(writer, "Data retrieval error", http.StatusInternalServerError)
+	// parent_id is the "load more replies" case, it starts from the replies of that comment
+	var parentID *int
+	if parentStr := query.Get("parent_id"); parentStr != "" {
+		id, err := strconv.Atoi(parentStr)
+		if err != nil || id <= 0 {
+			WriteError(writer, request, invalidField("parent_id", "parent_id must be a positive comment ID"))
+			return
+		}
+		if ok := s.checkParentComment(writer, request, id, postID); !ok {
+			return
+		}
+		parentID = &id
+	}
+
+	// pages go by the comments the thread starts from, each one comes with its replies
+	p, ok := parsePage(writer, request, store.SortOld)
+	if !ok {
 		return
 	}
 
-	json.NewEncoder(writer).Encode(comments)	// send back as JSON
+	thread, err := s.comments.Thread(request.Context(), postID, parentID, maxDepth, p, viewerID(request))
+	if err != nil {
+		serverError(writer, request, "Failed to fetch comments", err)
+		return
+	}
+
+	if view == "tree" {
+		thread.Items = buildTree(thread.Items)
+	}
+
+	// send back as JSON
+	json.NewEncoder(writer).Encode(newListResponse(store.SortOld, thread))
+}
+
+// checkParentComment makes sure a parent comment exists and is on the same post, writes the error itself if not
+func (s *Server) checkParentComment(writer http.ResponseWriter, request *http.Request, parentID, postID int) bool {
+	parent, err := s.comments.GetComment(request.Context(), parentID, 0)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, invalidField("parent_id", "Parent comment not found"))
+		return false
+	} else if err != nil {
+		serverError(writer, request, "Error checking parent comment", err)
+		return false
+	}
+	if parent.PostID != postID {
+		WriteError(writer, request, invalidField("parent_id", "Parent comment belongs to a different post"))
+		return false
+	}
+	return true
 }
 
 // CreateComment handles POST /posts/{id}/comments
-func CreateComment(writer http.ResponseWriter, request *http.Request) {
+func (s *Server) CreateComment(writer http.ResponseWriter, request *http.Request) {
 	writer.Header().Set("Content-Type", "application/json")
 
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
 	postIDStr := request.PathValue("id")
 	if postIDStr == "" {
-		http.Error(writer, "Post ID is required", http.StatusBadRequest)
+		WriteError(writer, request, invalidID("post"))
 		return
 	}
 
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil || postID <= 0 {
-		http.Error(writer, "Invalid post ID", http.StatusBadRequest)
+		WriteError(writer, request, invalidID("post"))
 		return
 	}
 
 	// validate post exists before allowing comments to be created
-	var exists bool
-	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM posts WHERE id = ?)", postID).Scan(&exists)
-	if err != nil {
-		log.Printf("Error checking post existence: %v", err)
-		http.Error(writer, "Database error", http.StatusInternalServerError)
+	post, err := s.posts.GetPost(request.Context(), postID, 0)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("post"))
 		return
-	}
-	if !exists {
-		http.Error(writer, "Post not found", http.StatusNotFound)
+	} else if err != nil {
+		serverError(writer, request, "Error checking post existence", err)
 		return
 	}
 
-	//JSON body shape for creating a comment
+	//JSON body shape for creating a comment, created_by is optional since the author comes from the session
 	var input struct {
 		Body      string `json:"body"`
+		ParentID  *int   `json:"parent_id"` // set when replying to another comment
 		CreatedBy int    `json:"created_by"`
 	}
 
 	// Decode JSON request body into input struct
 	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {
 		log.Printf("Invalid JSON: %v", err)
-		http.Error(writer, "Invalid JSON payload", http.StatusBadRequest)
+		WriteError(writer, request, errInvalidJSON)
 		return
 	}
 
 	if input.Body == "" {
-		http.Error(writer, "Comment body is required", http.StatusBadRequest)
+		WriteError(writer, request, invalidField("body", "Comment body is required"))
+		return
+	}
+	if !checkCreatedBy(writer, request, input.CreatedBy, user) {
+		return
+	}
+	if input.ParentID != nil && !s.checkParentComment(writer, request, *input.ParentID, postID) {
 		return
 	}
-	if input.CreatedBy <= 0 {
-		http.Error(writer, "Valid created_by user ID is required", http.StatusBadRequest)
+
+	comment, err := s.comments.CreateComment(request.Context(), postID, input.ParentID, input.Body, user.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("post"))
+		return
+	} else if err != nil {
+		serverError(writer, request, "Failed to create comment", err)
 		return
 	}
 
-	result, err := database.DB.Exec(`
-		INSERT INTO comments (post_id, body, created_by)
-		VALUES (?, ?, ?)
-	`, postID, input.Body, input.CreatedBy)
+	metrics.CommentsCreated.Inc()
+	notifyAbout(request, "comment", s.notifier.CommentCreated(context.WithoutCancel(request.Context()), post, comment))
+	s.publishComment("comment.created", comment)
+	writer.WriteHeader(http.StatusCreated)	// return 201 Created
+	json.NewEncoder(writer).Encode(comment)
+}
 
-	if err != nil {
-		log.Printf("Failed to create comment: %v", err)
-		http.Error(writer, "Failed to create comment", http.StatusInternalServerError)
+
+// UpdateComment handles PUT /comments/{id}, only the author can edit and the old body is kept as a revision
+func (s *Server) UpdateComment(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	commentID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || commentID <= 0 {
+		WriteError(writer, request, invalidID("comment"))
 		return
 	}
 
-	commentID, err := result.LastInsertId()
-	if err != nil {
-		log.Printf("Failed to get comment ID: %v", err)
-		http.Error(writer, "Failed to retrieve comment ID", http.StatusInternalServerError)
+	user, ok := requireUser(writer, request)
+	if !ok {
 		return
 	}
 
-	//fetch the newly created comment 
-	var comment Comment
-	err = database.DB.QueryRow(`SELECT id, post_id, body, created_by, created_at
-		FROM comments
-		WHERE id = ?`, commentID).Scan(&comment.ID, &comment.PostID, &comment.Body, &comment.CreatedBy, &comment.CreatedAt)
+	authorID, _, _, ok := s.commentAuthor(writer, request, commentID)
+	if !ok {
+		return
+	}
+	if user.ID != authorID {
+		WriteError(writer, request, forbidden("Only the author of this comment can edit it"))
+		return
+	}
 
-	if err != nil {
-		log.Printf("Failed to fetch created comment: %v", err)
-		http.Error(writer, "Failed to retrieve created comment", http.StatusInternalServerError)
+	var input struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {
+		WriteError(writer, request, errInvalidJSON)
+		return
+	}
+	if input.Body == "" {
+		WriteError(writer, request, invalidField("body", "Comment body is required"))
 		return
 	}
 
-	writer.WriteHeader(http.StatusCreated)	// return 201 Created
+	// the store keeps the old body as a revision
+	comment, err := s.comments.UpdateComment(request.Context(), commentID, input.Body, user.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("comment"))
+		return
+	} else if err != nil {
+		serverError(writer, request, "Failed to update comment", err)
+		return
+	}
+	s.publishComment("comment.updated", comment)
+
 	json.NewEncoder(writer).Encode(comment)
 }
 
+// DeleteComment handles DELETE /comments/{id}, the author, a moderator of the topic or an admin can remove it.
+// Replies to the comment are deleted with it.
+func (s *Server) DeleteComment(writer http.ResponseWriter, request *http.Request) {
+	commentID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || commentID <= 0 {
+		WriteError(writer, request, invalidID("comment"))
+		return
+	}
+
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
+	authorID, postID, topicID, ok := s.commentAuthor(writer, request, commentID)
+	if !ok {
+		return
+	}
+	allowed, err := s.canModerate(request.Context(), user, authorID, topicID)
+	if err != nil {
+		serverError(writer, request, "Failed to check moderator", err)
+		return
+	}
+	if !allowed {
+		WriteError(writer, request, forbidden("Only the author of this comment, a moderator of this topic or an admin can delete it"))
+		return
+	}
+
+	// this takes the whole subtree with it, along with the revisions and votes of every comment in it
+	err = s.comments.DeleteComment(request.Context(), commentID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("comment"))
+		return
+	} else if err != nil {
+		serverError(writer, request, "Failed to delete comment", err)
+		return
+	}
+	// its replies went with it, clients drop the whole subtree
+	s.events.Publish(events.PostChannel(postID), "comment.deleted", map[string]int{"id": commentID, "post_id": postID})
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// GetCommentRevisions handles GET /comments/{id}/revisions, newest first.
+// Moderators of the topic and admins can see them (and the author, it's their own text anyway).
+func (s *Server) GetCommentRevisions(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	commentID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || commentID <= 0 {
+		WriteError(writer, request, invalidID("comment"))
+		return
+	}
+
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
+	authorID, _, topicID, ok := s.commentAuthor(writer, request, commentID)
+	if !ok {
+		return
+	}
+	allowed, err := s.canModerate(request.Context(), user, authorID, topicID)
+	if err != nil {
+		serverError(writer, request, "Failed to check moderator", err)
+		return
+	}
+	if !allowed {
+		WriteError(writer, request, forbidden("Only moderators of this topic and admins can see the edit history"))
+		return
+	}
+
+	revisions, err := s.comments.CommentRevisions(request.Context(), commentID)
+	if err != nil {
+		serverError(writer, request, "Failed to fetch comment revisions", err)
+		return
+	}
+
+	json.NewEncoder(writer).Encode(revisions)
+}
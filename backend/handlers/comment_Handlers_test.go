@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func TestCommentEdits(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mux.HandleFunc("PUT /comments/{id}", ts.UpdateComment)
+	ts.mux.HandleFunc("DELETE /comments/{id}", ts.DeleteComment)
+	ts.mux.HandleFunc("GET /comments/{id}/revisions", ts.GetCommentRevisions)
+
+	ctx := context.Background()
+	admin := ts.user("admin")
+	alice := ts.user("alice")
+	bob := ts.user("bob")
+	mod := ts.user("mod")
+	_, err := ts.st.SetRole(ctx, mod.ID, store.RoleModerator)
+	ts.check(err)
+	mod.Role = store.RoleModerator
+	topic := ts.topic("Golang", admin)
+	ts.check(ts.st.AddTopicModerator(ctx, topic.ID, mod.ID))
+	post := ts.post(topic, "Channels", "body", admin)
+	comment := ts.comment(post, nil, "frist", alice)
+	path := "/comments/" + strconv.Itoa(comment.ID)
+
+	// only the author can edit, not even an admin
+	for _, tt := range []struct {
+		name string
+		user store.User
+		body string
+		want int
+	}{
+		{"logged out", store.User{}, `{"body": "x"}`, http.StatusUnauthorized},
+		{"someone else", bob, `{"body": "x"}`, http.StatusForbidden},
+		{"moderator", mod, `{"body": "x"}`, http.StatusForbidden},
+		{"admin", admin, `{"body": "x"}`, http.StatusForbidden},
+		{"no body", alice, `{"body": ""}`, http.StatusBadRequest},
+		{"not JSON", alice, `{"body"`, http.StatusBadRequest},
+	} {
+		if rec := ts.send(tt.user, http.MethodPut, path, tt.body); rec.Code != tt.want {
+			t.Errorf("%s: got %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+	if rec := ts.send(alice, http.MethodPut, "/comments/999", `{"body": "x"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("missing comment got %d", rec.Code)
+	}
+
+	// two edits leave two revisions, newest first
+	for _, body := range []string{"first", "first!"} {
+		rec := ts.send(alice, http.MethodPut, path, `{"body": "`+body+`"}`)
+		if got := decode[store.Comment](t, rec); rec.Code != http.StatusOK || got.Body != body || got.EditedAt == nil {
+			t.Fatalf("edit got %d %+v", rec.Code, got)
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		user store.User
+		want int
+	}{
+		{"author", alice, http.StatusOK},
+		{"moderator", mod, http.StatusOK},
+		{"admin", admin, http.StatusOK},
+		{"someone else", bob, http.StatusForbidden},
+		{"logged out", store.User{}, http.StatusUnauthorized},
+	} {
+		rec := ts.send(tt.user, http.MethodGet, path+"/revisions", "")
+		if rec.Code != tt.want {
+			t.Errorf("revisions as %s: got %d, want %d", tt.name, rec.Code, tt.want)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		revisions := decode[[]store.CommentRevision](t, rec)
+		if len(revisions) != 2 || revisions[0].Body != "first" || revisions[1].Body != "frist" || revisions[0].EditedBy != alice.ID {
+			t.Errorf("revisions as %s: %+v", tt.name, revisions)
+		}
+	}
+
+	// a moderator can remove what they can't edit, the revisions go with it
+	if rec := ts.send(bob, http.MethodDelete, path, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("delete by someone else got %d", rec.Code)
+	}
+	if rec := ts.send(mod, http.MethodDelete, path, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete by the moderator got %d %s", rec.Code, rec.Body)
+	}
+	if rec := ts.send(alice, http.MethodGet, path+"/revisions", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("revisions of a deleted comment got %d", rec.Code)
+	}
+}
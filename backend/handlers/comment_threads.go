@@ -0,0 +1,26 @@
+package handlers
+
+import "github.com/archonward/CampusCommons/backend/store"
+
+// how many levels of replies GET /posts/{id}/comments loads by default, and at most
+const (
+	defaultThreadDepth = 3
+	maxThreadDepth     = 10
+)
+
+// buildTree nests a thread ordered list (from the comment store's Thread) under each comment's parent
+func buildTree(flat []*store.ThreadedComment) []*store.ThreadedComment {
+	roots := []*store.ThreadedComment{}
+	byID := make(map[int]*store.ThreadedComment, len(flat))
+	for _, tc := range flat {
+		byID[tc.ID] = tc
+		if tc.ParentID != nil {
+			if parent, ok := byID[*tc.ParentID]; ok {
+				parent.Replies = append(parent.Replies, tc)
+				continue
+			}
+		}
+		roots = append(roots, tc)
+	}
+	return roots
+}
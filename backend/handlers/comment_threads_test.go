@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func TestBuildTree(t *testing.T) {
+	tc := func(id int, parentID *int) *store.ThreadedComment {
+		return &store.ThreadedComment{Comment: store.Comment{ID: id, ParentID: parentID}}
+	}
+	one, two, missing := 1, 2, 99
+	// in thread order, 4 is a reply to a comment that isn't in the list so it becomes a root
+	roots := buildTree([]*store.ThreadedComment{tc(1, nil), tc(2, &one), tc(3, &two), tc(5, &one), tc(4, &missing), tc(6, nil)})
+
+	if len(roots) != 3 || roots[0].ID != 1 || roots[1].ID != 4 || roots[2].ID != 6 {
+		t.Fatalf("got roots %v", ids(roots))
+	}
+	if got := ids(roots[0].Replies); len(got) != 2 || got[0] != 2 || got[1] != 5 {
+		t.Errorf("replies of 1 are %v", got)
+	}
+	if got := ids(roots[0].Replies[0].Replies); len(got) != 1 || got[0] != 3 {
+		t.Errorf("replies of 2 are %v", got)
+	}
+	if roots[2].Replies != nil {
+		t.Errorf("6 has replies %v", ids(roots[2].Replies))
+	}
+
+	if roots := buildTree(nil); roots == nil || len(roots) != 0 {
+		t.Errorf("no comments gave %v, want an empty list", roots)
+	}
+}
+
+func ids(comments []*store.ThreadedComment) []int {
+	out := []int{}
+	for _, c := range comments {
+		out = append(out, c.ID)
+	}
+	return out
+}
+
+func TestCommentThreads(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mux.HandleFunc("GET /posts/{id}/comments", ts.GetCommentsByPost)
+	ts.mux.HandleFunc("POST /posts/{id}/comments", ts.CreateComment)
+
+	alice := ts.user("alice")
+	topic := ts.topic("Golang", alice)
+	post := ts.post(topic, "Channels", "body", alice)
+	other := ts.post(topic, "Generics", "body", alice)
+	elsewhere := ts.comment(other, nil, "off topic", alice)
+
+	// a chain 12 levels deep under root, deeper than max_depth can reach
+	root := ts.comment(post, nil, "root", alice)
+	chain := []store.Comment{root}
+	for i := 0; i < 12; i++ {
+		chain = append(chain, ts.comment(post, &chain[len(chain)-1].ID, "reply", alice))
+	}
+	path := "/posts/" + strconv.Itoa(post.ID) + "/comments"
+
+	t.Run("flat", func(t *testing.T) {
+		for _, tt := range []struct {
+			query string
+			want  int // comments in the response
+		}{
+			{"", defaultThreadDepth + 1},
+			{"?max_depth=0", 1},
+			{"?max_depth=10", 11},
+			{"?parent_id=" + strconv.Itoa(chain[3].ID), defaultThreadDepth + 1},
+		} {
+			rec := ts.send(alice, http.MethodGet, path+tt.query, "")
+			got := decode[listResponse[*store.ThreadedComment]](t, rec)
+			if rec.Code != http.StatusOK || len(got.Items) != tt.want {
+				t.Errorf("%q: got %d with %d comments, want %d", tt.query, rec.Code, len(got.Items), tt.want)
+				continue
+			}
+			last := got.Items[len(got.Items)-1]
+			if !last.HasMoreReplies || last.ReplyCount != 1 {
+				t.Errorf("%q: the deepest comment says %d replies, more %v", tt.query, last.ReplyCount, last.HasMoreReplies)
+			}
+		}
+
+		// depth and path stay absolute when loading more replies
+		rec := ts.send(alice, http.MethodGet, path+"?max_depth=0&parent_id="+strconv.Itoa(chain[3].ID), "")
+		got := decode[listResponse[*store.ThreadedComment]](t, rec)
+		if len(got.Items) != 1 || got.Items[0].ID != chain[4].ID || got.Items[0].Depth != 4 || len(got.Items[0].Path) != 5 {
+			t.Errorf("more replies got %+v", got.Items)
+		}
+	})
+
+	t.Run("tree", func(t *testing.T) {
+		rec := ts.send(alice, http.MethodGet, path+"?view=tree&max_depth=2", "")
+		got := decode[listResponse[*store.ThreadedComment]](t, rec)
+		if rec.Code != http.StatusOK || len(got.Items) != 1 || got.Items[0].ID != root.ID {
+			t.Fatalf("got %d %s", rec.Code, rec.Body)
+		}
+		level := got.Items[0]
+		for depth := 1; depth <= 2; depth++ {
+			if len(level.Replies) != 1 || level.Replies[0].ID != chain[depth].ID {
+				t.Fatalf("depth %d got %v", depth, ids(level.Replies))
+			}
+			level = level.Replies[0]
+		}
+		if level.Replies != nil || !level.HasMoreReplies {
+			t.Errorf("the tree goes past max_depth: %v", ids(level.Replies))
+		}
+	})
+
+	t.Run("bad query", func(t *testing.T) {
+		for _, tt := range []struct {
+			query, field, message string
+		}{
+			{"?view=nested", "view", "view must be flat or tree"},
+			{"?max_depth=-1", "max_depth", "max_depth must be between 0 and 10"},
+			{"?max_depth=11", "max_depth", "max_depth must be between 0 and 10"},
+			{"?max_depth=x", "max_depth", "max_depth must be between 0 and 10"},
+			{"?parent_id=0", "parent_id", "parent_id must be a positive comment ID"},
+			{"?parent_id=x", "parent_id", "parent_id must be a positive comment ID"},
+			{"?parent_id=999", "parent_id", "Parent comment not found"},
+			{"?parent_id=" + strconv.Itoa(elsewhere.ID), "parent_id", "Parent comment belongs to a different post"},
+		} {
+			rec := ts.send(alice, http.MethodGet, path+tt.query, "")
+			got := decode[errorResponse](t, rec)
+			want := []FieldError{{Field: tt.field, Message: tt.message}}
+			if rec.Code != http.StatusBadRequest || !slices.Equal(got.Error.Details, want) {
+				t.Errorf("%q: got %d %s, want %s: %s", tt.query, rec.Code, rec.Body, tt.field, tt.message)
+			}
+		}
+	})
+
+	t.Run("replies", func(t *testing.T) {
+		rec := ts.send(alice, http.MethodPost, path, `{"body": "me too", "parent_id": `+strconv.Itoa(root.ID)+`}`)
+		if got := decode[store.Comment](t, rec); rec.Code != http.StatusCreated || got.ParentID == nil || *got.ParentID != root.ID {
+			t.Errorf("reply got %d %s", rec.Code, rec.Body)
+		}
+		for _, parentID := range []int{999, elsewhere.ID} {
+			rec := ts.send(alice, http.MethodPost, path, `{"body": "me too", "parent_id": `+strconv.Itoa(parentID)+`}`)
+			if got := decode[errorResponse](t, rec); rec.Code != http.StatusBadRequest || len(got.Error.Details) != 1 || got.Error.Details[0].Field != "parent_id" {
+				t.Errorf("reply to %d got %d %s", parentID, rec.Code, rec.Body)
+			}
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// APIError is what every error response carries, sent as {"error": {...}}.
+// Code is the stable part clients can switch on, Message is for people and may be reworded.
+type APIError struct {
+	Status    int          `json:"-"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+func (e APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// FieldError points at one bad field in the body, or one bad query parameter
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// the errors that don't need anything filled in
+var (
+	errInvalidJSON        = APIError{Status: http.StatusBadRequest, Code: "invalid_json", Message: "Request body is not valid JSON"}
+	errLoginRequired      = APIError{Status: http.StatusUnauthorized, Code: "unauthorized", Message: "You need to be logged in to do that"}
+	errInvalidCredentials = APIError{Status: http.StatusUnauthorized, Code: "invalid_credentials", Message: "Invalid username or password"}
+	errUsernameTaken      = APIError{Status: http.StatusConflict, Code: "username_taken", Message: "Username is already taken"}
+	errMethodNotAllowed   = APIError{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Message: "Method not allowed"}
+	errRouteNotFound      = APIError{Status: http.StatusNotFound, Code: "not_found", Message: "No such endpoint"}
+	errRateLimited        = APIError{Status: http.StatusTooManyRequests, Code: "rate_limited", Message: "Too many requests, wait a moment and try again"}
+	errBodyTooLarge       = APIError{Status: http.StatusRequestEntityTooLarge, Code: "body_too_large", Message: "Request body is too large"}
+	errInternal           = APIError{Status: http.StatusInternalServerError, Code: "internal_error", Message: "Something went wrong on our side"}
+
+	// ErrRegistrationClosed and ErrSearchDisabled are for main, when a feature is turned off in the config.
+	// Search also answers with ErrSearchDisabled if the store has no index after all.
+	ErrRegistrationClosed = APIError{Status: http.StatusForbidden, Code: "registration_closed", Message: "Registration is closed"}
+	ErrSearchDisabled     = APIError{Status: http.StatusServiceUnavailable, Code: "search_unavailable", Message: "Search is not available on this server"}
+)
+
+// notFound is the 404 for a resource, e.g. notFound("post") gives post_not_found
+func notFound(resource string) APIError {
+	return APIError{Status: http.StatusNotFound, Code: resource + "_not_found", Message: capitalize(resource) + " not found"}
+}
+
+// invalidID is the 400 for an {id} in the path that isn't a positive number
+func invalidID(resource string) APIError {
+	return APIError{Status: http.StatusBadRequest, Code: "invalid_id", Message: "Invalid " + resource + " ID"}
+}
+
+func forbidden(message string) APIError {
+	return APIError{Status: http.StatusForbidden, Code: "forbidden", Message: message}
+}
+
+// invalidFields is the 400 for input that parsed fine but isn't acceptable, one FieldError per problem
+func invalidFields(fields ...FieldError) APIError {
+	messages := make([]string, len(fields))
+	for i, f := range fields {
+		messages[i] = f.Message
+	}
+	return APIError{Status: http.StatusBadRequest, Code: "validation_failed", Message: strings.Join(messages, "; "), Details: fields}
+}
+
+// invalidField is invalidFields for a single field
+func invalidField(field, message string) APIError {
+	return invalidFields(FieldError{Field: field, Message: message})
+}
+
+// WriteError sends e as JSON, tagged with the request ID so a report can be matched to the logs
+func WriteError(w http.ResponseWriter, r *http.Request, e APIError) {
+	e.RequestID = RequestIDFrom(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(errorResponse{Error: e})
+}
+
+// serverError logs what actually went wrong and sends the client a plain 500, the details stay in the log
+func serverError(w http.ResponseWriter, r *http.Request, what string, err error) {
+	slog.ErrorContext(r.Context(), what, slog.String("error", err.Error()), slog.String("request_id", RequestIDFrom(r.Context())))
+	WriteError(w, r, errInternal)
+}
+
+// MethodNotAllowed is for the method switches in main
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, errMethodNotAllowed)
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// MuxErrors turns the plain text 404 and 405 that ServeMux sends for unknown routes and
+// wrong methods into the usual JSON errors. Routes that match are served untouched.
+func MuxErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		// the mux's own handler still decides between 404 and 405 (and sets Allow), only its body is replaced
+		mux.ServeHTTP(&muxErrorWriter{ResponseWriter: w, request: r}, r)
+	})
+}
+
+type muxErrorWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	wroteHeader bool
+	replaced    bool // the body is ours, drop whatever the mux writes
+}
+
+func (w *muxErrorWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	// the redirects to a path's canonical form go through as they are
+	if status < 400 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.replaced = true
+	e := errRouteNotFound
+	if status == http.StatusMethodNotAllowed {
+		e = errMethodNotAllowed
+	}
+	WriteError(w.ResponseWriter, w.request, e)
+}
+
+func (w *muxErrorWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
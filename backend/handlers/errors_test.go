@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteError(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		err    APIError
+		status int
+		want   string
+	}{
+		{"not found", notFound("post"), http.StatusNotFound,
+			`{"error":{"code":"post_not_found","message":"Post not found","request_id":"req-1"}}`},
+		{"invalid id", invalidID("comment"), http.StatusBadRequest,
+			`{"error":{"code":"invalid_id","message":"Invalid comment ID","request_id":"req-1"}}`},
+		{"forbidden", forbidden("Not yours"), http.StatusForbidden,
+			`{"error":{"code":"forbidden","message":"Not yours","request_id":"req-1"}}`},
+		{"one field", invalidField("title", "Title is required"), http.StatusBadRequest,
+			`{"error":{"code":"validation_failed","message":"Title is required","details":[{"field":"title","message":"Title is required"}],"request_id":"req-1"}}`},
+		{"two fields", invalidFields(FieldError{"title", "Title is required"}, FieldError{"body", "Body is too long"}), http.StatusBadRequest,
+			`{"error":{"code":"validation_failed","message":"Title is required; Body is too long","details":[{"field":"title","message":"Title is required"},{"field":"body","message":"Body is too long"}],"request_id":"req-1"}}`},
+		{"internal", errInternal, http.StatusInternalServerError,
+			`{"error":{"code":"internal_error","message":"Something went wrong on our side","request_id":"req-1"}}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), requestIDKey, "req-1"))
+			rec := httptest.NewRecorder()
+			WriteError(rec, r, tt.err)
+
+			if rec.Code != tt.status || rec.Header().Get("Content-Type") != "application/json" || rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Errorf("got %d with headers %v", rec.Code, rec.Header())
+			}
+			if got := rec.Body.String(); got != tt.want+"\n" {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+
+	// outside of RequestID there is no ID to send, and the status never goes into the body
+	rec := httptest.NewRecorder()
+	WriteError(rec, httptest.NewRequest(http.MethodGet, "/", nil), errLoginRequired)
+	var body map[string]map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || len(body["error"]) != 2 {
+		t.Errorf("got %d %s", rec.Code, rec.Body)
+	}
+
+	// APIError is an error too, for the code that passes it around as one
+	var err error = notFound("topic")
+	var apiErr APIError
+	if !errors.As(err, &apiErr) || err.Error() != "topic_not_found: Topic not found" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestMuxErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /topics", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("topics"))
+	})
+	mux.HandleFunc("GET /teapot", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "short and stout", http.StatusTeapot)
+	})
+	mux.HandleFunc("/posts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		MethodNotAllowed(w, r)
+	})
+	h := MuxErrors(mux)
+
+	for _, tt := range []struct {
+		name, method, path string
+		status             int
+		code               string // the error code, or the body for routes that match
+		allow              string
+	}{
+		{"route", http.MethodGet, "/topics", http.StatusOK, "topics", ""},
+		{"unknown route", http.MethodGet, "/nope", http.StatusNotFound, "not_found", ""},
+		{"wrong method", http.MethodDelete, "/topics", http.StatusMethodNotAllowed, "method_not_allowed", "GET, HEAD"},
+		// a handler's own errors are left alone
+		{"handler error", http.MethodGet, "/teapot", http.StatusTeapot, "short and stout\n", ""},
+		{"method switch", http.MethodPatch, "/posts/1", http.StatusMethodNotAllowed, "method_not_allowed", ""},
+		{"redirect", http.MethodGet, "/topics/../topics", http.StatusTemporaryRedirect, "", ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.status || rec.Header().Get("Allow") != tt.allow {
+				t.Fatalf("got %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+			}
+			switch {
+			case rec.Code >= 300 && rec.Code < 400:
+				if rec.Header().Get("Location") != "/topics" {
+					t.Errorf("redirected to %q", rec.Header().Get("Location"))
+				}
+			case rec.Header().Get("Content-Type") == "application/json":
+				if got := decode[errorResponse](t, rec); got.Error.Code != tt.code {
+					t.Errorf("got %s", rec.Body)
+				}
+			default:
+				if rec.Body.String() != tt.code {
+					t.Errorf("got %s", rec.Body)
+				}
+			}
+		})
+	}
+}
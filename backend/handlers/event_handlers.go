@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/events"
+	"github.com/archonward/CampusCommons/backend/metrics"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// how often an idle stream gets a comment line, so proxies and browsers don't give up on it.
+// A var so the tests don't have to wait 15 seconds.
+var heartbeatInterval = 15 * time.Second
+
+// how long EventSource waits before reconnecting, sent at the start of every stream
+const retryMillis = 3000
+
+var errShuttingDown = APIError{Status: http.StatusServiceUnavailable, Code: "shutting_down", Message: "The server is restarting, try again in a moment"}
+
+// CloseStreams ends every open event stream and WebSocket, main calls it when the server starts
+// shutting down. Streams never finish on their own, so without this the shutdown would wait out its
+// whole timeout. It returns once the WebSockets are closed, which the server doesn't wait for itself.
+func (s *Server) CloseStreams() {
+	s.socketsMu.Lock()
+	s.closing = true
+	s.socketsMu.Unlock()
+	s.events.Close()
+	s.sockets.Wait()
+}
+
+// openSocket counts a WebSocket about to be accepted, so CloseStreams waits for it. It is false
+// once the server is shutting down, the WaitGroup can't take more once CloseStreams waits on it.
+func (s *Server) openSocket() bool {
+	s.socketsMu.Lock()
+	defer s.socketsMu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.sockets.Add(1)
+	return true
+}
+
+// this func handles GET /posts/{id}/events, a stream of the post's comments being added, edited
+// and deleted, and of the post itself being edited or deleted
+func (s *Server) PostEvents(writer http.ResponseWriter, request *http.Request) {
+	postID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || postID <= 0 {
+		WriteError(writer, request, invalidID("post"))
+		return
+	}
+	_, topicID, ok := s.postAuthor(writer, request, postID)
+	if !ok {
+		return
+	}
+	// the stream also ends when the topic is deleted, which takes the post with it
+	s.streamEvents(writer, request, events.PostChannel(postID), events.TopicChannel(topicID))
+}
+
+// this func handles GET /topics/{id}/events, a stream of the posts in the topic being added, edited
+// and deleted, and of the topic itself being edited or deleted
+func (s *Server) TopicEvents(writer http.ResponseWriter, request *http.Request) {
+	topicID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || topicID <= 0 {
+		WriteError(writer, request, invalidID("topic"))
+		return
+	}
+	if _, ok := s.topicAuthor(writer, request, topicID); !ok {
+		return
+	}
+	s.streamEvents(writer, request, events.TopicChannel(topicID), "")
+}
+
+// streamEvents sends what gets published to channel as Server-Sent Events until the client goes
+// away, the channel or its parent ends or the server shuts down. Clients resume with the Last-Event-ID header,
+// which EventSource sends by itself on reconnect, or with ?last_event_id= after a page reload.
+func (s *Server) streamEvents(writer http.ResponseWriter, request *http.Request, channel, parent string) {
+	lastIDStr := request.Header.Get("Last-Event-ID")
+	if lastIDStr == "" {
+		lastIDStr = request.URL.Query().Get("last_event_id")
+	}
+	var lastID uint64
+	if lastIDStr != "" {
+		var err error
+		lastID, err = strconv.ParseUint(lastIDStr, 10, 64)
+		if err != nil {
+			WriteError(writer, request, invalidField("last_event_id", "Last-Event-ID must be the id of an event"))
+			return
+		}
+	}
+
+	sub, replay, ok := s.events.SubscribeWithin(channel, parent, lastID)
+	if !ok {
+		WriteError(writer, request, errShuttingDown)
+		return
+	}
+	defer sub.Close()
+
+	// the server's write timeout is for ordinary requests, a stream would be cut off after it
+	rc := http.NewResponseController(writer)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		serverError(writer, request, "Failed to start event stream", err)
+		return
+	}
+
+	metrics.EventStreams.Inc()
+	defer metrics.EventStreams.Dec()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("X-Accel-Buffering", "no") // nginx would otherwise hold the events back
+	writer.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(writer, "retry: %d\n\n", retryMillis)
+	for _, ev := range replay {
+		if !writeEvent(writer, ev) || ev.Last {
+			rc.Flush()
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			// the client went away
+			return
+		case ev, open := <-sub.C:
+			// closed means the hub dropped us for falling behind, or is shutting down.
+			// Either way the client reconnects and resumes from its last event.
+			if !open {
+				return
+			}
+			if ev.ID == 0 {
+				// presence and typing, which are only for the WebSocket gateway
+				continue
+			}
+			if !writeEvent(writer, ev) || rc.Flush() != nil || ev.Last {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(writer, ": ping\n\n"); err != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes one event in the text/event-stream format, false if the client is gone
+func writeEvent(writer http.ResponseWriter, ev events.Event) bool {
+	_, err := fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+	return err == nil
+}
+
+// publishPost sends a post to the streams. my_vote is whoever made the request's vote, which
+// means nothing to the people watching, so it goes out as 0.
+func (s *Server) publishPost(typ string, post store.Post) {
+	post.MyVote = 0
+	s.events.Publish(events.TopicChannel(post.TopicID), typ, post)
+	if typ != "post.created" {
+		s.events.Publish(events.PostChannel(post.ID), typ, post)
+	}
+}
+
+// publishComment is publishPost for comments, they only go to the post's stream
+func (s *Server) publishComment(typ string, comment store.Comment) {
+	comment.MyVote = 0
+	s.events.Publish(events.PostChannel(comment.PostID), typ, comment)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/events"
+)
+
+type sseEvent struct {
+	id, typ, data string
+}
+
+// stream is one open GET .../events
+type stream struct {
+	resp  *http.Response
+	lines *bufio.Reader
+	pings int
+}
+
+// next reads the next event, skipping the retry line and counting heartbeats. ok is false when the stream ended.
+func (s *stream) next(t *testing.T) (ev sseEvent, ok bool) {
+	t.Helper()
+	for {
+		line, err := s.lines.ReadString('\n')
+		if err == io.EOF {
+			return ev, false
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		field, value, _ := strings.Cut(line, ": ")
+		switch {
+		case line == "" && ev.typ != "":
+			return ev, true
+		case line == ": ping":
+			s.pings++
+		case field == "id":
+			ev.id = value
+		case field == "event":
+			ev.typ = value
+		case field == "data":
+			ev.data = value
+		}
+	}
+}
+
+func TestEventStreams(t *testing.T) {
+	heartbeatInterval = 20 * time.Millisecond
+	defer func() { heartbeatInterval = 15 * time.Second }()
+
+	srv := newTestServer(t)
+	srv.mux.HandleFunc("GET /posts/{id}/events", srv.PostEvents)
+	srv.mux.HandleFunc("GET /topics/{id}/events", srv.TopicEvents)
+	srv.mux.HandleFunc("POST /posts/{id}/comments", srv.CreateComment)
+	srv.mux.HandleFunc("DELETE /posts/{id}", srv.DeletePost)
+	srv.mux.HandleFunc("DELETE /topics/{id}", srv.DeleteTopic)
+	ts := httptest.NewServer(srv.handler())
+	defer ts.Close()
+
+	alice := srv.user("alice")
+	topic := srv.topic("Golang", alice)
+	post := srv.post(topic, "Channels", "body", alice)
+	postPath := "/posts/" + strconv.Itoa(post.ID)
+
+	send := func(method, path, body string) {
+		t.Helper()
+		if rec := srv.send(alice, method, path, body); rec.Code >= 300 {
+			t.Fatalf("%s %s got %d %s", method, path, rec.Code, rec.Body)
+		}
+	}
+	open := func(path, lastID string, want int) *stream {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("GET %s got %d, want %d", path, resp.StatusCode, want)
+		}
+		if want != http.StatusOK {
+			resp.Body.Close()
+			return nil
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("Content-Type %q", ct)
+		}
+		return &stream{resp: resp, lines: bufio.NewReader(resp.Body)}
+	}
+
+	open("/posts/999/events", "", http.StatusNotFound)
+	open("/topics/999/events", "", http.StatusNotFound)
+	open(postPath+"/events", "soon", http.StatusBadRequest)
+
+	// a new comment shows up on the stream, and heartbeats keep it going meanwhile
+	s := open(postPath+"/events", "", http.StatusOK)
+	time.Sleep(3 * heartbeatInterval)
+	send(http.MethodPost, postPath+"/comments", `{"body": "first"}`)
+	first, ok := s.next(t)
+	if !ok || first.typ != "comment.created" || !strings.Contains(first.data, `"body":"first"`) {
+		t.Fatalf("got %+v", first)
+	}
+	if s.pings == 0 {
+		t.Error("no heartbeat on an idle stream")
+	}
+
+	// the subscription goes when the client does
+	s.resp.Body.Close()
+	for deadline := time.Now().Add(time.Second); srv.events.Subscribers(events.PostChannel(post.ID)) > 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription outlived its client")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// reconnecting with the last id seen replays what was missed
+	send(http.MethodPost, postPath+"/comments", `{"body": "second"}`)
+	s = open(postPath+"/events", first.id, http.StatusOK)
+	defer s.resp.Body.Close()
+	if ev, _ := s.next(t); ev.typ != "comment.created" || !strings.Contains(ev.data, `"body":"second"`) {
+		t.Errorf("replay got %+v", ev)
+	}
+
+	// deleting the post is the stream's last event
+	send(http.MethodDelete, postPath, "")
+	if ev, _ := s.next(t); ev.typ != "post.deleted" {
+		t.Errorf("got %+v, want post.deleted", ev)
+	}
+	if ev, ok := s.next(t); ok {
+		t.Errorf("the stream went on after the post was deleted: %+v", ev)
+	}
+
+	// deleting a topic ends its stream and the streams of every post in it
+	doomed := srv.topic("Rust", alice)
+	doomedPath := "/topics/" + strconv.Itoa(doomed.ID)
+	var streams []*stream
+	for _, title := range []string{"Ownership", "Lifetimes"} {
+		p := srv.post(doomed, title, "body", alice)
+		streams = append(streams, open("/posts/"+strconv.Itoa(p.ID)+"/events", "", http.StatusOK))
+	}
+	streams = append(streams, open(doomedPath+"/events", "", http.StatusOK))
+	send(http.MethodDelete, doomedPath, "")
+	for i, s := range streams {
+		if ev, _ := s.next(t); ev.typ != "topic.deleted" || ev.data != `{"id":`+strconv.Itoa(doomed.ID)+`}` {
+			t.Errorf("stream %d got %+v, want topic.deleted", i, ev)
+		}
+		if ev, ok := s.next(t); ok {
+			t.Errorf("stream %d went on after the topic was deleted: %+v", i, ev)
+		}
+		s.resp.Body.Close()
+	}
+
+	// and shutting down ends the rest
+	topicStream := open("/topics/"+strconv.Itoa(topic.ID)+"/events", "", http.StatusOK)
+	defer topicStream.resp.Body.Close()
+	srv.CloseStreams()
+	if ev, ok := topicStream.next(t); ok {
+		t.Errorf("got %+v after shutting down", ev)
+	}
+	open("/topics/"+strconv.Itoa(topic.ID)+"/events", "", http.StatusServiceUnavailable)
+}
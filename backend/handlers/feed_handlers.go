@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/feeds"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// FeedOptions sets up the Atom and RSS feeds, main fills them in from the config
+type FeedOptions struct {
+	Items   int    // entries per feed, the newest ones
+	SiteURL string // the frontend, which the entries link to
+	APIURL  string // this API, which each feed links to as itself
+}
+
+const (
+	atomType = "application/atom+xml; charset=utf-8"
+	rssType  = "application/rss+xml; charset=utf-8"
+)
+
+// Feeds serves the feeds for feed readers. They are public like everything else that can be read
+// without logging in, and built from the same store calls as the JSON listings.
+type Feeds struct {
+	s    *Server
+	opts FeedOptions
+}
+
+func (s *Server) Feeds(opts FeedOptions) *Feeds {
+	opts.SiteURL = strings.TrimSuffix(opts.SiteURL, "/")
+	opts.APIURL = strings.TrimSuffix(opts.APIURL, "/")
+	return &Feeds{s: s, opts: opts}
+}
+
+// this func handles GET /topics/{id}/feed.atom, the newest posts in a topic
+func (f *Feeds) TopicAtom(writer http.ResponseWriter, request *http.Request) {
+	f.serve(writer, request, f.topicFeed, feeds.Atom, atomType)
+}
+
+// this func handles GET /topics/{id}/feed.rss, the same as TopicAtom for readers that want RSS
+func (f *Feeds) TopicRSS(writer http.ResponseWriter, request *http.Request) {
+	f.serve(writer, request, f.topicFeed, feeds.RSS, rssType)
+}
+
+// this func handles GET /posts/{id}/comments.atom, the newest comments on a post, replies included
+func (f *Feeds) CommentsAtom(writer http.ResponseWriter, request *http.Request) {
+	f.serve(writer, request, f.commentsFeed, feeds.Atom, atomType)
+}
+
+// this func handles GET /feed.atom, the newest topics on the whole site
+func (f *Feeds) SiteAtom(writer http.ResponseWriter, request *http.Request) {
+	f.serve(writer, request, f.siteFeed, feeds.Atom, atomType)
+}
+
+// this func handles GET /feed.rss
+func (f *Feeds) SiteRSS(writer http.ResponseWriter, request *http.Request) {
+	f.serve(writer, request, f.siteFeed, feeds.RSS, rssType)
+}
+
+// serve builds and renders the feed, then lets http.ServeContent answer If-None-Match and
+// If-Modified-Since. The ETag is a hash of the rendered feed, so it changes with anything in it,
+// deleted entries included, which Last-Modified alone would miss.
+func (f *Feeds) serve(writer http.ResponseWriter, request *http.Request,
+	build func(http.ResponseWriter, *http.Request) (feeds.Feed, bool), render func(feeds.Feed) ([]byte, error), contentType string) {
+	feed, ok := build(writer, request)
+	if !ok {
+		return
+	}
+	body, err := render(feed)
+	if err != nil {
+		serverError(writer, request, "Failed to render feed", err)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	writer.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	writer.Header().Set("Content-Type", contentType)
+	// readers may keep the feed but have to check back, which the conditional GET makes cheap
+	writer.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(writer, request, "", feed.Updated, bytes.NewReader(body))
+}
+
+func (f *Feeds) topicFeed(writer http.ResponseWriter, request *http.Request) (feeds.Feed, bool) {
+	topicID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || topicID <= 0 {
+		WriteError(writer, request, invalidID("topic"))
+		return feeds.Feed{}, false
+	}
+	ctx := request.Context()
+	topic, err := f.s.topics.GetTopic(ctx, topicID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("topic"))
+		return feeds.Feed{}, false
+	} else if err != nil {
+		serverError(writer, request, "Failed to fetch topic", err)
+		return feeds.Feed{}, false
+	}
+	posts, err := f.s.posts.ListPosts(ctx, topicID, store.SortNew, time.Time{}, store.PageRequest{Limit: f.opts.Items}, 0)
+	if err != nil {
+		serverError(writer, request, "Failed to fetch posts", err)
+		return feeds.Feed{}, false
+	}
+
+	feed := feeds.Feed{
+		Title:    topic.Title,
+		Subtitle: topic.Description,
+		Link:     f.link("/topics/%d", topic.ID),
+		Self:     f.self(request),
+		Updated:  lastChange(topic.CreatedAt, topic.EditedAt),
+	}
+	authors := map[int]string{}
+	for _, post := range posts.Items {
+		author, err := f.author(ctx, authors, post.CreatedBy)
+		if err != nil {
+			serverError(writer, request, "Failed to fetch post author", err)
+			return feeds.Feed{}, false
+		}
+		feed.Add(feeds.Entry{
+			Title:     post.Title,
+			Link:      f.link("/posts/%d", post.ID),
+			Author:    author,
+			Content:   post.Body,
+			Published: post.CreatedAt,
+			Updated:   lastChange(post.CreatedAt, post.EditedAt),
+		})
+	}
+	return feed, true
+}
+
+func (f *Feeds) commentsFeed(writer http.ResponseWriter, request *http.Request) (feeds.Feed, bool) {
+	postID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || postID <= 0 {
+		WriteError(writer, request, invalidID("post"))
+		return feeds.Feed{}, false
+	}
+	ctx := request.Context()
+	post, err := f.s.posts.GetPost(ctx, postID, 0)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("post"))
+		return feeds.Feed{}, false
+	} else if err != nil {
+		serverError(writer, request, "Failed to fetch post", err)
+		return feeds.Feed{}, false
+	}
+	comments, err := f.s.comments.LatestComments(ctx, postID, f.opts.Items)
+	if err != nil {
+		serverError(writer, request, "Failed to fetch comments", err)
+		return feeds.Feed{}, false
+	}
+
+	postLink := f.link("/posts/%d", post.ID)
+	feed := feeds.Feed{
+		Title:   "Comments on " + post.Title,
+		Link:    postLink,
+		Self:    f.self(request),
+		Updated: lastChange(post.CreatedAt, post.EditedAt),
+	}
+	authors := map[int]string{}
+	for _, comment := range comments {
+		author, err := f.author(ctx, authors, comment.CreatedBy)
+		if err != nil {
+			serverError(writer, request, "Failed to fetch comment author", err)
+			return feeds.Feed{}, false
+		}
+		feed.Add(feeds.Entry{
+			Title:     author + " on " + post.Title,
+			Link:      postLink + "#comment-" + strconv.Itoa(comment.ID),
+			Author:    author,
+			Content:   comment.Body,
+			Published: comment.CreatedAt,
+			Updated:   lastChange(comment.CreatedAt, comment.EditedAt),
+		})
+	}
+	return feed, true
+}
+
+func (f *Feeds) siteFeed(writer http.ResponseWriter, request *http.Request) (feeds.Feed, bool) {
+	ctx := request.Context()
+	topics, err := f.s.topics.ListTopics(ctx, store.SortNew, store.PageRequest{Limit: f.opts.Items})
+	if err != nil {
+		serverError(writer, request, "Failed to fetch topics", err)
+		return feeds.Feed{}, false
+	}
+
+	feed := feeds.Feed{
+		Title: "CampusCommons topics",
+		Link:  f.link("/topics"),
+		Self:  f.self(request),
+		// a site without topics has never changed
+		Updated: time.Unix(0, 0).UTC(),
+	}
+	authors := map[int]string{}
+	for _, topic := range topics.Items {
+		author, err := f.author(ctx, authors, topic.CreatedBy)
+		if err != nil {
+			serverError(writer, request, "Failed to fetch topic author", err)
+			return feeds.Feed{}, false
+		}
+		feed.Add(feeds.Entry{
+			Title:     topic.Title,
+			Link:      f.link("/topics/%d", topic.ID),
+			Author:    author,
+			Content:   topic.Description,
+			Published: topic.CreatedAt,
+			Updated:   lastChange(topic.CreatedAt, topic.EditedAt),
+		})
+	}
+	return feed, true
+}
+
+// author looks up a username once per feed, most feeds have a handful of people in them
+func (f *Feeds) author(ctx context.Context, cache map[int]string, userID int) (string, error) {
+	if name, ok := cache[userID]; ok {
+		return name, nil
+	}
+	user, err := f.s.users.GetUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	cache[userID] = user.Username
+	return user.Username, nil
+}
+
+// link is a page of the frontend
+func (f *Feeds) link(format string, args ...any) string {
+	return f.opts.SiteURL + fmt.Sprintf(format, args...)
+}
+
+// self is where the feed was asked for, readers use it to find the feed again. It starts from the
+// configured API URL, the Host header is whatever the client sent and would end up in cached feeds.
+func (f *Feeds) self(request *http.Request) string {
+	return f.opts.APIURL + request.URL.Path
+}
+
+// lastChange is when a post, comment or topic was edited, or created if it never was
+func lastChange(createdAt time.Time, editedAt *time.Time) time.Time {
+	if editedAt != nil {
+		return *editedAt
+	}
+	return createdAt
+}
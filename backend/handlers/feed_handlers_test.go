@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFeeds(t *testing.T) {
+	srv := newTestServer(t)
+	feeds := srv.Feeds(FeedOptions{Items: 2, SiteURL: "http://campus.example/", APIURL: "https://api.campus.example/"})
+	srv.mux.HandleFunc("GET /feed.rss", feeds.SiteRSS)
+	srv.mux.HandleFunc("GET /topics/{id}/feed.atom", feeds.TopicAtom)
+	srv.mux.HandleFunc("GET /posts/{id}/comments.atom", feeds.CommentsAtom)
+
+	ctx := context.Background()
+	alice := srv.user("alice")
+	bob := srv.user("bob")
+	topic := srv.topic("Lectures", alice)
+	week1 := srv.post(topic, "Week 1", "intro", alice)
+	srv.post(topic, "Week 2", "pointers", alice)
+	week3 := srv.post(topic, "Week 3", "channels & <select>", bob)
+	topicFeed := "/topics/" + strconv.Itoa(topic.ID) + "/feed.atom"
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		srv.mux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := get(topicFeed, nil)
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/atom+xml") {
+		t.Fatalf("got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	// the two newest posts, escaped, linking to the frontend
+	if !strings.Contains(body, "<title>Week 3</title>") || !strings.Contains(body, "channels &amp; &lt;select&gt;") ||
+		!strings.Contains(body, "<name>bob</name>") || !strings.Contains(body, `href="http://campus.example/posts/`) {
+		t.Errorf("feed is missing the newest post:\n%s", body)
+	}
+	// the feed's own link comes from the config, not the Host the client sent
+	if !strings.Contains(body, `<id>https://api.campus.example`+topicFeed+`</id>`) || strings.Contains(body, "example.com") {
+		t.Errorf("feed doesn't link to itself at the API URL:\n%s", body)
+	}
+	if strings.Contains(body, "Week 1") {
+		t.Error("the feed has more than the configured items")
+	}
+	etag, lastModified := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("ETag %q, Last-Modified %q", etag, lastModified)
+	}
+
+	// a reader with the current copy gets a 304 either way
+	if rec := get(topicFeed, http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("If-None-Match got %d", rec.Code)
+	}
+	if rec := get(topicFeed, http.Header{"If-Modified-Since": {lastModified}}); rec.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since got %d", rec.Code)
+	}
+
+	// a change to what is in the feed gives it a new ETag, deletions included
+	_, err := srv.st.UpdatePost(ctx, week1.ID, "Week 1", "intro, now with slides", alice.ID)
+	srv.check(err)
+	if rec := get(topicFeed, http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusNotModified {
+		t.Errorf("an edit to a post outside the feed changed it: %d", rec.Code)
+	}
+	srv.check(srv.st.DeletePost(ctx, week3.ID))
+	rec = get(topicFeed, http.Header{"If-None-Match": {etag}})
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag || !strings.Contains(rec.Body.String(), "now with slides") {
+		t.Errorf("after a deletion got %d with ETag %s", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	// comments come newest first, replies included
+	first := srv.comment(week1, nil, "are the slides up?", bob)
+	srv.comment(week1, &first.ID, "they are now", alice)
+	rec = get("/posts/"+strconv.Itoa(week1.ID)+"/comments.atom", nil)
+	body = rec.Body.String()
+	if rec.Code != http.StatusOK || strings.Index(body, "they are now") > strings.Index(body, "are the slides up?") ||
+		!strings.Contains(body, "<title>bob on Week 1</title>") || !strings.Contains(body, "#comment-"+strconv.Itoa(first.ID)) {
+		t.Errorf("comments feed got %d:\n%s", rec.Code, body)
+	}
+
+	rec = get("/feed.rss", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "application/rss+xml") ||
+		!strings.Contains(rec.Body.String(), "<title>Lectures</title>") || !strings.Contains(rec.Body.String(), "<dc:creator>alice</dc:creator>") {
+		t.Errorf("site feed got %d:\n%s", rec.Code, rec.Body)
+	}
+
+	if rec := get("/topics/999/feed.atom", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("missing topic got %d", rec.Code)
+	}
+	if rec := get("/posts/x/comments.atom", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad post ID got %d", rec.Code)
+	}
+}
@@ -0,0 +1,467 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/events"
+	"github.com/archonward/CampusCommons/backend/metrics"
+	"github.com/archonward/CampusCommons/backend/store"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// GatewayOptions are the limits of GET /ws, main fills them in from the config
+type GatewayOptions struct {
+	AllowedOrigins   []string // where pages that may connect are served from, the same as CORS
+	MaxConnsPerUser  int
+	MaxSubscriptions int // channels per connection
+}
+
+const (
+	// how many messages can wait for a client before it counts as too slow and is disconnected
+	wsQueue = 64
+	// how long sending one message, or getting a pong back, may take
+	wsWriteTimeout = 10 * time.Second
+	// the biggest message a client may send, they are all tiny
+	wsReadLimit = 4 << 10
+	// a client's typing events go out at most this often per channel, the rest are dropped
+	typingInterval = 2 * time.Second
+)
+
+var (
+	errUpgradeRequired    = APIError{Status: http.StatusUpgradeRequired, Code: "websocket_required", Message: "This endpoint only takes WebSocket connections"}
+	errOriginNotAllowed   = APIError{Status: http.StatusForbidden, Code: "origin_not_allowed", Message: "Pages on this origin can't connect"}
+	errTooManyConnections = APIError{Status: http.StatusTooManyRequests, Code: "too_many_connections", Message: "You have too many live connections open, close a tab and try again"}
+	errAlreadySubscribed  = APIError{Status: http.StatusConflict, Code: "already_subscribed", Message: "Already subscribed to this channel"}
+	errNotSubscribed      = APIError{Status: http.StatusConflict, Code: "not_subscribed", Message: "Subscribe to the channel first"}
+)
+
+// gateway is GET /ws. It passes what the handlers publish on to the clients subscribed to each
+// channel, and keeps track of who is viewing which channel for the presence events.
+type gateway struct {
+	s    *Server
+	opts GatewayOptions
+
+	mu       sync.Mutex
+	conns    map[int]int                // open connections per user
+	presence map[string]map[int]*viewer // who is subscribed to each channel, by user ID
+}
+
+// viewer is one user on one channel, with how many of their connections are subscribed to it
+type viewer struct {
+	presenceUser
+	conns int
+}
+
+// presenceUser is the data of the presence.join, presence.leave and typing events
+type presenceUser struct {
+	UserID   int    `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// wsRequest is what clients send
+type wsRequest struct {
+	Action      string `json:"action"`        // subscribe, unsubscribe or typing
+	Channel     string `json:"channel"`       // topic:<id> or post:<id>
+	LastEventID uint64 `json:"last_event_id"` // subscribe only, resumes like Last-Event-ID does on the event streams
+}
+
+// wsMessage is what the server sends. Type is an event type from the streams (comment.created,
+// resync, ...), presence.join, presence.leave, typing, or subscribed, unsubscribed and error.
+type wsMessage struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel,omitempty"`
+	ID      uint64 `json:"id,omitempty"` // only on events that can be resumed from
+	Data    any    `json:"data,omitempty"`
+}
+
+// Gateway returns the handler for GET /ws, the WebSocket version of the event streams with
+// presence and typing on top. Only one is needed, it keeps the presence of every connection.
+func (s *Server) Gateway(opts GatewayOptions) http.Handler {
+	return &gateway{s: s, opts: opts, conns: map[int]int{}, presence: map[string]map[int]*viewer{}}
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the session cookie (or token) is checked as for any other request before the upgrade
+	user, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		WriteError(w, r, errUpgradeRequired)
+		return
+	}
+	// browsers send the cookie whichever page opens the socket and CORS doesn't apply to
+	// WebSockets, so only our own pages may connect
+	if !g.originAllowed(r) {
+		WriteError(w, r, errOriginNotAllowed)
+		return
+	}
+	if !g.connect(user.ID) {
+		WriteError(w, r, errTooManyConnections)
+		return
+	}
+	defer g.disconnect(user.ID)
+	// counted before the upgrade, which can fail, so shutting down never misses one being accepted
+	if !g.s.openSocket() {
+		WriteError(w, r, errShuttingDown)
+		return
+	}
+	defer g.s.sockets.Done()
+
+	// the server's read and write timeouts are for ordinary requests, a socket would be cut off after them
+	rc := http.NewResponseController(w)
+	for _, lift := range []func(time.Time) error{rc.SetReadDeadline, rc.SetWriteDeadline} {
+		if err := lift(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			serverError(w, r, "Failed to start WebSocket", err)
+			return
+		}
+	}
+
+	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{OriginPatterns: g.opts.AllowedOrigins})
+	if err != nil {
+		// Accept has answered the request itself
+		return
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(wsReadLimit)
+
+	metrics.WebSockets.Inc()
+	defer metrics.WebSockets.Dec()
+
+	c := &wsClient{
+		g:      g,
+		conn:   conn,
+		user:   user,
+		out:    make(chan wsMessage, wsQueue),
+		ending: make(chan struct{}),
+		subs:   map[string]*events.Subscription{},
+		typed:  map[string]time.Time{},
+	}
+	// the handler runs until the connection is over, so the request's context lasts as long
+	c.run(r.Context())
+}
+
+// originAllowed lets through requests without an Origin (not from a browser), from the API's own
+// host, and from the CORS origins
+func (g *gateway) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host) || slices.ContainsFunc(g.opts.AllowedOrigins, func(allowed string) bool {
+		return strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin)
+	})
+}
+
+// connect counts a new connection for the user, false if they are at the limit
+func (g *gateway) connect(userID int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conns[userID] >= g.opts.MaxConnsPerUser {
+		return false
+	}
+	g.conns[userID]++
+	return true
+}
+
+func (g *gateway) disconnect(userID int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conns[userID]--; g.conns[userID] <= 0 {
+		delete(g.conns, userID)
+	}
+}
+
+// join adds the user to the channel's viewers and returns everyone viewing it, by username.
+// Only the user's first connection to the channel is announced, another tab changes nothing for the others.
+func (g *gateway) join(channel string, user store.User) []presenceUser {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	viewers, ok := g.presence[channel]
+	if !ok {
+		viewers = map[int]*viewer{}
+		g.presence[channel] = viewers
+	}
+	v, ok := viewers[user.ID]
+	if !ok {
+		v = &viewer{presenceUser: presenceUser{UserID: user.ID, Username: user.Username}}
+		viewers[user.ID] = v
+		g.s.events.Broadcast(channel, "presence.join", v.presenceUser)
+	}
+	v.conns++
+
+	list := make([]presenceUser, 0, len(viewers))
+	for _, v := range viewers {
+		list = append(list, v.presenceUser)
+	}
+	slices.SortFunc(list, func(a, b presenceUser) int { return strings.Compare(a.Username, b.Username) })
+	return list
+}
+
+// leave is join undone, the user's last connection to leave the channel is announced
+func (g *gateway) leave(channel string, user store.User) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	v, ok := g.presence[channel][user.ID]
+	if !ok {
+		return
+	}
+	if v.conns--; v.conns > 0 {
+		return
+	}
+	delete(g.presence[channel], user.ID)
+	if len(g.presence[channel]) == 0 {
+		delete(g.presence, channel)
+	}
+	g.s.events.Broadcast(channel, "presence.leave", v.presenceUser)
+}
+
+// wsClient is one open connection. Its handler goroutine reads what the client sends, another one
+// writes everything in out, and each subscription has a goroutine moving its events into out.
+type wsClient struct {
+	g    *gateway
+	conn *websocket.Conn
+	user store.User
+	out  chan wsMessage
+
+	// end closes ending once it has a reason, the writer then closes the connection with it
+	endOnce   sync.Once
+	ending    chan struct{}
+	endCode   websocket.StatusCode
+	endReason string
+
+	mu    sync.Mutex
+	subs  map[string]*events.Subscription
+	typed map[string]time.Time // when each channel last got a typing event from this client, read loop only
+}
+
+func (c *wsClient) run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go c.writeLoop(ctx)
+	defer c.unsubscribeAll()
+
+	for {
+		_, data, err := c.conn.Read(ctx)
+		if err != nil {
+			// closed from either end, or the connection broke
+			return
+		}
+		var req wsRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			c.sendError("", errInvalidJSON)
+			continue
+		}
+		switch req.Action {
+		case "subscribe":
+			c.subscribe(ctx, req.Channel, req.LastEventID)
+		case "unsubscribe":
+			c.unsubscribe(req.Channel)
+			c.send(wsMessage{Type: "unsubscribed", Channel: req.Channel})
+		case "typing":
+			c.typing(req.Channel)
+		default:
+			c.sendError(req.Channel, invalidField("action", "action must be subscribe, unsubscribe or typing"))
+		}
+	}
+}
+
+func (c *wsClient) writeLoop(ctx context.Context) {
+	// pings keep proxies from closing a quiet connection, and notice clients that vanished without closing
+	ping := time.NewTicker(heartbeatInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.g.s.events.Done():
+			c.conn.Close(websocket.StatusGoingAway, "server restarting")
+			return
+		case <-c.ending:
+			c.conn.Close(c.endCode, c.endReason)
+			return
+		case msg := <-c.out:
+			writeCtx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+			err := wsjson.Write(writeCtx, c.conn, msg)
+			cancel()
+			if err != nil {
+				c.conn.CloseNow()
+				return
+			}
+		case <-ping.C:
+			pingCtx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+			err := c.conn.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				c.conn.CloseNow()
+				return
+			}
+		}
+	}
+}
+
+// send queues a message without waiting. A client that lets the queue fill up is disconnected,
+// and picks up what it missed by subscribing again with last_event_id.
+func (c *wsClient) send(msg wsMessage) {
+	select {
+	case c.out <- msg:
+	default:
+		c.end(websocket.StatusTryAgainLater, "too slow, reconnect and resume with last_event_id")
+	}
+}
+
+func (c *wsClient) sendError(channel string, e APIError) {
+	c.send(wsMessage{Type: "error", Channel: channel, Data: e})
+}
+
+// end has the writer close the connection, the first reason given is the one the client sees
+func (c *wsClient) end(code websocket.StatusCode, reason string) {
+	c.endOnce.Do(func() {
+		if code == websocket.StatusTryAgainLater {
+			metrics.WebSocketsDropped.Inc()
+		}
+		c.endCode, c.endReason = code, reason
+		close(c.ending)
+	})
+}
+
+func (c *wsClient) subscribe(ctx context.Context, channel string, lastID uint64) {
+	kind, id, ok := events.ParseChannel(channel)
+	if !ok {
+		c.sendError(channel, invalidField("channel", "channel must be topic:<id> or post:<id>"))
+		return
+	}
+	c.mu.Lock()
+	_, subscribed := c.subs[channel]
+	full := len(c.subs) >= c.g.opts.MaxSubscriptions
+	c.mu.Unlock()
+	if subscribed {
+		c.sendError(channel, errAlreadySubscribed)
+		return
+	}
+	if full {
+		c.sendError(channel, APIError{Status: http.StatusTooManyRequests, Code: "too_many_subscriptions",
+			Message: fmt.Sprintf("At most %d channels per connection, unsubscribe from one first", c.g.opts.MaxSubscriptions)})
+		return
+	}
+
+	// a post's channel belongs to its topic's, it ends when the topic is deleted
+	var parent string
+	var err error
+	if kind == "post" {
+		var post store.Post
+		post, err = c.g.s.posts.GetPost(ctx, id, 0)
+		parent = events.TopicChannel(post.TopicID)
+	} else {
+		_, err = c.g.s.topics.GetTopic(ctx, id)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		c.sendError(channel, notFound(kind))
+		return
+	} else if err != nil {
+		slog.ErrorContext(ctx, "Failed to check "+kind+" for subscribing", slog.String("error", err.Error()), slog.String("request_id", RequestIDFrom(ctx)))
+		c.sendError(channel, errInternal)
+		return
+	}
+
+	sub, replay, ok := c.g.s.events.SubscribeWithin(channel, parent, lastID)
+	if !ok {
+		// the writer is closing the connection already
+		return
+	}
+	c.mu.Lock()
+	c.subs[channel] = sub
+	c.mu.Unlock()
+
+	viewers := c.g.join(channel, c.user)
+	c.send(wsMessage{Type: "subscribed", Channel: channel, Data: map[string]any{"viewers": viewers}})
+	for _, ev := range replay {
+		c.send(wsMessage{Type: ev.Type, Channel: channel, ID: ev.ID, Data: ev.Data})
+	}
+	go c.forward(channel, sub)
+}
+
+// forward moves a subscription's events into the queue until the subscription ends
+func (c *wsClient) forward(channel string, sub *events.Subscription) {
+	last := false
+	for ev := range sub.C {
+		c.send(wsMessage{Type: ev.Type, Channel: channel, ID: ev.ID, Data: ev.Data})
+		last = ev.Last
+	}
+
+	// the subscription ended without the client asking: the post or topic is gone, the hub is
+	// closing (the writer deals with that), or the hub dropped it for falling behind
+	c.mu.Lock()
+	current := c.subs[channel] == sub
+	if current {
+		delete(c.subs, channel)
+	}
+	c.mu.Unlock()
+	if !current {
+		// unsubscribed, nothing more to do
+		return
+	}
+	c.g.leave(channel, c.user)
+	select {
+	case <-c.g.s.events.Done():
+	default:
+		if !last {
+			c.end(websocket.StatusTryAgainLater, "too slow, reconnect and resume with last_event_id")
+		}
+	}
+}
+
+func (c *wsClient) unsubscribe(channel string) {
+	c.mu.Lock()
+	sub, ok := c.subs[channel]
+	delete(c.subs, channel)
+	c.mu.Unlock()
+	if ok {
+		sub.Close()
+		c.g.leave(channel, c.user)
+	}
+}
+
+func (c *wsClient) unsubscribeAll() {
+	c.mu.Lock()
+	channels := make([]string, 0, len(c.subs))
+	for channel := range c.subs {
+		channels = append(channels, channel)
+	}
+	c.mu.Unlock()
+	for _, channel := range channels {
+		c.unsubscribe(channel)
+	}
+}
+
+// typing tells the channel the user is typing. Clients send it every few seconds while the user
+// types and hide the indicator when they stop hearing it.
+func (c *wsClient) typing(channel string) {
+	c.mu.Lock()
+	_, subscribed := c.subs[channel]
+	c.mu.Unlock()
+	if !subscribed {
+		c.sendError(channel, errNotSubscribed)
+		return
+	}
+	if time.Since(c.typed[channel]) < typingInterval {
+		return
+	}
+	c.typed[channel] = time.Now()
+	c.g.s.events.Broadcast(channel, "typing", presenceUser{UserID: c.user.ID, Username: c.user.Username})
+}
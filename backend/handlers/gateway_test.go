@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// received is a wsMessage with the data left as JSON
+type received struct {
+	Type    string          `json:"type"`
+	Channel string          `json:"channel"`
+	ID      uint64          `json:"id"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func TestGateway(t *testing.T) {
+	srv := newTestServer(t)
+	srv.mux.Handle("GET /ws", srv.Gateway(GatewayOptions{AllowedOrigins: []string{"http://localhost:3000"}, MaxConnsPerUser: 2, MaxSubscriptions: 1}))
+	srv.mux.HandleFunc("POST /posts/{id}/comments", srv.CreateComment)
+
+	ctx := context.Background()
+	users := map[string]store.User{}
+	for _, name := range []string{"alice", "bob"} {
+		users[name] = srv.user(name)
+	}
+	topic := srv.topic("Lectures", users["alice"])
+	post := srv.post(topic, "Week 1 Q&A", "ask away", users["alice"])
+	channel := "post:" + strconv.Itoa(post.ID)
+
+	ts := httptest.NewServer(srv.handler())
+	defer ts.Close()
+
+	dial := func(name, origin string) (*websocket.Conn, int) {
+		t.Helper()
+		header := http.Header{"X-User": {name}}
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, resp, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", &websocket.DialOptions{HTTPHeader: header})
+		if err != nil {
+			return nil, resp.StatusCode
+		}
+		t.Cleanup(func() { conn.CloseNow() })
+		return conn, http.StatusSwitchingProtocols
+	}
+	send := func(conn *websocket.Conn, msg string) {
+		t.Helper()
+		if err := conn.Write(ctx, websocket.MessageText, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next := func(conn *websocket.Conn) received {
+		t.Helper()
+		readCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		var msg received
+		if err := wsjson.Read(readCtx, conn, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	expect := func(conn *websocket.Conn, typ, dataHas string) received {
+		t.Helper()
+		msg := next(conn)
+		if msg.Type != typ || !strings.Contains(string(msg.Data), dataHas) {
+			t.Fatalf("got %s %s, want %s with %s", msg.Type, msg.Data, typ, dataHas)
+		}
+		return msg
+	}
+
+	if _, status := dial("", ""); status != http.StatusUnauthorized {
+		t.Errorf("logged out got %d", status)
+	}
+	if _, status := dial("alice", "https://elsewhere.example"); status != http.StatusForbidden {
+		t.Errorf("foreign origin got %d", status)
+	}
+
+	alice, _ := dial("alice", "http://localhost:3000")
+	send(alice, `{"action": "subscribe", "channel": "`+channel+`"}`)
+	expect(alice, "subscribed", `"viewers":[{"user_id":1,"username":"alice"}]`)
+	expect(alice, "presence.join", `"username":"alice"`)
+
+	bob, _ := dial("bob", "")
+	send(bob, `{"action": "subscribe", "channel": "`+channel+`"}`)
+	expect(bob, "subscribed", `"username":"alice"},{"user_id":2,"username":"bob"}`)
+	expect(bob, "presence.join", `"username":"bob"`)
+	expect(alice, "presence.join", `"username":"bob"`)
+
+	// only the first of quick typing events goes out
+	send(bob, `{"action": "typing", "channel": "`+channel+`"}`)
+	send(bob, `{"action": "typing", "channel": "`+channel+`"}`)
+	expect(alice, "typing", `"username":"bob"`)
+
+	if rec := srv.send(users["bob"], http.MethodPost, "/posts/"+strconv.Itoa(post.ID)+"/comments", `{"body": "when is the exam?"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("comment got %d %s", rec.Code, rec.Body)
+	}
+	if msg := expect(alice, "comment.created", "when is the exam?"); msg.ID == 0 || msg.Channel != channel {
+		t.Errorf("comment event %+v", msg)
+	}
+
+	// mistakes come back as errors and the connection carries on
+	send(alice, `{"action": "subscribe", "channel": "post:999"}`)
+	expect(alice, "error", `"code":"too_many_subscriptions"`)
+	send(alice, `{"action": "typing", "channel": "post:999"}`)
+	expect(alice, "error", `"code":"not_subscribed"`)
+	send(alice, `{"action": "subscribe", "channel": "`+channel+`"}`)
+	expect(alice, "error", `"code":"already_subscribed"`)
+	send(alice, `not json`)
+	expect(alice, "error", `"code":"invalid_json"`)
+	send(bob, `{"action": "unsubscribe", "channel": "`+channel+`"}`)
+	expect(bob, "typing", `"username":"bob"`)
+	expect(bob, "comment.created", "when is the exam?")
+	expect(bob, "unsubscribed", "")
+	expect(alice, "presence.leave", `"username":"bob"`)
+	send(bob, `{"action": "subscribe", "channel": "post:999"}`)
+	expect(bob, "error", `"code":"post_not_found"`)
+
+	// at most two connections each
+	aliceTab, status := dial("alice", "")
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("second connection got %d", status)
+	}
+	if _, status := dial("alice", ""); status != http.StatusTooManyRequests {
+		t.Errorf("third connection got %d, want 429", status)
+	}
+
+	// shutting down closes every connection, once the clients have answered the close
+	alice.CloseRead(ctx)
+	aliceTab.CloseRead(ctx)
+	closed := make(chan struct{})
+	go func() {
+		srv.CloseStreams()
+		close(closed)
+	}()
+	readCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if _, _, err := bob.Read(readCtx); websocket.CloseStatus(err) != websocket.StatusGoingAway {
+		t.Errorf("after shutting down got %v", err)
+	}
+	select {
+	case <-closed:
+	case <-readCtx.Done():
+		t.Error("CloseStreams didn't return once the connections were closed")
+	}
+	if _, status := dial("bob", ""); status != http.StatusServiceUnavailable {
+		t.Errorf("connecting while shutting down got %d, want 503", status)
+	}
+}
+
+func TestGatewayFailedUpgrade(t *testing.T) {
+	srv := newTestServer(t)
+	srv.mux.Handle("GET /ws", srv.Gateway(GatewayOptions{MaxConnsPerUser: 1, MaxSubscriptions: 1}))
+	srv.user("alice")
+	ts := httptest.NewServer(srv.handler())
+	defer ts.Close()
+
+	// Upgrade without the rest of the handshake gets past the checks and fails in Accept
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/ws", nil)
+	srv.check(err)
+	req.Header.Set("X-User", "alice")
+	req.Header.Set("Upgrade", "websocket")
+	resp, err := http.DefaultClient.Do(req)
+	srv.check(err)
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		t.Fatal("a broken handshake was accepted")
+	}
+
+	// it isn't counted as open, so shutting down doesn't wait for it
+	closed := make(chan struct{})
+	go func() {
+		srv.CloseStreams()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Error("CloseStreams waited on a WebSocket that was never accepted")
+	}
+}
+
+func TestGatewaySlowClient(t *testing.T) {
+	c := &wsClient{out: make(chan wsMessage, 1), ending: make(chan struct{})}
+	c.send(wsMessage{Type: "comment.created"})
+	c.send(wsMessage{Type: "comment.created"})
+	select {
+	case <-c.ending:
+	default:
+		t.Fatal("a client with a full queue wasn't disconnected")
+	}
+	if c.endCode != websocket.StatusTryAgainLater {
+		t.Errorf("closed with %v", c.endCode)
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/store"
+	"github.com/archonward/CampusCommons/backend/store/memstore"
+)
+
+// testServer is a Server on an empty memstore. Tests add the routes they need to mux and set up
+// their data through the helpers below, which stop the test if that fails.
+type testServer struct {
+	*Server
+	t   *testing.T
+	st  *memstore.Store
+	mux *http.ServeMux
+}
+
+func newTestServer(t *testing.T) *testServer {
+	st := memstore.New()
+	return &testServer{
+		Server: NewServer(Stores{Users: st, Topics: st, Posts: st, Comments: st, Search: st, Notifications: st}),
+		t:      t,
+		st:     st,
+		mux:    http.NewServeMux(),
+	}
+}
+
+// check stops the test on an error in its setup
+func (ts *testServer) check(err error) {
+	ts.t.Helper()
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+// user signs someone up, the first one becomes admin
+func (ts *testServer) user(username string) store.User {
+	ts.t.Helper()
+	user, err := ts.st.CreateUser(context.Background(), username, "hash")
+	ts.check(err)
+	return user
+}
+
+func (ts *testServer) topic(title string, by store.User) store.Topic {
+	ts.t.Helper()
+	topic, err := ts.st.CreateTopic(context.Background(), title, "about "+title, by.ID)
+	ts.check(err)
+	return topic
+}
+
+func (ts *testServer) post(topic store.Topic, title, body string, by store.User) store.Post {
+	ts.t.Helper()
+	post, err := ts.st.CreatePost(context.Background(), topic.ID, title, body, by.ID)
+	ts.check(err)
+	return post
+}
+
+func (ts *testServer) comment(post store.Post, parentID *int, body string, by store.User) store.Comment {
+	ts.t.Helper()
+	comment, err := ts.st.CreateComment(context.Background(), post.ID, parentID, body, by.ID)
+	ts.check(err)
+	return comment
+}
+
+// send runs a request through mux as user, the way Authenticate would have let it in.
+// The zero User sends it logged out.
+func (ts *testServer) send(user store.User, method, path, body string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if user.ID != 0 {
+		r = r.WithContext(context.WithValue(r.Context(), userKey, user))
+	}
+	rec := httptest.NewRecorder()
+	ts.mux.ServeHTTP(rec, r)
+	return rec
+}
+
+// handler is mux for a real listener, the X-User header names who is logged in and stands in
+// for the session Authenticate would check
+func (ts *testServer) handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, err := ts.st.GetUserByUsername(r.Context(), r.Header.Get("X-User")); err == nil {
+			r = r.WithContext(context.WithValue(r.Context(), userKey, user))
+		}
+		ts.mux.ServeHTTP(w, r)
+	})
+}
+
+// decode reads a JSON response, stopping the test if it isn't one
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("%v in %d %s", err, rec.Code, rec.Body)
+	}
+	return v
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+const requestInfoKey contextKey = "request_info"
+
+// requestInfo is what the inner handlers learn about a request that the log line wants,
+// LogRequests puts it in the context and Authenticate fills in the user
+type requestInfo struct {
+	userID int
+}
+
+func setLogUser(ctx context.Context, userID int) {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.userID = userID
+	}
+}
+
+// statusRecorder remembers what was sent, for the log line and for Recover
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach Flush, Hijack and deadlines on the real writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// LogRequests writes one structured log line per request once it is done:
+// method, path, status, latency, size, the logged in user and the request ID.
+// It goes inside RequestID and outside everything else.
+func LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{}
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey, info))
+		rec := &statusRecorder{ResponseWriter: w}
+
+		defer func() {
+			status := rec.status
+			if status == 0 {
+				// nothing was written, net/http sends a 200
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			if status >= 500 {
+				level = slog.LevelError
+			} else if status >= 400 {
+				level = slog.LevelWarn
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.Int("bytes", rec.bytes),
+				slog.String("request_id", RequestIDFrom(r.Context())),
+				slog.String("remote_addr", r.RemoteAddr),
+			}
+			if info.userID != 0 {
+				attrs = append(attrs, slog.Int("user_id", info.userID))
+			}
+			slog.LogAttrs(r.Context(), level, "request", attrs...)
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// Recover turns a panic in a handler into a 500 (if nothing was sent yet) and logs it with the stack,
+// instead of net/http dropping the connection. It goes inside LogRequests so the 500 gets logged too.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec, ok := w.(*statusRecorder)
+		if !ok {
+			rec = &statusRecorder{ResponseWriter: w}
+		}
+
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				// a deliberate abort, net/http knows what to do with it
+				panic(p)
+			}
+			slog.ErrorContext(r.Context(), "panic while handling request",
+				slog.String("request_id", RequestIDFrom(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("panic", fmt.Sprint(p)),
+				slog.String("stack", string(debug.Stack())),
+			)
+			if rec.status == 0 {
+				WriteError(rec, r, errInternal)
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
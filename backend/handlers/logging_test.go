@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs points slog at a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q isn't JSON: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func chain(h http.Handler) http.Handler {
+	return RequestID(LogRequests(Recover(h)))
+}
+
+func TestRequestLog(t *testing.T) {
+	logs := captureLogs(t)
+	handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setLogUser(r.Context(), 7)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/topics", nil)
+	req.Header.Set("X-Request-ID", "from-the-proxy")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if got := resp.Header().Get("X-Request-ID"); got != "from-the-proxy" {
+		t.Errorf("X-Request-ID is %q, want the incoming one", got)
+	}
+	lines := logLines(t, logs)
+	if len(lines) != 1 {
+		t.Fatalf("got %d log lines, want 1", len(lines))
+	}
+	entry := lines[0]
+	want := map[string]any{"msg": "request", "method": "POST", "path": "/topics", "status": 201.0, "bytes": 5.0, "user_id": 7.0, "request_id": "from-the-proxy"}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s is %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["latency_ms"]; !ok {
+		t.Error("latency_ms is missing")
+	}
+}
+
+func TestRequestIDIsGeneratedForJunk(t *testing.T) {
+	captureLogs(t)
+	handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "has spaces\nand a newline")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	id := resp.Header().Get("X-Request-ID")
+	if id == "" || strings.Contains(id, " ") {
+		t.Errorf("X-Request-ID is %q, want a fresh ID", id)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	logs := captureLogs(t)
+	handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++ // nil map
+	}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+	if resp.Code != http.StatusInternalServerError {
+		t.Fatalf("status is %d, want 500", resp.Code)
+	}
+	var body errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Code != "internal_error" || body.Error.RequestID != resp.Header().Get("X-Request-ID") {
+		t.Errorf("got error body %+v", body.Error)
+	}
+
+	lines := logLines(t, logs)
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want the panic and the request", len(lines))
+	}
+	if stack, _ := lines[0]["stack"].(string); !strings.Contains(stack, "logging_test.go") {
+		t.Errorf("the panic log doesn't have the stack: %v", lines[0])
+	}
+	if lines[1]["status"] != 500.0 || lines[1]["level"] != "ERROR" {
+		t.Errorf("the request was logged as %v", lines[1])
+	}
+}
+
+func TestRecoverAfterHeaders(t *testing.T) {
+	captureLogs(t)
+	handler := chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("half way through")
+	}))
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+	// too late for a 500, but the server carries on
+	if resp.Code != http.StatusOK || resp.Body.Len() != 0 {
+		t.Errorf("got %d %q", resp.Code, resp.Body.String())
+	}
+}
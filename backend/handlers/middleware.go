@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/archonward/CampusCommons/backend/auth"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+type contextKey string
+
+const (
+	userKey      contextKey = "user"
+	requestIDKey contextKey = "request_id"
+)
+
+// an X-Request-ID from a proxy or client is kept if it looks like an ID, anything else could mess up the logs
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// RequestID gives every request an ID, sent back in the X-Request-ID header, in error bodies and in the logs.
+// When the request already has an X-Request-ID (e.g. from a load balancer) that one is used, so a request
+// can be followed across services.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, id)))
+	})
+}
+
+// RequestIDFrom returns the ID RequestID gave the request, empty outside of it
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Authenticate wraps the whole mux, it verifies the session token on every request and
+// loads the user it belongs to into the request context.
+// No token means the request carries on anonymously, a bad or expired bearer token is a 401.
+// A bad cookie is just cleared, otherwise the browser would be stuck on 401s (even for /logout).
+func (s *Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, fromCookie := sessionToken(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := auth.VerifySession(token)
+		if err == nil {
+			// the token can outlive the account, so check the user is still there (and pick up role changes)
+			var user store.User
+			user, err = s.users.GetUser(r.Context(), claims.UserID)
+			if err == nil {
+				setLogUser(r.Context(), user.ID)
+				ctx := context.WithValue(r.Context(), userKey, user)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			if !errors.Is(err, store.ErrNotFound) {
+				serverError(w, r, "Failed to load session user", err)
+				return
+			}
+			err = auth.ErrInvalidToken
+		}
+
+		if fromCookie {
+			clearSessionCookie(w, r)
+			next.ServeHTTP(w, r)
+			return
+		}
+		WriteError(w, r, APIError{Status: http.StatusUnauthorized, Code: "invalid_token", Message: "Session token is invalid or has expired, log in again"})
+	})
+}
+
+// sessionToken takes the token from the Authorization header first, then falls back to the cookie
+func sessionToken(r *http.Request) (token string, fromCookie bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token), false
+		}
+		return "", false
+	}
+
+	if cookie, err := r.Cookie(auth.CookieName); err == nil {
+		return cookie.Value, true
+	}
+	return "", false
+}
+
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// currentUser returns the logged in user, if there is one
+func currentUser(r *http.Request) (store.User, bool) {
+	user, ok := r.Context().Value(userKey).(store.User)
+	return user, ok
+}
+
+// requireUser is for handlers that need someone to be logged in, it writes the 401 itself
+func requireUser(w http.ResponseWriter, r *http.Request) (store.User, bool) {
+	user, ok := currentUser(r)
+	if !ok {
+		WriteError(w, r, errLoginRequired)
+	}
+	return user, ok
+}
+
+// checkCreatedBy rejects bodies that still send a created_by for someone other than the logged in user.
+// Leaving created_by out (or sending your own ID) is fine.
+func checkCreatedBy(w http.ResponseWriter, r *http.Request, createdBy int, user store.User) bool {
+	if createdBy != 0 && createdBy != user.ID {
+		WriteError(w, r, forbidden("created_by must be left out or match the logged in user"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/auth"
+)
+
+func TestAuthenticate(t *testing.T) {
+	auth.InitSessions(strings.Repeat("k", 32))
+	ts := newTestServer(t)
+	alice := ts.user("alice")
+	valid, _, err := auth.SignSession(alice.ID)
+	ts.check(err)
+	gone, _, err := auth.SignSession(999)
+	ts.check(err)
+
+	// the handler says who it was called for, if anyone
+	h := ts.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := currentUser(r); ok {
+			w.Write([]byte(user.Username))
+			return
+		}
+		w.Write([]byte("anonymous"))
+	}))
+
+	tests := []struct {
+		name        string
+		header      string
+		cookie      string
+		want        int
+		body        string
+		clearCookie bool
+	}{
+		{"no token", "", "", http.StatusOK, "anonymous", false},
+		{"valid bearer token", "Bearer " + valid, "", http.StatusOK, "alice", false},
+		{"valid cookie", "", valid, http.StatusOK, "alice", false},
+		{"bad bearer token", "Bearer " + valid + "x", "", http.StatusUnauthorized, `"code":"invalid_token"`, false},
+		{"bearer token of a deleted user", "Bearer " + gone, "", http.StatusUnauthorized, `"code":"invalid_token"`, false},
+		{"bad cookie", "", "junk", http.StatusOK, "anonymous", true},
+		{"cookie of a deleted user", "", gone, http.StatusOK, "anonymous", true},
+		// the header wins over the cookie
+		{"bad bearer token with a valid cookie", "Bearer junk", valid, http.StatusUnauthorized, `"code":"invalid_token"`, false},
+		{"other scheme", "Basic YWxpY2U6cHc=", valid, http.StatusOK, "anonymous", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/me", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: auth.CookieName, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.want || !strings.Contains(rec.Body.String(), tt.body) {
+				t.Errorf("got %d %s, want %d with %s", rec.Code, rec.Body, tt.want, tt.body)
+			}
+			cleared := false
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == auth.CookieName && c.MaxAge < 0 {
+					cleared = true
+				}
+			}
+			if cleared != tt.clearCookie {
+				t.Errorf("cookie cleared: %v, want %v", cleared, tt.clearCookie)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// the most ids POST /notifications/read takes at once
+const maxMarkRead = 100
+
+// what GET /notifications sends back, the usual list envelope plus the unread count for the badge
+type notificationList struct {
+	listResponse[store.Notification]
+	UnreadCount int `json:"unread_count"`
+}
+
+// notifyAbout logs a failed dispatcher call. The post or comment is saved by then, so missing
+// notifications aren't worth failing the request over.
+func notifyAbout(request *http.Request, what string, err error) {
+	if err != nil {
+		slog.ErrorContext(request.Context(), "failed to send notifications for new "+what,
+			slog.String("error", err.Error()), slog.String("request_id", RequestIDFrom(request.Context())))
+	}
+}
+
+// this func handles GET /notifications, newest first, ?unread=true leaves out the ones already read
+func (s *Server) GetNotifications(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
+	unreadOnly := false
+	if unreadStr := request.URL.Query().Get("unread"); unreadStr != "" {
+		var err error
+		unreadOnly, err = strconv.ParseBool(unreadStr)
+		if err != nil {
+			WriteError(writer, request, invalidField("unread", "unread must be true or false"))
+			return
+		}
+	}
+	p, ok := parsePage(writer, request, store.SortNew)
+	if !ok {
+		return
+	}
+
+	page, err := s.notes.ListNotifications(request.Context(), user.ID, unreadOnly, p)
+	if err != nil {
+		serverError(writer, request, "Failed to fetch notifications", err)
+		return
+	}
+	unread, err := s.notes.UnreadNotifications(request.Context(), user.ID)
+	if err != nil {
+		serverError(writer, request, "Failed to count notifications", err)
+		return
+	}
+
+	json.NewEncoder(writer).Encode(notificationList{newListResponse(store.SortNew, page), unread})
+}
+
+// this func handles POST /notifications/{id}/read
+func (s *Server) MarkNotificationRead(writer http.ResponseWriter, request *http.Request) {
+	notificationID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || notificationID <= 0 {
+		WriteError(writer, request, invalidID("notification"))
+		return
+	}
+
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
+	// someone else's notification is a 404 too, no need to tell them it exists
+	err = s.notes.MarkNotificationRead(request.Context(), user.ID, notificationID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("notification"))
+		return
+	} else if err != nil {
+		serverError(writer, request, "Failed to mark notification read", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// this func handles POST /notifications/read, with {"ids": [...]} for some or {"all": true} for everything
+func (s *Server) MarkNotificationsRead(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		IDs []int `json:"ids"`
+		All bool  `json:"all"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {
+		WriteError(writer, request, errInvalidJSON)
+		return
+	}
+	// exactly one of the two, so an empty body can't clear everything by accident
+	if input.All == (input.IDs != nil) {
+		WriteError(writer, request, invalidField("ids", "Send either ids or all, not both or neither"))
+		return
+	}
+	if len(input.IDs) > maxMarkRead {
+		WriteError(writer, request, invalidField("ids", "At most 100 ids at a time"))
+		return
+	}
+	if slices.ContainsFunc(input.IDs, func(id int) bool { return id <= 0 }) {
+		WriteError(writer, request, invalidField("ids", "ids must be positive notification IDs"))
+		return
+	}
+
+	var ids []int
+	if !input.All {
+		ids = input.IDs
+	}
+	marked, err := s.notes.MarkNotificationsRead(request.Context(), user.ID, ids)
+	if err != nil {
+		serverError(writer, request, "Failed to mark notifications read", err)
+		return
+	}
+	unread, err := s.notes.UnreadNotifications(request.Context(), user.ID)
+	if err != nil {
+		serverError(writer, request, "Failed to count notifications", err)
+		return
+	}
+
+	json.NewEncoder(writer).Encode(map[string]int{"marked": marked, "unread_count": unread})
+}
+
+// this func handles GET /notifications/preferences, every type with whether it is on
+func (s *Server) GetNotificationPreferences(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
+	prefs, err := s.notes.NotificationPreferences(request.Context(), user.ID)
+	if err != nil {
+		serverError(writer, request, "Failed to fetch notification preferences", err)
+		return
+	}
+	json.NewEncoder(writer).Encode(prefs)
+}
+
+// this func handles PUT /notifications/preferences. Only the types in the body change,
+// e.g. {"new_post": false}, and all of them are sent back.
+func (s *Server) UpdateNotificationPreferences(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
+	var input map[string]bool
+	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {
+		WriteError(writer, request, errInvalidJSON)
+		return
+	}
+	var problems []FieldError
+	for typ := range input {
+		if !slices.Contains(store.NotificationTypes, typ) {
+			problems = append(problems, FieldError{Field: typ, Message: "Unknown notification type " + typ})
+		}
+	}
+	if problems != nil {
+		slices.SortFunc(problems, func(a, b FieldError) int { return strings.Compare(a.Field, b.Field) })
+		WriteError(writer, request, invalidFields(problems...))
+		return
+	}
+
+	if err := s.notes.SetNotificationPreferences(request.Context(), user.ID, input); err != nil {
+		serverError(writer, request, "Failed to save notification preferences", err)
+		return
+	}
+	s.GetNotificationPreferences(writer, request)
+}
+
+// this func handles PUT /topics/{id}/follow, new posts in the topic then show up in your notifications
+func (s *Server) FollowTopic(writer http.ResponseWriter, request *http.Request) {
+	s.setFollow(writer, request, "topic", s.notes.FollowTopic)
+}
+
+// this func handles DELETE /topics/{id}/follow
+func (s *Server) UnfollowTopic(writer http.ResponseWriter, request *http.Request) {
+	s.setFollow(writer, request, "topic", s.notes.UnfollowTopic)
+}
+
+// this func handles PUT /posts/{id}/follow, new comments on the post then show up in your notifications
+func (s *Server) FollowPost(writer http.ResponseWriter, request *http.Request) {
+	s.setFollow(writer, request, "post", s.notes.FollowPost)
+}
+
+// this func handles DELETE /posts/{id}/follow
+func (s *Server) UnfollowPost(writer http.ResponseWriter, request *http.Request) {
+	s.setFollow(writer, request, "post", s.notes.UnfollowPost)
+}
+
+// setFollow runs follow or unfollow for the logged in user and the {id} in the path.
+// Both can be repeated, so they answer 204 whether anything changed or not.
+func (s *Server) setFollow(writer http.ResponseWriter, request *http.Request, targetType string, change func(ctx context.Context, userID, targetID int) error) {
+	targetID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || targetID <= 0 {
+		WriteError(writer, request, invalidID(targetType))
+		return
+	}
+
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
+	err = change(request.Context(), user.ID, targetID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound(targetType))
+		return
+	} else if err != nil {
+		serverError(writer, request, "Failed to update "+targetType+" follow", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func TestNotifications(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mux.HandleFunc("POST /topics/{id}/posts", ts.CreatePost)
+	ts.mux.HandleFunc("POST /posts/{id}/comments", ts.CreateComment)
+	ts.mux.HandleFunc("GET /notifications", ts.GetNotifications)
+	ts.mux.HandleFunc("POST /notifications/read", ts.MarkNotificationsRead)
+	ts.mux.HandleFunc("POST /notifications/{id}/read", ts.MarkNotificationRead)
+	ts.mux.HandleFunc("PUT /notifications/preferences", ts.UpdateNotificationPreferences)
+	ts.mux.HandleFunc("PUT /topics/{id}/follow", ts.FollowTopic)
+
+	alice := ts.user("alice")
+	bob := ts.user("bob")
+	topic := ts.topic("Golang", alice)
+
+	send := ts.send
+	list := func(user store.User, query string) notificationList {
+		t.Helper()
+		rec := send(user, http.MethodGet, "/notifications"+query, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /notifications%s: got %d %s", query, rec.Code, rec.Body)
+		}
+		return decode[notificationList](t, rec)
+	}
+
+	if rec := send(alice, http.MethodPut, "/topics/"+strconv.Itoa(topic.ID)+"/follow", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("follow got %d %s", rec.Code, rec.Body)
+	}
+	if rec := send(alice, http.MethodPut, "/topics/999/follow", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("following a missing topic got %d, want 404", rec.Code)
+	}
+
+	// bob posts in the topic alice follows, alice comments on it and bob hears back
+	rec := send(bob, http.MethodPost, "/topics/"+strconv.Itoa(topic.ID)+"/posts", `{"title": "Channels", "body": "hi @alice"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create post got %d %s", rec.Code, rec.Body)
+	}
+	post := decode[store.Post](t, rec)
+	rec = send(alice, http.MethodPost, "/posts/"+strconv.Itoa(post.ID)+"/comments", `{"body": "thanks"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create comment got %d %s", rec.Code, rec.Body)
+	}
+
+	got := list(alice, "")
+	if got.UnreadCount != 1 || len(got.Items) != 1 || got.Items[0].Type != store.NotifyMention || got.Items[0].ActorID != bob.ID {
+		t.Fatalf("alice got %+v", got)
+	}
+	if got := list(bob, ""); got.UnreadCount != 1 || got.Items[0].Type != store.NotifyReply {
+		t.Fatalf("bob got %+v", got)
+	}
+
+	// alice can't mark bob's notification, then marks her own
+	bobsID := strconv.Itoa(list(bob, "").Items[0].ID)
+	if rec := send(alice, http.MethodPost, "/notifications/"+bobsID+"/read", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("marking someone else's notification got %d", rec.Code)
+	}
+	alicesID := strconv.Itoa(got.Items[0].ID)
+	if rec := send(alice, http.MethodPost, "/notifications/"+alicesID+"/read", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("marking got %d %s", rec.Code, rec.Body)
+	}
+	if got := list(alice, "?unread=true"); got.UnreadCount != 0 || len(got.Items) != 0 {
+		t.Errorf("after marking alice still has %+v", got)
+	}
+	if got := list(alice, ""); len(got.Items) != 1 || got.Items[0].ReadAt == nil {
+		t.Errorf("the read notification should still be listed with read_at, got %+v", got)
+	}
+
+	// bulk needs exactly one of ids and all
+	for _, body := range []string{`{}`, `{"ids": [1], "all": true}`, `{"ids": [0]}`} {
+		if rec := send(bob, http.MethodPost, "/notifications/read", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s got %d, want 400", body, rec.Code)
+		}
+	}
+	rec = send(bob, http.MethodPost, "/notifications/read", `{"all": true}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"marked":1`) || !strings.Contains(rec.Body.String(), `"unread_count":0`) {
+		t.Errorf("mark all got %d %s", rec.Code, rec.Body)
+	}
+
+	rec = send(alice, http.MethodPut, "/notifications/preferences", `{"mention": false, "likes": true}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"field":"likes"`) {
+		t.Errorf("unknown type got %d %s", rec.Code, rec.Body)
+	}
+	rec = send(alice, http.MethodPut, "/notifications/preferences", `{"mention": false}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"mention":false`) || !strings.Contains(rec.Body.String(), `"reply":true`) {
+		t.Errorf("update got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// listResponse is the envelope every paginated listing returns.
+// NextCursor is null on the last page, otherwise pass it back as ?cursor= to get the next one.
+type listResponse[T any] struct {
+	Items      []T     `json:"items"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// parsePage reads limit and cursor from the query string, writes the 400 itself if they are bad
+func parsePage(writer http.ResponseWriter, request *http.Request, sort store.Sort) (store.PageRequest, bool) {
+	limit, ok := parseLimit(writer, request)
+	if !ok {
+		return store.PageRequest{}, false
+	}
+	p := store.PageRequest{Limit: limit}
+
+	if cursorStr := request.URL.Query().Get("cursor"); cursorStr != "" {
+		c, ok := decodeCursor(cursorStr, sort)
+		if !ok {
+			WriteError(writer, request, invalidField("cursor", "Invalid cursor"))
+			return p, false
+		}
+		p.After = &c
+	}
+
+	return p, true
+}
+
+// parseLimit reads ?limit=, defaulting to defaultPageSize
+func parseLimit(writer http.ResponseWriter, request *http.Request) (int, bool) {
+	limitStr := request.URL.Query().Get("limit")
+	if limitStr == "" {
+		return defaultPageSize, true
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 || limit > maxPageSize {
+		WriteError(writer, request, invalidField("limit", "limit must be between 1 and 100"))
+		return 0, false
+	}
+	return limit, true
+}
+
+// encodeCursor makes the opaque ?cursor= value. A store.Cursor is the sort value and id of the last row
+// on the page, the sort name goes in too since a cursor from one sort order means nothing in another.
+func encodeCursor(sort store.Sort, c store.Cursor) string {
+	raw := string(sort) + "|" + c.Key + "|" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string, sort store.Sort) (store.Cursor, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return store.Cursor{}, false
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || parts[0] != string(sort) {
+		return store.Cursor{}, false
+	}
+
+	// the key has to look like whatever the sort column holds
+	if sort.Numeric() {
+		if _, err := strconv.ParseFloat(parts[1], 64); err != nil {
+			return store.Cursor{}, false
+		}
+	} else if _, err := time.Parse(store.TimeFormat, parts[1]); err != nil {
+		return store.Cursor{}, false
+	}
+
+	id, err := strconv.Atoi(parts[2])
+	if err != nil || id <= 0 {
+		return store.Cursor{}, false
+	}
+	return store.Cursor{Key: parts[1], ID: id}, true
+}
+
+// newListResponse turns a page from the store into the JSON envelope
+func newListResponse[T any](sort store.Sort, page store.Page[T]) listResponse[T] {
+	resp := listResponse[T]{Items: page.Items}
+	if page.Next != nil {
+		next := encodeCursor(sort, *page.Next)
+		resp.NextCursor = &next
+	}
+	return resp
+}
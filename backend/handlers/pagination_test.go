@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func TestCursors(t *testing.T) {
+	for _, tt := range []struct {
+		sort store.Sort
+		c    store.Cursor
+	}{
+		{store.SortNew, store.Cursor{Key: "2024-03-01 12:30:00", ID: 7}},
+		{store.SortOld, store.Cursor{Key: "2024-03-01 12:30:00", ID: 1}},
+		{store.SortTop, store.Cursor{Key: "-3", ID: 12}},
+		{store.SortHot, store.Cursor{Key: "1.5e+06", ID: 99}},
+	} {
+		got, ok := decodeCursor(encodeCursor(tt.sort, tt.c), tt.sort)
+		if !ok || got != tt.c {
+			t.Errorf("%s: %+v came back as %+v, %v", tt.sort, tt.c, got, ok)
+		}
+	}
+
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	for _, tt := range []struct {
+		name   string
+		cursor string
+		sort   store.Sort
+	}{
+		{"not base64", "!!!", store.SortNew},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte("new|2024-03-01 12:30:00|7")), store.SortNew},
+		{"too few parts", raw("new|7"), store.SortNew},
+		{"too many parts", raw("new|2024-03-01 12:30:00|7|8"), store.SortNew},
+		{"from another sort", raw("new|2024-03-01 12:30:00|7"), store.SortOld},
+		{"time for a numeric sort", raw("top|2024-03-01 12:30:00|7"), store.SortTop},
+		{"number for a time sort", raw("new|42|7"), store.SortNew},
+		{"bad time", raw("new|2024-03-01T12:30:00Z|7"), store.SortNew},
+		{"id 0", raw("new|2024-03-01 12:30:00|0"), store.SortNew},
+		{"id not a number", raw("top|3|x"), store.SortTop},
+	} {
+		if c, ok := decodeCursor(tt.cursor, tt.sort); ok {
+			t.Errorf("%s: decoded to %+v", tt.name, c)
+		}
+	}
+}
+
+func TestPaging(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mux.HandleFunc("GET /topics", ts.GetTopics)
+
+	alice := ts.user("alice")
+	for i := 1; i <= 5; i++ {
+		ts.topic("Topic "+strconv.Itoa(i), alice)
+	}
+
+	// two at a time oldest first gives every topic once, the last page says there is no next one
+	var titles []string
+	path := "/topics?sort=old&limit=2"
+	for pages := 1; ; pages++ {
+		rec := ts.send(store.User{}, http.MethodGet, path, "")
+		got := decode[listResponse[store.Topic]](t, rec)
+		if rec.Code != http.StatusOK || len(got.Items) > 2 {
+			t.Fatalf("page %d got %d %s", pages, rec.Code, rec.Body)
+		}
+		for _, topic := range got.Items {
+			titles = append(titles, topic.Title)
+		}
+		if got.NextCursor == nil {
+			if pages != 3 {
+				t.Errorf("got %d pages, want 3", pages)
+			}
+			break
+		}
+		if pages == 3 {
+			t.Fatal("the last page has a next_cursor")
+		}
+		path = "/topics?sort=old&limit=2&cursor=" + *got.NextCursor
+	}
+	if len(titles) != 5 || titles[0] != "Topic 1" || titles[4] != "Topic 5" {
+		t.Errorf("got %v", titles)
+	}
+
+	// the default page fits them all and has no cursor, which still comes out as null
+	rec := ts.send(store.User{}, http.MethodGet, "/topics", "")
+	if got := decode[map[string]any](t, rec); len(got["items"].([]any)) != 5 || got["next_cursor"] != nil {
+		t.Errorf("default page got %s", rec.Body)
+	}
+
+	first := decode[listResponse[store.Topic]](t, ts.send(store.User{}, http.MethodGet, "/topics?sort=new&limit=1", ""))
+	for _, tt := range []struct {
+		query, field string
+	}{
+		{"?limit=0", "limit"},
+		{"?limit=101", "limit"},
+		{"?limit=x", "limit"},
+		{"?cursor=junk", "cursor"},
+		// a cursor only works with the sort it came from
+		{"?sort=old&cursor=" + *first.NextCursor, "cursor"},
+	} {
+		rec := ts.send(store.User{}, http.MethodGet, "/topics"+tt.query, "")
+		got := decode[errorResponse](t, rec)
+		if rec.Code != http.StatusBadRequest || len(got.Error.Details) != 1 || got.Error.Details[0].Field != tt.field {
+			t.Errorf("%q: got %d %s", tt.query, rec.Code, rec.Body)
+		}
+	}
+	if rec := ts.send(store.User{}, http.MethodGet, "/topics?sort=new&limit=100&cursor="+*first.NextCursor, ""); rec.Code != http.StatusOK ||
+		len(decode[listResponse[store.Topic]](t, rec).Items) != 4 {
+		t.Errorf("the rest after the first page got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -1,117 +1,88 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
-	"time"
 
-	"github.com/archonward/CampusCommons/backend/database"
+	"github.com/archonward/CampusCommons/backend/events"
+	"github.com/archonward/CampusCommons/backend/metrics"
+	"github.com/archonward/CampusCommons/backend/store"
 )
 
-type Post struct {
-	ID       int       `json:"id"`
-	TopicID  int       `json:"topic_id"`
-	Title    string    `json:"title"`
-	Body     string    `json:"body"`
-	CreatedBy int      `json:"created_by"`
-	CreatedAt time.Time `json:"created_at"`
-}
-
-// this func handles GET /topics/id/posts
-func GetPostsByTopic(writer http.ResponseWriter, request *http.Request) {
+// this func handles GET /topics/id/posts, sorted with ?sort= and paginated with ?limit= and ?cursor=
+func (s *Server) GetPostsByTopic(writer http.ResponseWriter, request *http.Request) {
 	writer.Header().Set("Content-Type", "application/json")
 
 	// extract topic ID from URL path
 	topicIDStr := request.PathValue("id")
 	if topicIDStr == "" {
-		http.Error(writer, "topic ID is required", http.StatusBadRequest)
+		WriteError(writer, request, invalidID("topic"))
 		return
 	}
 
 	topicID, err := strconv.Atoi(topicIDStr)	// convert to int
 	if err != nil || topicID <= 0 {
-		http.Error(writer, "Invalid topic ID", http.StatusBadRequest)
+		WriteError(writer, request, invalidID("topic"))
 		return
 	}
 
 	// Check if topic exists first
-	var exists bool
-	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM topics WHERE id = ?)", topicID).Scan(&exists)
-	// standard SQL query to check for presence of topic
-	if err != nil {
-		log.Printf("Error checking topic existence: %v", err)
-		http.Error(writer, "Database error", http.StatusInternalServerError)
+	_, err = s.topics.GetTopic(request.Context(), topicID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("topic"))	//send to react
 		return
-	}
-	if !exists {
-		http.Error(writer, "Topic not found", http.StatusNotFound)	//send to react
+	} else if err != nil {
+		serverError(writer, request, "Error checking topic existence", err)
 		return
 	}
 
-	// Fetch all posts under the topic, starting from the oldest
-	rows, err := database.DB.Query(`SELECT id, topic_id, title, body, created_by, created_at
-		FROM posts
-		WHERE topic_id = ?
-		ORDER BY created_at ASC`, topicID)
-
-	if err != nil {
-		log.Printf("fail to fetch posts: %v", err)
-		http.Error(writer, "failed to fetch posts", http.StatusInternalServerError)	//send to react
+	// ?sort=old (the default), new, top, hot or controversial, with ?t= for top and controversial
+	sort, ok := parseSort(writer, request, postSorts, store.SortOld)
+	if !ok {
+		return
+	}
+	since, ok := parseWindow(writer, request, sort)
+	if !ok {
 		return
 	}
-	// close rows when done to avoid leaking DB resources
-	defer rows.Close()
 
-	postList := []Post{}	
-	for rows.Next() {	// loop runs once per row, then moves onto next
-		var p Post
-		err := rows.Scan(&p.ID, &p.TopicID, &p.Title, &p.Body, &p.CreatedBy, &p.CreatedAt)
-		if err != nil {
-			// if scanning fails, return 500
-			log.Printf("row error: %v", err)
-			http.Error(writer, "parsing error", http.StatusInternalServerError)	// send the http error back to react
-			return
-		}
-		postList = append(postList, p)	// add the Post to the list
+	p, ok := parsePage(writer, request, sort)
+	if !ok {
+		return
 	}
-	
-	err = rows.Err();
+
+	// Fetch a page of posts under the topic, the store does all the sorting
+	posts, err := s.posts.ListPosts(request.Context(), topicID, sort, since, p, viewerID(request))
 	if err != nil {
-		log.Printf("rows iteration error: %v", err)
-		http.Error(writer, "retrieval error", http.StatusInternalServerError)
+		serverError(writer, request, "fail to fetch posts", err)	//send to react
 		return
 	}
 
-	json.NewEncoder(writer).Encode(postList)	// converts the list of Post into JSON, writes direct to ResponseWriter
+	// converts the page of Posts into JSON, writes direct to ResponseWriter
+	json.NewEncoder(writer).Encode(newListResponse(sort, posts))
 }
 
-func GetPostByID(writer http.ResponseWriter, request *http.Request) {
+func (s *Server) GetPostByID(writer http.ResponseWriter, request *http.Request) {
 	writer.Header().Set("Content-Type", "application/json")	// tell client response will be JSON
 
 	postIDStr := request.PathValue("id")
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil || postID <= 0 {
-		http.Error(writer, "Invalid post ID", http.StatusBadRequest)
+		WriteError(writer, request, invalidID("post"))
 		return
 	}
 
-	var p Post
 	//query for a single post by ID
-	err = database.DB.QueryRow(`
-		SELECT id, topic_id, title, body, created_by, created_at
-		FROM posts
-		WHERE id = ?
-	`, postID).Scan(&p.ID, &p.TopicID, &p.Title, &p.Body, &p.CreatedBy, &p.CreatedAt)
-
-	if err == sql.ErrNoRows {
-		http.Error(writer, "Post not found", http.StatusNotFound)
+	p, err := s.posts.GetPost(request.Context(), postID, viewerID(request))
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("post"))
 		return
 	} else if err != nil {
-		log.Printf("Failed to fetch post: %v", err)
-		http.Error(writer, "Database error", http.StatusInternalServerError)
+		serverError(writer, request, "Failed to fetch post", err)
 		return
 	}
 
@@ -119,35 +90,28 @@ func GetPostByID(writer http.ResponseWriter, request *http.Request) {
 }
 
 // this func handles POST /topics/id/posts
-func CreatePost(writer http.ResponseWriter, request *http.Request) {
+func (s *Server) CreatePost(writer http.ResponseWriter, request *http.Request) {
 	writer.Header().Set("Content-Type", "application/json")
 
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
 	// Extract topic ID from URL
 	topicIDStr := request.PathValue("id")
 	if topicIDStr == "" {
-		http.Error(writer, "topic ID is required", http.StatusBadRequest)
+		WriteError(writer, request, invalidID("topic"))
 		return
 	}
 
 	topicID, err := strconv.Atoi(topicIDStr)
 	if err != nil || topicID <= 0 {
-		http.Error(writer, "invalid ID", http.StatusBadRequest)
-		return
-	}
-
-	var exists bool
-	err = database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM topics WHERE id = ?)", topicID).Scan(&exists)
-	if err != nil {
-		log.Printf("error checking existence of topic: %v", err)
-		http.Error(writer, "database error", http.StatusInternalServerError)
-		return
-	}
-	if !exists {
-		http.Error(writer, "topic not found", http.StatusNotFound)
+		WriteError(writer, request, invalidID("topic"))
 		return
 	}
 
-	// expected JSON body for creeating post
+	// expected JSON body for creeating post, created_by is optional since the author comes from the session
 	var input struct {
 		Title     string `json:"title"`
 		Body      string `json:"body"`
@@ -156,105 +120,93 @@ func CreatePost(writer http.ResponseWriter, request *http.Request) {
 
 	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {
 		log.Printf("invalid JSON: %v", err)
-		http.Error(writer, "invalid JSON payload", http.StatusBadRequest)
+		WriteError(writer, request, errInvalidJSON)
 		return
 	}
 
 	if input.Title == "" {
-		http.Error(writer, "title can't be empty", http.StatusBadRequest)
+		WriteError(writer, request, invalidField("title", "Title is required"))
 		return
 	}
 	if input.Body == "" {
-		http.Error(writer, "body can't be empty", http.StatusBadRequest)
+		WriteError(writer, request, invalidField("body", "Body is required"))
 		return
 	}
-	if input.CreatedBy <= 0 {
-		http.Error(writer, "valid created_by user ID is required", http.StatusBadRequest)
+	if !checkCreatedBy(writer, request, input.CreatedBy, user) {
 		return
 	}
 
-	// insert post
-	result, err := database.DB.Exec(`INSERT INTO posts (topic_id, title, body, created_by)
-		VALUES (?, ?, ?, ?)`, topicID, input.Title, input.Body, input.CreatedBy) //SQL INSERT to create a new row
-
-	if err != nil {
-		log.Printf("Failed to create post: %v", err)
-		http.Error(writer, "Failed to create post", http.StatusInternalServerError)
-		return
-	}
-	
-	// get the auto generated post ID from database
-	postID, err := result.LastInsertId()
-	if err != nil {
-		log.Printf("failed to get post ID: %v", err)
-		http.Error(writer, "failed to get post ID", http.StatusInternalServerError)
+	// insert post, the store checks the topic is still there
+	post, err := s.posts.CreatePost(request.Context(), topicID, input.Title, input.Body, user.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("topic"))
 		return
-	}
-
-	// Read the inserted post back from the database so we can return it as JSON.
-	var post Post
-	row := database.DB.QueryRow(`
-		SELECT id, topic_id, title, body, created_by, created_at
-		FROM posts
-		WHERE id = ?
-	`, postID)	// using WHERE id = ? so that we will take in the row with all the fields updated by the database
-	err = row.Scan(&post.ID, &post.TopicID, &post.Title, &post.Body, &post.CreatedBy, &post.CreatedAt)
-
-	if err != nil {
-		log.Printf("failed to fetch created post: %v", err)
-		http.Error(writer, "failed to retrieve created post", http.StatusInternalServerError)
+	} else if err != nil {
+		serverError(writer, request, "Failed to create post", err)
 		return
 	}
 
+	metrics.PostsCreated.Inc()
+	notifyAbout(request, "post", s.notifier.PostCreated(context.WithoutCancel(request.Context()), post))
+	s.publishPost("post.created", post)
 	writer.WriteHeader(http.StatusCreated)
 	json.NewEncoder(writer).Encode(post)
 }
 
 // this func handles DELETE /posts/{id}
-func DeletePost(writer http.ResponseWriter, request *http.Request) {
+func (s *Server) DeletePost(writer http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodDelete {
-		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
+		WriteError(writer, request, errMethodNotAllowed)
 		return
 	}
 
 	postIDStr := request.PathValue("id")
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil || postID <= 0 {
-		http.Error(writer, "Invalid post ID", http.StatusBadRequest)
+		WriteError(writer, request, invalidID("post"))
 		return
 	}
 
-	// start off, delete all comments under this post
-	_, err = database.DB.Exec(`DELETE FROM comments 
-		WHERE post_id = ?`, postID)
-	if err != nil {
-		log.Printf("failed to delete comments: %v", err)
-		http.Error(writer, "failed to delete comments", http.StatusInternalServerError)
+	user, ok := requireUser(writer, request)
+	if !ok {
 		return
 	}
 
-	// Then, delete the post
-	result, err := database.DB.Exec(`DELETE FROM posts 
-		WHERE id = ?`, postID)
+	// the author, an admin or a moderator of the topic can remove a post
+	authorID, topicID, ok := s.postAuthor(writer, request, postID)
+	if !ok {
+		return
+	}
+	allowed, err := s.canModerate(request.Context(), user, authorID, topicID)
 	if err != nil {
-		log.Printf("failed to delete post: %v", err)
-		http.Error(writer, "failed to delete post", http.StatusInternalServerError)
+		serverError(writer, request, "failed to check moderator", err)
+		return
+	}
+	if !allowed {
+		WriteError(writer, request, forbidden("Only the author of this post, a moderator of this topic or an admin can delete it"))
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(writer, "post does not exist", http.StatusNotFound)
+	// the comments, their revisions and every vote go with the post
+	err = s.posts.DeletePost(request.Context(), postID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("post"))
+		return
+	} else if err != nil {
+		serverError(writer, request, "failed to delete post", err)
 		return
 	}
+	deleted := map[string]int{"id": postID, "topic_id": topicID}
+	s.events.Publish(events.TopicChannel(topicID), "post.deleted", deleted)
+	s.events.PublishLast(events.PostChannel(postID), "post.deleted", deleted)
 
 	writer.WriteHeader(http.StatusNoContent) // 204
 }
 
 // this func handles PUT /posts/{id}
-func UpdatePost(writer http.ResponseWriter, request *http.Request) {
+func (s *Server) UpdatePost(writer http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodPut {
-		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		WriteError(writer, request, errMethodNotAllowed)
 		return
 	}
 
@@ -262,18 +214,21 @@ func UpdatePost(writer http.ResponseWriter, request *http.Request) {
 	postIDStr := request.PathValue("id")	
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil || postID <= 0 {
-		http.Error(writer, "invalid post ID", http.StatusBadRequest)
+		WriteError(writer, request, invalidID("post"))
 		return
 	}
 
-	var existingTitle string
-	err = database.DB.QueryRow("SELECT title FROM posts WHERE id = ?", postID).Scan(&existingTitle)
-	if err == sql.ErrNoRows {
-		http.Error(writer, "post not found", http.StatusNotFound)
+	user, ok := requireUser(writer, request)
+	if !ok {
 		return
-	} else if err != nil {
-		log.Printf("DB error checking post: %v", err)
-		http.Error(writer, "Server error", http.StatusInternalServerError)
+	}
+
+	authorID, _, ok := s.postAuthor(writer, request, postID)
+	if !ok {
+		return
+	}
+	if !canEdit(user, authorID) {
+		WriteError(writer, request, forbidden("Only the author of this post or an admin can edit it"))
 		return
 	}
 
@@ -283,35 +238,32 @@ func UpdatePost(writer http.ResponseWriter, request *http.Request) {
 		Body  string `json:"body"`
 	}
 	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {	// parsing
-		http.Error(writer, "Invalid JSON", http.StatusBadRequest)
+		WriteError(writer, request, errInvalidJSON)
 		return
 	}
 
-	if input.Title == "" || input.Body == "" {
-		http.Error(writer, "title and body are required", http.StatusBadRequest)
-		return
+	var problems []FieldError
+	if input.Title == "" {
+		problems = append(problems, FieldError{Field: "title", Message: "Title is required"})
 	}
-
-
-	_, err = database.DB.Exec(`UPDATE posts 
-		SET title = ?, body = ? 
-		WHERE id = ?`, input.Title, input.Body, postID)			// update row
-	if err != nil {
-		log.Printf("failed to update post: %v", err)
-		http.Error(writer, "failed to update post", http.StatusInternalServerError)
+	if input.Body == "" {
+		problems = append(problems, FieldError{Field: "body", Message: "Body is required"})
+	}
+	if len(problems) > 0 {
+		WriteError(writer, request, invalidFields(problems...))
 		return
 	}
 
-	var updatedPost Post
-	err = database.DB.QueryRow(`SELECT id, topic_id, title, body, created_by, created_at
-		FROM posts
-		WHERE id = ?`, postID).Scan(&updatedPost.ID, &updatedPost.TopicID, &updatedPost.Title, &updatedPost.Body, &updatedPost.CreatedBy, &updatedPost.CreatedAt)
 
-	if err != nil {
-		log.Printf("failed to fetch post: %v", err)
-		http.Error(writer, "failed to fetch post", http.StatusInternalServerError)
+	updatedPost, err := s.posts.UpdatePost(request.Context(), postID, input.Title, input.Body, user.ID)	// update row
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("post"))
+		return
+	} else if err != nil {
+		serverError(writer, request, "failed to update post", err)
 		return
 	}
+	s.publishPost("post.updated", updatedPost)
 
 	json.NewEncoder(writer).Encode(updatedPost)
 }
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func TestPostCRUD(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mux.HandleFunc("GET /topics/{id}/posts", ts.GetPostsByTopic)
+	ts.mux.HandleFunc("POST /topics/{id}/posts", ts.CreatePost)
+	ts.mux.HandleFunc("GET /posts/{id}", ts.GetPostByID)
+	ts.mux.HandleFunc("PUT /posts/{id}", ts.UpdatePost)
+	ts.mux.HandleFunc("DELETE /posts/{id}", ts.DeletePost)
+
+	alice := ts.user("alice")
+	bob := ts.user("bob")
+	topic := ts.topic("Golang", alice)
+	postsPath := "/topics/" + strconv.Itoa(topic.ID) + "/posts"
+
+	rec := ts.send(bob, http.MethodPost, postsPath, `{"title": "Channels", "body": "buffered or not?"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create got %d %s", rec.Code, rec.Body)
+	}
+	post := decode[store.Post](t, rec)
+	if post.ID == 0 || post.TopicID != topic.ID || post.CreatedBy != bob.ID || post.Body != "buffered or not?" {
+		t.Errorf("created %+v", post)
+	}
+	path := "/posts/" + strconv.Itoa(post.ID)
+
+	for _, tt := range []struct {
+		name, path, body string
+		user             store.User
+		want             int
+		field            string
+	}{
+		{"logged out", postsPath, `{"title": "a", "body": "b"}`, store.User{}, http.StatusUnauthorized, ""},
+		{"no title", postsPath, `{"body": "b"}`, bob, http.StatusBadRequest, "title"},
+		{"no body", postsPath, `{"title": "a"}`, bob, http.StatusBadRequest, "body"},
+		{"missing topic", "/topics/999/posts", `{"title": "a", "body": "b"}`, bob, http.StatusNotFound, ""},
+		{"bad topic ID", "/topics/x/posts", `{"title": "a", "body": "b"}`, bob, http.StatusBadRequest, ""},
+		{"someone else's created_by", postsPath, `{"title": "a", "body": "b", "created_by": ` + strconv.Itoa(alice.ID) + `}`, bob, http.StatusForbidden, ""},
+	} {
+		rec := ts.send(tt.user, http.MethodPost, tt.path, tt.body)
+		if rec.Code != tt.want || (tt.field != "" && !strings.Contains(rec.Body.String(), `"field":"`+tt.field+`"`)) {
+			t.Errorf("%s: got %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	if got := decode[store.Post](t, ts.send(store.User{}, http.MethodGet, path, "")); got.ID != post.ID || got.Title != "Channels" {
+		t.Errorf("get got %+v", got)
+	}
+	list := decode[listResponse[store.Post]](t, ts.send(store.User{}, http.MethodGet, postsPath, ""))
+	if len(list.Items) != 1 || list.Items[0].ID != post.ID {
+		t.Errorf("listed %+v", list)
+	}
+
+	// both fields are reported at once
+	rec = ts.send(bob, http.MethodPut, path, `{"title": "", "body": ""}`)
+	if e := decode[errorResponse](t, rec).Error; rec.Code != http.StatusBadRequest || len(e.Details) != 2 {
+		t.Errorf("empty update got %d %+v", rec.Code, e)
+	}
+	rec = ts.send(bob, http.MethodPut, path, `{"title": "Channels", "body": "buffered, it turns out"}`)
+	if got := decode[store.Post](t, rec); rec.Code != http.StatusOK || got.Body != "buffered, it turns out" || got.EditedAt == nil {
+		t.Errorf("update got %d %+v", rec.Code, got)
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/posts/999", http.StatusNotFound},
+		{http.MethodPut, "/posts/999", http.StatusNotFound},
+		{http.MethodDelete, "/posts/999", http.StatusNotFound},
+		{http.MethodGet, "/posts/-1", http.StatusBadRequest},
+		{http.MethodGet, "/topics/999/posts", http.StatusNotFound},
+	} {
+		if rec := ts.send(bob, tt.method, tt.path, `{"title": "a", "body": "b"}`); rec.Code != tt.want {
+			t.Errorf("%s %s got %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+
+	if rec := ts.send(bob, http.MethodDelete, path, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete got %d %s", rec.Code, rec.Body)
+	}
+	if rec := ts.send(bob, http.MethodGet, path, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("the deleted post got %d", rec.Code)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/archonward/CampusCommons/backend/metrics"
+	"github.com/archonward/CampusCommons/backend/ratelimit"
+)
+
+// RateLimit takes a token for every request from the bucket of whoever sent it: the logged in user,
+// or the client IP when nobody is (and always for login and register, that is where guessing happens).
+// It goes inside Authenticate so it knows the user, and answers 429 rate_limited with Retry-After once a bucket is empty.
+func RateLimit(limiter *ratelimit.Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := ratelimit.Classify(r)
+		policy, ok := limiter.Policy(class)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := "ip:" + limiter.ClientIP(r)
+		if user, ok := currentUser(r); ok && class != ratelimit.Login {
+			key = "user:" + strconv.Itoa(user.ID)
+		}
+
+		res, err := limiter.Take(r.Context(), class, key)
+		if err != nil {
+			// a broken store shouldn't take the whole API down with it
+			slog.WarnContext(r.Context(), "rate limiter unavailable", slog.String("error", err.Error()), slog.String("request_id", RequestIDFrom(r.Context())))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ratelimit.SetHeaders(w.Header(), policy, res)
+		if !res.Allowed {
+			metrics.RateLimited.WithLabelValues(class).Inc()
+			WriteError(w, r, errRateLimited)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
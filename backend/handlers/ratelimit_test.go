@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/ratelimit"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func TestRateLimit(t *testing.T) {
+	limiter := ratelimit.New(ratelimit.NewMemoryStore(), map[string]ratelimit.Policy{
+		ratelimit.Login:  {Requests: 1, Per: time.Hour, Burst: 1},
+		ratelimit.Writes: {Requests: 1, Per: time.Hour, Burst: 2},
+	}, nil)
+	handler := RateLimit(limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(method, path, ip string, user *store.User) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.RemoteAddr = ip + ":1234"
+		if user != nil {
+			r = r.WithContext(context.WithValue(r.Context(), userKey, *user))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	alice := &store.User{ID: 1, Username: "alice"}
+	for i := range 2 {
+		if rec := send(http.MethodPost, "/topics", "192.0.2.1", alice); rec.Code != http.StatusOK {
+			t.Fatalf("write %d: got %d", i, rec.Code)
+		}
+	}
+	rec := send(http.MethodPost, "/topics", "192.0.2.1", alice)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("third write got %d, want 429", rec.Code)
+	}
+	h := rec.Header()
+	if h.Get("Retry-After") != "3600" || h.Get("RateLimit-Limit") != "2" || h.Get("RateLimit-Remaining") != "0" || h.Get("RateLimit-Policy") != "1;w=3600;burst=2" {
+		t.Errorf("unexpected headers %v", h)
+	}
+
+	// the same IP without the session is someone else
+	if rec := send(http.MethodPost, "/topics", "192.0.2.1", nil); rec.Code != http.StatusOK {
+		t.Errorf("anonymous write from alice's IP got %d", rec.Code)
+	}
+	// and reads have no policy here
+	if rec := send(http.MethodGet, "/topics", "192.0.2.1", alice); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("read got %d with headers %v", rec.Code, rec.Header())
+	}
+
+	// login goes by IP even for someone with a session
+	send(http.MethodPost, "/login", "192.0.2.9", nil)
+	if rec := send(http.MethodPost, "/login", "192.0.2.9", alice); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second login from the same IP got %d, want 429", rec.Code)
+	}
+}
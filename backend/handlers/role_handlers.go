@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// this func handles PUT /users/{id}/role, admins use it to hand out member/moderator/admin
+func (s *Server) UpdateUserRole(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	admin, ok := requireAdmin(writer, request)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || userID <= 0 {
+		WriteError(writer, request, invalidID("user"))
+		return
+	}
+	// stops the last admin from locking everyone out by accident
+	if userID == admin.ID {
+		WriteError(writer, request, forbidden("Admins can't change their own role"))
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {
+		WriteError(writer, request, errInvalidJSON)
+		return
+	}
+	if !validRole(input.Role) {
+		WriteError(writer, request, invalidField("role", "Role must be one of member, moderator or admin"))
+		return
+	}
+
+	user, err := s.users.SetRole(request.Context(), userID, input.Role)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("user"))
+		return
+	} else if err != nil {
+		serverError(writer, request, "failed to update role", err)
+		return
+	}
+
+	json.NewEncoder(writer).Encode(user)
+}
+
+// this func handles GET /topics/{id}/moderators
+func (s *Server) GetTopicModerators(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	topicID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || topicID <= 0 {
+		WriteError(writer, request, invalidID("topic"))
+		return
+	}
+	if _, ok := s.topicAuthor(writer, request, topicID); !ok {
+		return
+	}
+
+	// someone who lost the moderator role keeps their assignment, but isn't listed any more
+	moderators, err := s.topics.TopicModerators(request.Context(), topicID)
+	if err != nil {
+		serverError(writer, request, "failed to fetch moderators", err)
+		return
+	}
+
+	json.NewEncoder(writer).Encode(moderators)
+}
+
+// this func handles PUT /topics/{id}/moderators/{userID}, the user needs the moderator role already
+func (s *Server) AddTopicModerator(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := requireAdmin(writer, request); !ok {
+		return
+	}
+
+	topicID, userID, ok := moderatorPathIDs(writer, request)
+	if !ok {
+		return
+	}
+	if _, ok := s.topicAuthor(writer, request, topicID); !ok {
+		return
+	}
+
+	user, err := s.users.GetUser(request.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("user"))
+		return
+	} else if err != nil {
+		serverError(writer, request, "DB error checking user", err)
+		return
+	}
+	if user.Role != store.RoleModerator {
+		WriteError(writer, request, APIError{Status: http.StatusBadRequest, Code: "not_a_moderator", Message: "User needs the moderator role before they can be assigned to a topic"})
+		return
+	}
+
+	if err := s.topics.AddTopicModerator(request.Context(), topicID, userID); err != nil {
+		serverError(writer, request, "failed to add moderator", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// this func handles DELETE /topics/{id}/moderators/{userID}
+func (s *Server) RemoveTopicModerator(writer http.ResponseWriter, request *http.Request) {
+	if _, ok := requireAdmin(writer, request); !ok {
+		return
+	}
+
+	topicID, userID, ok := moderatorPathIDs(writer, request)
+	if !ok {
+		return
+	}
+
+	err := s.topics.RemoveTopicModerator(request.Context(), topicID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, APIError{Status: http.StatusNotFound, Code: "moderator_not_found", Message: "User is not a moderator of this topic"})
+		return
+	} else if err != nil {
+		serverError(writer, request, "failed to remove moderator", err)
+		return
+	}
+
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+func moderatorPathIDs(writer http.ResponseWriter, request *http.Request) (topicID, userID int, ok bool) {
+	topicID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || topicID <= 0 {
+		WriteError(writer, request, invalidID("topic"))
+		return 0, 0, false
+	}
+	userID, err = strconv.Atoi(request.PathValue("userID"))
+	if err != nil || userID <= 0 {
+		WriteError(writer, request, invalidID("user"))
+		return 0, 0, false
+	}
+	return topicID, userID, true
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// a query can't have more terms than this, keeps one request from running a huge MATCH
+const maxSearchTerms = 20
+
+// this func handles GET /search?q=...
+// Optional filters: type=topic,post,comment  topic_id=  author=<username>  from=  to=  (dates as YYYY-MM-DD or RFC3339)
+// Title and Snippet in the results are HTML escaped with the matched words wrapped in <mark>,
+// so the frontend can render them as they are.
+func (s *Server) Search(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	query := request.URL.Query()
+	q := store.SearchQuery{Terms: parseSearchTerms(query.Get("q"))}
+	if len(q.Terms) == 0 {
+		WriteError(writer, request, invalidField("q", "q must contain at least one word to search for"))
+		return
+	}
+
+	if typesStr := query.Get("type"); typesStr != "" {
+		for _, t := range strings.Split(typesStr, ",") {
+			if t != "topic" && t != "post" && t != "comment" {
+				WriteError(writer, request, invalidField("type", "type must be a comma separated list of topic, post and comment"))
+				return
+			}
+			q.Types = append(q.Types, t)
+		}
+	}
+
+	if topicStr := query.Get("topic_id"); topicStr != "" {
+		topicID, err := strconv.Atoi(topicStr)
+		if err != nil || topicID <= 0 {
+			WriteError(writer, request, invalidField("topic_id", "topic_id must be a positive number"))
+			return
+		}
+		q.TopicID = topicID
+	}
+
+	if author := query.Get("author"); author != "" {
+		user, err := s.users.GetUserByUsername(request.Context(), author)
+		if errors.Is(err, store.ErrNotFound) {
+			// nobody by that name, so nothing they wrote either
+			json.NewEncoder(writer).Encode(listResponse[store.SearchResult]{Items: []store.SearchResult{}})
+			return
+		} else if err != nil {
+			serverError(writer, request, "Error looking up author", err)
+			return
+		}
+		q.AuthorID = user.ID
+	}
+
+	// from is inclusive, to is exclusive (a plain date in to means up to the end of that day)
+	for _, bound := range []struct {
+		param string
+		dest  *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		value := query.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, ok := parseSearchDate(value, bound.param == "to")
+		if !ok {
+			WriteError(writer, request, invalidField(bound.param, bound.param+" must be a date (YYYY-MM-DD) or an RFC3339 timestamp"))
+			return
+		}
+		*bound.dest = t
+	}
+
+	limit, ok := parseLimit(writer, request)
+	if !ok {
+		return
+	}
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		q.Offset, ok = decodeSearchCursor(cursorStr)
+		if !ok {
+			WriteError(writer, request, invalidField("cursor", "Invalid cursor"))
+			return
+		}
+	}
+	// one more than the limit so we know if there is another page
+	q.Limit = limit + 1
+
+	results, err := s.search.Search(request.Context(), q)
+	if errors.Is(err, store.ErrSearchUnavailable) {
+		WriteError(writer, request, ErrSearchDisabled)
+		return
+	} else if err != nil {
+		serverError(writer, request, "Search query failed", err)
+		return
+	}
+	for i := range results {
+		results[i].Title = markMatches(results[i].Title)
+		results[i].Snippet = markMatches(results[i].Snippet)
+	}
+
+	// relevance changes as the index does, so search pages by offset rather than by keyset
+	resp := listResponse[store.SearchResult]{Items: results}
+	if len(results) > limit {
+		resp.Items = results[:limit]
+		next := encodeSearchCursor(q.Offset + limit)
+		resp.NextCursor = &next
+	}
+	json.NewEncoder(writer).Encode(resp)
+}
+
+// parseSearchTerms splits what the user typed into terms. "quoted text" is a phrase,
+// a trailing * makes a prefix search, and everything else is a plain word. All terms must match.
+func parseSearchTerms(q string) []store.SearchTerm {
+	var terms []store.SearchTerm
+	addTerm := func(text string, prefix bool) {
+		text = strings.TrimSpace(text)
+		if text == "" || len(terms) >= maxSearchTerms {
+			return
+		}
+		terms = append(terms, store.SearchTerm{Text: text, Prefix: prefix})
+	}
+
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		if q[0] == '"' {
+			phrase, rest, _ := strings.Cut(q[1:], `"`)
+			prefix := strings.HasPrefix(rest, "*")
+			addTerm(phrase, prefix)
+			q = strings.TrimPrefix(rest, "*")
+			continue
+		}
+
+		end := strings.IndexAny(q, " \t\n\"")
+		if end < 0 {
+			end = len(q)
+		}
+		word := q[:end]
+		q = q[end:]
+		prefix := strings.HasSuffix(word, "*")
+		addTerm(strings.TrimRight(word, "*"), prefix)
+	}
+
+	return terms
+}
+
+// markMatches escapes the text and swaps the highlight markers for <mark> tags
+func markMatches(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, store.MatchStart, "<mark>")
+	return strings.ReplaceAll(s, store.MatchEnd, "</mark>")
+}
+
+func parseSearchDate(value string, endOfDay bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
+
+func encodeSearchCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("search|" + strconv.Itoa(offset)))
+}
+
+func decodeSearchCursor(s string) (int, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, false
+	}
+	offsetStr, ok := strings.CutPrefix(string(raw), "search|")
+	if !ok {
+		return 0, false
+	}
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil || offset < 0 {
+		return 0, false
+	}
+	return offset, true
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/archonward/CampusCommons/backend/events"
+	"github.com/archonward/CampusCommons/backend/notify"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// Stores is the data layer the handlers use. sqlstore.Store and memstore.Store each implement all of them.
+type Stores struct {
+	Users         store.UserStore
+	Topics        store.TopicStore
+	Posts         store.PostStore
+	Comments      store.CommentStore
+	Search        store.SearchStore
+	Notifications store.NotificationStore
+}
+
+// Server holds what the handlers need, main builds one and registers its methods as routes
+type Server struct {
+	users    store.UserStore
+	topics   store.TopicStore
+	posts    store.PostStore
+	comments store.CommentStore
+	search   store.SearchStore
+	notes    store.NotificationStore
+	notifier *notify.Dispatcher
+	events   *events.Hub
+
+	socketsMu sync.Mutex
+	sockets   sync.WaitGroup // open WebSockets, for CloseStreams to wait on
+	closing   bool           // CloseStreams was called, no more WebSockets are accepted
+}
+
+func NewServer(stores Stores) *Server {
+	return &Server{
+		users:    stores.Users,
+		topics:   stores.Topics,
+		posts:    stores.Posts,
+		comments: stores.Comments,
+		search:   stores.Search,
+		notes:    stores.Notifications,
+		notifier: notify.New(stores.Users, stores.Comments, stores.Notifications),
+		events:   events.NewHub(),
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// the ?sort= values each listing accepts
+var (
+	topicSorts = map[string]store.Sort{"new": store.SortNew, "old": store.SortOld}
+	postSorts  = map[string]store.Sort{
+		"new":           store.SortNew,
+		"old":           store.SortOld,
+		"top":           store.SortTop,
+		"hot":           store.SortHot,
+		"controversial": store.SortControversial,
+	}
+)
+
+// ?t= time windows for top and controversial
+var sortWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+// parseSort reads ?sort=, falling back to def, writes the 400 itself for anything not in allowed
+func parseSort(writer http.ResponseWriter, request *http.Request, allowed map[string]store.Sort, def store.Sort) (store.Sort, bool) {
+	name := request.URL.Query().Get("sort")
+	if name == "" {
+		return def, true
+	}
+	sort, ok := allowed[name]
+	if !ok {
+		WriteError(writer, request, invalidField("sort", "Unsupported sort: "+name))
+	}
+	return sort, ok
+}
+
+// parseWindow reads ?t= for top and controversial, the zero time means no cutoff
+func parseWindow(writer http.ResponseWriter, request *http.Request, sort store.Sort) (time.Time, bool) {
+	name := request.URL.Query().Get("t")
+	if name == "" {
+		return time.Time{}, true
+	}
+	if sort != store.SortTop && sort != store.SortControversial {
+		WriteError(writer, request, invalidField("t", "t only applies to sort=top and sort=controversial"))
+		return time.Time{}, false
+	}
+	window, ok := sortWindows[name]
+	if !ok {
+		WriteError(writer, request, invalidField("t", "t must be one of day, week, month, year or all"))
+		return time.Time{}, false
+	}
+	if window == 0 {
+		return time.Time{}, true
+	}
+	return time.Now().Add(-window), true
+}
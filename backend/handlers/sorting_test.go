@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func TestParseSort(t *testing.T) {
+	for _, tt := range []struct {
+		query   string
+		allowed map[string]store.Sort
+		want    store.Sort
+		ok      bool
+	}{
+		{"", postSorts, store.SortOld, true},
+		{"?sort=hot", postSorts, store.SortHot, true},
+		{"?sort=controversial", postSorts, store.SortControversial, true},
+		{"?sort=new", topicSorts, store.SortNew, true},
+		{"?sort=top", topicSorts, "", false},
+		{"?sort=HOT", postSorts, "", false},
+		{"?sort=best", postSorts, "", false},
+	} {
+		rec := httptest.NewRecorder()
+		got, ok := parseSort(rec, httptest.NewRequest(http.MethodGet, "/"+tt.query, nil), tt.allowed, store.SortOld)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%q: got %q, %v, want %q, %v", tt.query, got, ok, tt.want, tt.ok)
+		}
+		if !ok && (rec.Code != http.StatusBadRequest || decode[errorResponse](t, rec).Error.Details[0].Field != "sort") {
+			t.Errorf("%q: got %d %s", tt.query, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	for _, tt := range []struct {
+		query  string
+		sort   store.Sort
+		window time.Duration // -1 for no cutoff
+		ok     bool
+	}{
+		{"", store.SortTop, -1, true},
+		{"?t=all", store.SortTop, -1, true},
+		{"?t=day", store.SortTop, 24 * time.Hour, true},
+		{"?t=week", store.SortControversial, 7 * 24 * time.Hour, true},
+		{"?t=year", store.SortControversial, 365 * 24 * time.Hour, true},
+		{"", store.SortHot, -1, true},
+		{"?t=day", store.SortHot, 0, false},
+		{"?t=day", store.SortNew, 0, false},
+		{"?t=fortnight", store.SortTop, 0, false},
+	} {
+		rec := httptest.NewRecorder()
+		since, ok := parseWindow(rec, httptest.NewRequest(http.MethodGet, "/"+tt.query, nil), tt.sort)
+		if ok != tt.ok {
+			t.Errorf("%q with sort=%s: got %v, want %v", tt.query, tt.sort, ok, tt.ok)
+			continue
+		}
+		switch {
+		case !ok:
+			if rec.Code != http.StatusBadRequest || decode[errorResponse](t, rec).Error.Details[0].Field != "t" {
+				t.Errorf("%q with sort=%s: got %d %s", tt.query, tt.sort, rec.Code, rec.Body)
+			}
+		case tt.window < 0:
+			if !since.IsZero() {
+				t.Errorf("%q with sort=%s: got a cutoff at %v", tt.query, tt.sort, since)
+			}
+		default:
+			if d := time.Since(since) - tt.window; d < 0 || d > time.Minute {
+				t.Errorf("%q with sort=%s: cutoff %v is %v off", tt.query, tt.sort, since, d)
+			}
+		}
+	}
+}
+
+func TestSortedPosts(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mux.HandleFunc("GET /topics/{id}/posts", ts.GetPostsByTopic)
+
+	ctx := context.Background()
+	voters := []store.User{ts.user("alice"), ts.user("bob"), ts.user("carol"), ts.user("dave")}
+	topic := ts.topic("Golang", voters[0])
+	titles := map[int]string{}
+	// votes for each post, from voters in order
+	for _, p := range []struct {
+		title string
+		votes []int
+	}{
+		{"ignored", nil},
+		{"loved", []int{1, 1, 1}},
+		{"fought over", []int{1, -1, 1, -1}},
+		{"disliked", []int{-1, -1}},
+	} {
+		post := ts.post(topic, p.title, "body", voters[0])
+		titles[post.ID] = p.title
+		for i, v := range p.votes {
+			_, err := ts.st.VotePost(ctx, post.ID, voters[i].ID, v)
+			ts.check(err)
+		}
+	}
+
+	path := "/topics/" + strconv.Itoa(topic.ID) + "/posts"
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"ignored", "loved", "fought over", "disliked"}},
+		{"?sort=new", []string{"disliked", "fought over", "loved", "ignored"}},
+		// ties go newest first
+		{"?sort=top&t=week", []string{"loved", "fought over", "ignored", "disliked"}},
+		{"?sort=controversial&t=all", []string{"fought over", "disliked", "loved", "ignored"}},
+	} {
+		rec := ts.send(store.User{}, http.MethodGet, path+tt.query, "")
+		var got []string
+		for _, post := range decode[listResponse[store.Post]](t, rec).Items {
+			got = append(got, titles[post.ID])
+		}
+		if rec.Code != http.StatusOK || len(got) != len(tt.want) {
+			t.Errorf("%q: got %d %v", tt.query, rec.Code, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+
+	for _, query := range []string{"?sort=best", "?sort=new&t=day", "?sort=top&t=forever"} {
+		if rec := ts.send(store.User{}, http.MethodGet, path+query, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: got %d", query, rec.Code)
+		}
+	}
+}
@@ -1,214 +1,165 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"time"
-
-	"github.com/archonward/CampusCommons/backend/database"
 	"strconv"
-)
 
-// A simple struct to start off, more fields can be added into the struct if necessary in the future.
-type Topic struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description,omitempty"`
-	CreatedBy   int       `json:"created_by"`
-	CreatedAt   time.Time `json:"created_at"`
-}
+	"github.com/archonward/CampusCommons/backend/events"
+	"github.com/archonward/CampusCommons/backend/metrics"
+	"github.com/archonward/CampusCommons/backend/store"
+)
 
-// This func will handle GET requests for the topic of the post.
-func GetTopics(writer http.ResponseWriter, request *http.Request) {
+// This func will handle GET /topics, sorted with ?sort=new|old and paginated with ?limit= and ?cursor=
+func (s *Server) GetTopics(writer http.ResponseWriter, request *http.Request) {
 	// Set content type
 	writer.Header().Set("Content-Type", "application/json")
 
-	// Use the built in Query to find the rows required, error if there is no such topics
-	rows, err := database.DB.Query(`
-		SELECT id, title, description, created_by, created_at 
-		FROM topics 
-		ORDER BY created_at DESC
-	`)
-	if err != nil {
-		log.Printf("Database query error: %v", err)
-		http.Error(writer, "No such topics in database", http.StatusInternalServerError)
+	// ?sort=new (the default) or old
+	sort, ok := parseSort(writer, request, topicSorts, store.SortNew)
+	if !ok {
 		return
 	}
-	defer rows.Close()
 
-	var topics []Topic		// empty list
-	for rows.Next() {		// for each of the item inside rows, create a Topic, then append to the list as required
-		var t Topic
-		err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.CreatedBy, &t.CreatedAt)
-		if err != nil {
-			log.Printf("Row scan error: %v", err)
-			http.Error(writer, "Data parsing error", http.StatusInternalServerError)
-			return
-		}
-		topics = append(topics, t)
+	p, ok := parsePage(writer, request, sort)
+	if !ok {
+		return
 	}
 
-	// Check for iteration errors
-	if err = rows.Err(); err != nil {
-		log.Printf("Rows iteration error: %v", err)
-		http.Error(writer, "Data retrieval error", http.StatusInternalServerError)
+	topics, err := s.topics.ListTopics(request.Context(), sort, p)
+	if err != nil {
+		serverError(writer, request, "Database query error", err)
 		return
 	}
 
 	// Return JSON response
-	json.NewEncoder(writer).Encode(topics)
+	json.NewEncoder(writer).Encode(newListResponse(sort, topics))
 }
 
 // this new func will handle POST topic requests for people looking to post.
-func CreateTopic(writer http.ResponseWriter, request *http.Request) {
+func (s *Server) CreateTopic(writer http.ResponseWriter, request *http.Request) {
 	
 	if request.Method != http.MethodPost {	// only POST
-		http.Error(writer, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		WriteError(writer, request, errMethodNotAllowed)
 		return
 	}
 
 	// Set content type
 	writer.Header().Set("Content-Type", "application/json")
 
+	// the author is whoever is logged in
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
 	// Decode JSON request, simple struct with 3 fields, again more could be added later
 	var input struct {
 		Title       string `json:"title"`
 		Description string `json:"description"`
-		CreatedBy   int    `json:"created_by"` // For now, i require user ID, 
+		CreatedBy   int    `json:"created_by"` // optional now, only kept so older clients still work
 	}
 
 	decoder := json.NewDecoder(request.Body)
 	if err := decoder.Decode(&input); err != nil {
 		log.Printf("Invalid JSON: %v", err)
-		http.Error(writer, "Invalid JSON payload", http.StatusBadRequest)
+		WriteError(writer, request, errInvalidJSON)
 		return
 	}
 
-	// Validate to help to prevent bugs, title cannot be empty, userID also cannot
+	// Validate to help to prevent bugs, title cannot be empty, and nobody can post as someone else
 	if input.Title == "" {
-		http.Error(writer, "Title is required", http.StatusBadRequest)
+		WriteError(writer, request, invalidField("title", "Title is required"))
 		return
 	}
-	if input.CreatedBy <= 0 {
-		http.Error(writer, "Valid created_by user ID is required", http.StatusBadRequest)
+	if !checkCreatedBy(writer, request, input.CreatedBy, user) {
 		return
 	}
 
-	// Insert into database
-	// .Exec is used for any commands that change data: insert, update, delete.
-	result, err := database.DB.Exec(`
-		INSERT INTO topics (title, description, created_by)
-		VALUES (?, ?, ?)	
-	`, input.Title, input.Description, input.CreatedBy)	//each of this will be inserted into the 3 placeholders.
-
-	if err != nil {
-		log.Printf("Database insert error: %v", err)
-		http.Error(writer, "Failed to create topic", http.StatusInternalServerError)
-		return
-	}
-
-	// get the new topic ID that was inserted, result will contain the new row's ID
-	topicID, err := result.LastInsertId()
+	topic, err := s.topics.CreateTopic(request.Context(), input.Title, input.Description, user.ID)
 	if err != nil {
-		log.Printf("Failed to get last insert ID: %v", err)
-		http.Error(writer, "Failed to retrieve topic ID", http.StatusInternalServerError)
-		return
-	}
-
-	// Fetch the full topic (to return complete object with timestamps)
-	var topic Topic
-	err = database.DB.QueryRow(`SELECT id, title, description, created_by, created_at
-		FROM topics
-		WHERE id = ?`, topicID).Scan(&topic.ID, &topic.Title, &topic.Description, &topic.CreatedBy, &topic.CreatedAt)
-
-	if err != nil {
-		log.Printf("Failed to fetch created topic: %v", err)
-		http.Error(writer, "Failed to retrieve created topic", http.StatusInternalServerError)
+		serverError(writer, request, "Database insert error", err)
 		return
 	}
 
 	// Return 201 Created + JSON topic
+	metrics.TopicsCreated.Inc()
 	writer.WriteHeader(http.StatusCreated)
 	json.NewEncoder(writer).Encode(topic)
 }
 
 // this func handles DELETE /topics/{id}
-func DeleteTopic(writer http.ResponseWriter, request *http.Request) {
+func (s *Server) DeleteTopic(writer http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodDelete {
-		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		WriteError(writer, request, errMethodNotAllowed)
 		return
 	}
 
 	topicIDStr := request.PathValue("id")
 	topicID, err := strconv.Atoi(topicIDStr)
 	if err != nil || topicID <= 0 {
-		http.Error(writer, "invalid topic ID", http.StatusBadRequest)
+		WriteError(writer, request, invalidID("topic"))
 		return
 	}
 
-	// start off by delete all comments under posts in this topic
-	_, err = database.DB.Exec(`DELETE FROM comments 
-		WHERE post_id IN (SELECT id FROM posts WHERE topic_id = ?)`, topicID)
-	if err != nil {
-		log.Printf("Failed to delete comments: %v", err)
-		http.Error(writer, "Failed to delete associated comments", http.StatusInternalServerError)
+	user, ok := requireUser(writer, request)
+	if !ok {
 		return
 	}
 
-	// delete all posts in this topic
-	_, err = database.DB.Exec(`
-		DELETE FROM posts 
-		WHERE topic_id = ?
-	`, topicID)
-	if err != nil {
-		log.Printf("failed to delete posts: %v", err)
-		http.Error(writer, "failed to delete associated posts", http.StatusInternalServerError)
+	// only the author or an admin can delete a whole topic
+	authorID, ok := s.topicAuthor(writer, request, topicID)
+	if !ok {
 		return
 	}
-
-	// here we delete the topic
-	result, err := database.DB.Exec(`DELETE FROM topics 
-		WHERE id = ?`, topicID)
-	if err != nil {
-		log.Printf("failed to delete topic: %v", err)
-		http.Error(writer, "failed to delete topic", http.StatusInternalServerError)
+	if !canEdit(user, authorID) {
+		WriteError(writer, request, forbidden("Only the author of this topic or an admin can delete it"))
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(writer, "Topic not found", http.StatusNotFound)
+	// the store takes the posts, comments and votes in the topic with it
+	err = s.topics.DeleteTopic(request.Context(), topicID)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("topic"))
+		return
+	} else if err != nil {
+		serverError(writer, request, "failed to delete topic", err)
 		return
 	}
+	// this ends the streams of the topic's posts as well, they subscribed within it
+	s.events.PublishLast(events.TopicChannel(topicID), "topic.deleted", map[string]int{"id": topicID})
 
 	writer.WriteHeader(http.StatusNoContent) // status 204
 }
 
 // this func handles PUT PUT /topics/{id} requests
-func UpdateTopic(writer http.ResponseWriter, request *http.Request) {
+func (s *Server) UpdateTopic(writer http.ResponseWriter, request *http.Request) {
 	if request.Method != http.MethodPut {
-		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		WriteError(writer, request, errMethodNotAllowed)
 		return
 	}
 
 	topicIDStr := request.PathValue("id")
 	topicID, err := strconv.Atoi(topicIDStr)
 	if err != nil || topicID <= 0 {
-		http.Error(writer, "invalid topic ID", http.StatusBadRequest)
+		WriteError(writer, request, invalidID("topic"))
 		return
 	}
 
-	// Ensure topic exists
-	var existingTitle string
-	err = database.DB.QueryRow("SELECT title FROM topics WHERE id = ?", topicID).Scan(&existingTitle)
-	if err == sql.ErrNoRows {
-		http.Error(writer, "topic not found", http.StatusNotFound)
+	user, ok := requireUser(writer, request)
+	if !ok {
 		return
-	} else if err != nil {
-		log.Printf("DB error checking topic: %v", err)
-		http.Error(writer, "server error", http.StatusInternalServerError)
+	}
+
+	// Ensure topic exists, and that this user is allowed to edit it
+	authorID, ok := s.topicAuthor(writer, request, topicID)
+	if !ok {
+		return
+	}
+	if !canEdit(user, authorID) {
+		WriteError(writer, request, forbidden("Only the author of this topic or an admin can edit it"))
 		return
 	}
 
@@ -217,33 +168,23 @@ func UpdateTopic(writer http.ResponseWriter, request *http.Request) {
 		Description string `json:"description"`
 	}
 	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {		// Parsing
-		http.Error(writer, "invalid JSON", http.StatusBadRequest)
+		WriteError(writer, request, errInvalidJSON)
 		return
 	}
 	if input.Title == "" {
-		http.Error(writer, "title is required", http.StatusBadRequest)
+		WriteError(writer, request, invalidField("title", "Title is required"))
 		return
 	}
 
-	_, err = database.DB.Exec(`UPDATE topics 
-		SET title = ?, description = ? 
-		WHERE id = ?`, input.Title, input.Description, topicID)		// Update row
-	if err != nil {
-		log.Printf("failed to update topic: %v", err)
-		http.Error(writer, "failed to update topic", http.StatusInternalServerError)
+	updatedTopic, err := s.topics.UpdateTopic(request.Context(), topicID, input.Title, input.Description)	// Update row
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound("topic"))
 		return
-	}
-
-	var updatedTopic Topic
-	err = database.DB.QueryRow(`SELECT id, title, description, created_by, created_at
-		FROM topics
-		WHERE id = ?`, topicID).Scan(&updatedTopic.ID, &updatedTopic.Title, &updatedTopic.Description, &updatedTopic.CreatedBy, &updatedTopic.CreatedAt)	// Return updated topic
-
-	if err != nil {
-		log.Printf("failed to fetch updated topic: %v", err)
-		http.Error(writer, "failed to retrieve updated topic", http.StatusInternalServerError)
+	} else if err != nil {
+		serverError(writer, request, "failed to update topic", err)
 		return
 	}
+	s.events.Publish(events.TopicChannel(topicID), "topic.updated", updatedTopic)
 
 	json.NewEncoder(writer).Encode(updatedTopic)
 }
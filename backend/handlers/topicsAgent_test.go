@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func TestTopicCRUD(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mux.HandleFunc("GET /topics", ts.GetTopics)
+	ts.mux.HandleFunc("POST /topics", ts.CreateTopic)
+	ts.mux.HandleFunc("PUT /topics/{id}", ts.UpdateTopic)
+	ts.mux.HandleFunc("DELETE /topics/{id}", ts.DeleteTopic)
+	ts.mux.HandleFunc("GET /topics/{id}/posts", ts.GetPostsByTopic)
+
+	alice := ts.user("alice")
+	bob := ts.user("bob")
+
+	rec := ts.send(alice, http.MethodPost, "/topics", `{"title": "Golang", "description": "all things Go"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create got %d %s", rec.Code, rec.Body)
+	}
+	topic := decode[store.Topic](t, rec)
+	if topic.ID == 0 || topic.Title != "Golang" || topic.CreatedBy != alice.ID {
+		t.Errorf("created %+v", topic)
+	}
+	path := "/topics/" + strconv.Itoa(topic.ID)
+
+	// what a create can get wrong
+	for _, tt := range []struct {
+		name string
+		user store.User
+		body string
+		want int
+	}{
+		{"logged out", store.User{}, `{"title": "Rust"}`, http.StatusUnauthorized},
+		{"no title", bob, `{"description": "untitled"}`, http.StatusBadRequest},
+		{"not JSON", bob, `{"title": `, http.StatusBadRequest},
+		{"someone else's created_by", bob, `{"title": "Rust", "created_by": ` + strconv.Itoa(alice.ID) + `}`, http.StatusForbidden},
+		{"own created_by", bob, `{"title": "Rust", "created_by": ` + strconv.Itoa(bob.ID) + `}`, http.StatusCreated},
+	} {
+		if rec := ts.send(tt.user, http.MethodPost, "/topics", tt.body); rec.Code != tt.want {
+			t.Errorf("%s: got %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	// listed newest first
+	list := decode[listResponse[store.Topic]](t, ts.send(store.User{}, http.MethodGet, "/topics", ""))
+	if len(list.Items) != 2 || list.Items[0].Title != "Rust" || list.Items[1].ID != topic.ID || list.NextCursor != nil {
+		t.Errorf("listed %+v", list)
+	}
+
+	rec = ts.send(alice, http.MethodPut, path, `{"title": "Go", "description": "renamed"}`)
+	if updated := decode[store.Topic](t, rec); rec.Code != http.StatusOK || updated.Title != "Go" || updated.Description != "renamed" || updated.EditedAt == nil {
+		t.Errorf("update got %d %+v", rec.Code, updated)
+	}
+	if rec := ts.send(alice, http.MethodPut, path, `{"title": ""}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("update without a title got %d", rec.Code)
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPut, "/topics/999", http.StatusNotFound},
+		{http.MethodDelete, "/topics/999", http.StatusNotFound},
+		{http.MethodPut, "/topics/abc", http.StatusBadRequest},
+		{http.MethodDelete, "/topics/0", http.StatusBadRequest},
+	} {
+		if rec := ts.send(alice, tt.method, tt.path, `{"title": "x"}`); rec.Code != tt.want {
+			t.Errorf("%s %s got %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+
+	// deleting takes the posts along
+	ts.post(topic, "Channels", "body", bob)
+	if rec := ts.send(alice, http.MethodDelete, path, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete got %d %s", rec.Code, rec.Body)
+	}
+	if rec := ts.send(alice, http.MethodGet, path+"/posts", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("posts of the deleted topic got %d", rec.Code)
+	}
+	if rec := ts.send(alice, http.MethodDelete, path, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("deleting again got %d", rec.Code)
+	}
+}
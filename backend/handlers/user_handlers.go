@@ -1,78 +1,208 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"regexp"
+	"time"
 
-	"github.com/archonward/CampusCommons/backend/database"
+	"github.com/archonward/CampusCommons/backend/auth"
+	"github.com/archonward/CampusCommons/backend/metrics"
+	"github.com/archonward/CampusCommons/backend/store"
 )
 
-// just ID and Username for now, i may add 2 more fields, createdTime and whether the user is active or not. Depends on time
-type User struct {
-	ID       int    `json:"id"`
+// what /register and /login send back, the user fields stay at the top level so the frontend can still read id and username
+type sessionResponse struct {
+	store.User
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// usernames end up in URLs and mentions later on, so keep them simple
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+type credentials struct {
 	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
-// this func will handle POST /login, for now, we check if username is empty to prevent bugs.
-func Login(w http.ResponseWriter, r *http.Request) {
+// this func will handle POST /register, it creates the account and logs the user straight in
+func (s *Server) Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		WriteError(w, r, errMethodNotAllowed)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	// parse request body
-	var input struct {
-		Username string `json:"username"`
+	var input credentials
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("invalid JSON (register request): %v", err)
+		WriteError(w, r, errInvalidJSON)
+		return
 	}
 
+	// both fields are checked so the form can flag everything in one go
+	var problems []FieldError
+	if !usernamePattern.MatchString(input.Username) {
+		problems = append(problems, FieldError{Field: "username", Message: "Username must be 3-32 characters of letters, digits, '_', '.' or '-'"})
+	}
+	if len(input.Password) < auth.MinPasswordLength || len(input.Password) > auth.MaxPasswordLength {
+		problems = append(problems, FieldError{Field: "password", Message: "Password must be between 8 and 72 characters"})
+	}
+	if len(problems) > 0 {
+		WriteError(w, r, invalidFields(problems...))
+		return
+	}
+
+	// checked before hashing so a taken name doesn't cost a bcrypt round, CreateUser checks again
+	_, err := s.users.GetUserByUsername(r.Context(), input.Username)
+	if err == nil {
+		WriteError(w, r, errUsernameTaken)
+		return
+	} else if !errors.Is(err, store.ErrNotFound) {
+		serverError(w, r, "Error checking username", err)
+		return
+	}
+
+	hash, err := auth.HashPassword(input.Password)
+	if err != nil {
+		serverError(w, r, "Failed to hash password", err)
+		return
+	}
+
+	// the very first account becomes the admin, so a fresh install can hand out roles
+	user, err := s.users.CreateUser(r.Context(), input.Username, hash)
+	if errors.Is(err, store.ErrUsernameTaken) {
+		WriteError(w, r, errUsernameTaken)
+		return
+	} else if err != nil {
+		serverError(w, r, "Failed to create user", err)
+		return
+	}
+
+	metrics.UsersRegistered.Inc()
+	startSession(w, r, user, http.StatusCreated)
+}
+
+// this func will handle POST /login, the username and password both have to match
+func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, r, errMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// parse request body
+	var input credentials
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		log.Printf("invalid JSON (login request): %v", err)
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
-		return		// if decode fails return void
+		WriteError(w, r, errInvalidJSON)
+		return // if decode fails return void
 	}
 
-	username := input.Username
-
-	// guard against empty inputs for username
-	if username == "" {
-		http.Error(w, "Username is required", http.StatusBadRequest)
+	// guard against empty inputs
+	var problems []FieldError
+	if input.Username == "" {
+		problems = append(problems, FieldError{Field: "username", Message: "Username is required"})
+	}
+	if input.Password == "" {
+		problems = append(problems, FieldError{Field: "password", Message: "Password is required"})
+	}
+	if len(problems) > 0 {
+		WriteError(w, r, invalidFields(problems...))
 		return
 	}
 
-	// Check if user already exists
-	var existingUser User
-	err := database.DB.QueryRow(`
-		SELECT id, username FROM users WHERE username = ?
-	`, username).Scan(&existingUser.ID, &existingUser.Username)
+	user, hash, err := s.users.PasswordHash(r.Context(), input.Username)
 
 	switch {
-	case err == sql.ErrNoRows:	// user do not exist, so i create a new User
-		result, err := database.DB.Exec(`
-			INSERT INTO users (username) VALUES (?)
-		`, username)
-		if err != nil {
-			log.Printf("Failed to create user: %v", err)
-			http.Error(w, "Failed to register user", http.StatusInternalServerError)
-			return
-		}
-
-		userID, _ := result.LastInsertId()
-		existingUser = User{ID: int(userID), Username: username}
+	case errors.Is(err, store.ErrNotFound):
+		// same error as a wrong password, so nobody can probe which usernames exist
+		auth.WastePasswordCheck(input.Password)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		WriteError(w, r, errInvalidCredentials)
+		return
 
 	case err != nil:
 		// for all other errors
-		log.Printf("login error: %v", err)
-		http.Error(w, "Login failed", http.StatusInternalServerError)
+		serverError(w, r, "login error", err)
+		return
+	}
+
+	if hash == "" {
+		// accounts from before logins have no password until the operator sets one with
+		// `go run . user set-password`, nobody gets to pick it by logging in first
+		auth.WastePasswordCheck(input.Password)
+		metrics.Logins.WithLabelValues("failure").Inc()
+		WriteError(w, r, errInvalidCredentials)
+		return
+	}
+
+	if err := auth.CheckPassword(hash, input.Password); err != nil {
+		if err != auth.ErrPasswordMismatch {
+			log.Printf("login error: %v", err)
+		}
+		metrics.Logins.WithLabelValues("failure").Inc()
+		WriteError(w, r, errInvalidCredentials)
+		return
+	}
+
+	metrics.Logins.WithLabelValues("success").Inc()
+	startSession(w, r, user, http.StatusOK)
+}
+
+// this func handles POST /logout, tokens are stateless so all we can do is drop the cookie
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, r, errMethodNotAllowed)
+		return
+	}
+
+	clearSessionCookie(w, r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// this func handles GET /me, it returns whoever the session token belongs to (Authenticate already loaded them)
+func Me(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, r, errMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := requireUser(w, r)
+	if !ok {
 		return
+	}
 
-	default:
+	json.NewEncoder(w).Encode(user)
+}
+
+// startSession signs a token for the user, sets it as a cookie and writes it in the body as well
+func startSession(w http.ResponseWriter, r *http.Request, user store.User, status int) {
+	token, expires, err := auth.SignSession(user.ID)
+	if err != nil {
+		serverError(w, r, "Failed to sign session", err)
+		return
 	}
 
-	// Return user object
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(existingUser)
+	setLogUser(r.Context(), user.ID)
+
+	// the cookie is for the browser, the token in the body is for clients that use the Authorization header
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.CookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(sessionResponse{User: user, Token: token, ExpiresAt: expires})
 }
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/auth"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func TestLogin(t *testing.T) {
+	auth.InitSessions(strings.Repeat("k", 32))
+	ts := newTestServer(t)
+	ts.mux.HandleFunc("POST /login", ts.Login)
+
+	ctx := context.Background()
+	hash, err := auth.HashPassword("correct horse")
+	ts.check(err)
+	_, err = ts.st.CreateUser(ctx, "alice", hash)
+	ts.check(err)
+	// an account from before logins, it has no password until the operator sets one
+	legacy, err := ts.st.CreateUser(ctx, "carol", "")
+	ts.check(err)
+
+	for _, tt := range []struct {
+		name, body string
+		want       int
+	}{
+		{"right password", `{"username": "alice", "password": "correct horse"}`, http.StatusOK},
+		{"wrong password", `{"username": "alice", "password": "battery staple"}`, http.StatusUnauthorized},
+		{"no such user", `{"username": "bob", "password": "correct horse"}`, http.StatusUnauthorized},
+		{"no password yet", `{"username": "carol", "password": "anything at all"}`, http.StatusUnauthorized},
+		{"no password yet, empty", `{"username": "carol", "password": ""}`, http.StatusBadRequest},
+	} {
+		rec := ts.send(store.User{}, http.MethodPost, "/login", tt.body)
+		if rec.Code != tt.want {
+			t.Errorf("%s: got %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+			continue
+		}
+		if rec.Code == http.StatusUnauthorized && decode[errorResponse](t, rec).Error.Code != errInvalidCredentials.Code {
+			t.Errorf("%s: got %s", tt.name, rec.Body)
+		}
+	}
+
+	// logging in didn't give carol's account a password
+	if _, hash, _ := ts.st.PasswordHash(ctx, legacy.Username); hash != "" {
+		t.Errorf("carol's account got the hash %q", hash)
+	}
+
+	// once the operator sets one, it works like any other
+	hash, err = auth.HashPassword("battery staple")
+	ts.check(err)
+	ts.check(ts.st.SetPassword(ctx, legacy.ID, hash))
+	if rec := ts.send(store.User{}, http.MethodPost, "/login", `{"username": "carol", "password": "battery staple"}`); rec.Code != http.StatusOK {
+		t.Errorf("after set-password got %d %s", rec.Code, rec.Body)
+	}
+}
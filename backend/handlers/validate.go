@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/archonward/CampusCommons/backend/openapi"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// ValidateBodies checks JSON request bodies against the OpenAPI document before a handler decodes them,
+// so a missing field or a string where a number goes is a validation_failed on every route alike.
+// The handlers still check what the document can't say (the topic exists, the user may edit the post).
+// Requests with no body in the document, or for no route at all, go straight through.
+// Every body is cut off at maxBytes, one that goes over gets a 413 instead of being read into memory.
+func ValidateBodies(spec *openapi.Spec, mux *http.ServeMux, maxBytes int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the handlers without a schema read through the same limit
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		_, pattern := mux.Handler(r)
+		schema := spec.RequestSchema(r.Method, pattern)
+		if schema == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteError(w, r, errBodyTooLarge)
+			return
+		}
+		var value any
+		if err != nil || json.Unmarshal(body, &value) != nil {
+			WriteError(w, r, errInvalidJSON)
+			return
+		}
+		if err := schema.VisitJSON(value, openapi3.VisitAsRequest(), openapi3.MultiErrors()); err != nil {
+			WriteError(w, r, invalidFields(schemaProblems(err)...))
+			return
+		}
+
+		// the handler decodes the body again, into its own struct
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// schemaProblems turns what the schema validator found into one FieldError per problem
+func schemaProblems(err error) []FieldError {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		var problems []FieldError
+		for _, e := range multi {
+			problems = append(problems, schemaProblems(e)...)
+		}
+		return problems
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if !errors.As(err, &schemaErr) {
+		return []FieldError{{Field: "body", Message: err.Error()}}
+	}
+	field := strings.Join(schemaErr.JSONPointer(), ".")
+	if field == "" {
+		// the body as a whole, e.g. an array where an object goes
+		return []FieldError{{Field: "body", Message: "Request body " + schemaErr.Reason}}
+	}
+	// an empty required string reads the same as a missing one, like the handlers put it
+	if schemaErr.SchemaField == "required" || (schemaErr.SchemaField == "minLength" && schemaErr.Schema.MinLength == 1) {
+		return []FieldError{{Field: field, Message: capitalize(field) + " is required"}}
+	}
+	return []FieldError{{Field: field, Message: capitalize(field) + " is invalid: " + schemaErr.Reason}}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/openapi"
+)
+
+func TestValidateBodies(t *testing.T) {
+	spec, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received string
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /posts/{id}/vote", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+	})
+	mux.HandleFunc("/topics", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /upload", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	})
+	handler := ValidateBodies(spec, mux, 1<<10, mux)
+
+	send := func(method, path, body string) (int, APIError) {
+		received = ""
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var resp errorResponse
+		if rec.Code >= 400 {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s %s: error body %q isn't JSON", method, path, rec.Body)
+			}
+		}
+		return rec.Code, resp.Error
+	}
+
+	// a good body reaches the handler untouched
+	if status, _ := send(http.MethodPost, "/posts/1/vote", `{"value": -1}`); status != http.StatusOK || received != `{"value": -1}` {
+		t.Errorf("got %d and the handler read %q", status, received)
+	}
+
+	cases := []struct {
+		body   string
+		code   string
+		fields []string
+	}{
+		{`{"value": `, "invalid_json", nil},
+		{``, "invalid_json", nil},
+		{`{}`, "validation_failed", []string{"value"}},
+		{`{"value": 2}`, "validation_failed", []string{"value"}},
+		{`{"value": "up"}`, "validation_failed", []string{"value"}},
+		{`[1]`, "validation_failed", []string{"body"}},
+	}
+	for _, c := range cases {
+		status, e := send(http.MethodPost, "/posts/1/vote", c.body)
+		if status != http.StatusBadRequest || e.Code != c.code {
+			t.Errorf("%q: got %d %s, want 400 %s", c.body, status, e.Code, c.code)
+			continue
+		}
+		if received != "" {
+			t.Errorf("%q reached the handler", c.body)
+		}
+		var fields []string
+		for _, d := range e.Details {
+			fields = append(fields, d.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(c.fields, ",") {
+			t.Errorf("%q: got details for %v, want %v", c.body, fields, c.fields)
+		}
+	}
+
+	// every problem is reported at once, and an empty required string reads like a missing one
+	_, e := send(http.MethodPost, "/topics", `{"title": "", "created_by": "me"}`)
+	if len(e.Details) != 2 || !strings.Contains(e.Message, "Title is required") || !strings.Contains(e.Message, "Created_by is invalid") {
+		t.Errorf("got %+v", e)
+	}
+
+	// no body in the spec, nothing to check
+	if status, _ := send(http.MethodGet, "/topics", `not json`); status != http.StatusOK {
+		t.Errorf("GET /topics was checked, got %d", status)
+	}
+
+	// too large is refused before it is parsed, and handlers without a schema hit the same limit
+	large := `{"value": 1, "padding": "` + strings.Repeat("x", 1<<10) + `"}`
+	if status, e := send(http.MethodPost, "/posts/1/vote", large); status != http.StatusRequestEntityTooLarge || e.Code != "body_too_large" || received != "" {
+		t.Errorf("a large body got %d %s", status, e.Code)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(large)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("a large body without a schema got %d", rec.Code)
+	}
+}
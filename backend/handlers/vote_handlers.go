@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/archonward/CampusCommons/backend/metrics"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// what POST /posts/{id}/vote and POST /comments/{id}/vote send back
+type voteResult struct {
+	TargetType string `json:"target_type"`
+	TargetID   int    `json:"target_id"`
+	Score      int    `json:"score"`
+	MyVote     int    `json:"my_vote"`
+}
+
+// viewerID is the logged in user's ID, or 0 for anonymous requests (which never match a vote)
+func viewerID(r *http.Request) int {
+	if user, ok := currentUser(r); ok {
+		return user.ID
+	}
+	return 0
+}
+
+// this func handles POST /posts/{id}/vote
+func (s *Server) VotePost(writer http.ResponseWriter, request *http.Request) {
+	castVote(writer, request, "post", s.posts.VotePost)
+}
+
+// this func handles POST /comments/{id}/vote
+func (s *Server) VoteComment(writer http.ResponseWriter, request *http.Request) {
+	castVote(writer, request, "comment", s.comments.VoteComment)
+}
+
+// castVote records the caller's vote (+1, -1, or 0 to take it back) through vote,
+// which also updates the cached counts so listings never have to add up votes
+func castVote(writer http.ResponseWriter, request *http.Request, targetType string, vote func(ctx context.Context, targetID, userID, value int) (int, error)) {
+	writer.Header().Set("Content-Type", "application/json")
+
+	targetID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || targetID <= 0 {
+		WriteError(writer, request, invalidID(targetType))
+		return
+	}
+
+	user, ok := requireUser(writer, request)
+	if !ok {
+		return
+	}
+
+	// a pointer so a missing value isn't mistaken for 0
+	var input struct {
+		Value *int `json:"value"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&input); err != nil {
+		WriteError(writer, request, errInvalidJSON)
+		return
+	}
+	if input.Value == nil || *input.Value < -1 || *input.Value > 1 {
+		WriteError(writer, request, invalidField("value", "Value must be -1, 0 or 1"))
+		return
+	}
+
+	score, err := vote(request.Context(), targetID, user.ID, *input.Value)
+	if errors.Is(err, store.ErrNotFound) {
+		WriteError(writer, request, notFound(targetType))
+		return
+	} else if err != nil {
+		serverError(writer, request, "failed to save vote", err)
+		return
+	}
+
+	metrics.VotesCast.WithLabelValues(targetType).Inc()
+	json.NewEncoder(writer).Encode(voteResult{TargetType: targetType, TargetID: targetID, Score: score, MyVote: *input.Value})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func TestVotes(t *testing.T) {
+	ts := newTestServer(t)
+	ts.mux.HandleFunc("POST /posts/{id}/vote", ts.VotePost)
+	ts.mux.HandleFunc("POST /comments/{id}/vote", ts.VoteComment)
+	ts.mux.HandleFunc("GET /posts/{id}", ts.GetPostByID)
+
+	alice := ts.user("alice")
+	bob := ts.user("bob")
+	topic := ts.topic("Golang", alice)
+	post := ts.post(topic, "Channels", "body", alice)
+	comment := ts.comment(post, nil, "frist", alice)
+
+	for _, target := range []struct {
+		kind string
+		id   int
+		path string
+	}{
+		{"post", post.ID, "/posts/" + strconv.Itoa(post.ID) + "/vote"},
+		{"comment", comment.ID, "/comments/" + strconv.Itoa(comment.ID) + "/vote"},
+	} {
+		t.Run(target.kind, func(t *testing.T) {
+			// one vote per user, a new one replaces the old and 0 takes it back
+			for _, tt := range []struct {
+				name  string
+				user  store.User
+				value int
+				score int
+			}{
+				{"alice up", alice, 1, 1},
+				{"alice up again", alice, 1, 1},
+				{"bob down", bob, -1, 0},
+				{"alice changes to down", alice, -1, -2},
+				{"bob takes it back", bob, 0, -1},
+				{"bob takes it back again", bob, 0, -1},
+				{"bob up", bob, 1, 0},
+			} {
+				rec := ts.send(tt.user, http.MethodPost, target.path, `{"value": `+strconv.Itoa(tt.value)+`}`)
+				want := voteResult{TargetType: target.kind, TargetID: target.id, Score: tt.score, MyVote: tt.value}
+				if got := decode[voteResult](t, rec); rec.Code != http.StatusOK || got != want {
+					t.Errorf("%s: got %d %s, want score %d", tt.name, rec.Code, rec.Body, tt.score)
+				}
+			}
+
+			for _, tt := range []struct {
+				name string
+				user store.User
+				body string
+				want int
+			}{
+				{"logged out", store.User{}, `{"value": 1}`, http.StatusUnauthorized},
+				{"value 2", alice, `{"value": 2}`, http.StatusBadRequest},
+				{"value -2", alice, `{"value": -2}`, http.StatusBadRequest},
+				{"value as a word", alice, `{"value": "up"}`, http.StatusBadRequest},
+				{"no value", alice, `{}`, http.StatusBadRequest},
+				{"not JSON", alice, `{"value"`, http.StatusBadRequest},
+			} {
+				if rec := ts.send(tt.user, http.MethodPost, target.path, tt.body); rec.Code != tt.want {
+					t.Errorf("%s: got %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+				}
+			}
+		})
+	}
+
+	// a refused vote changes nothing, and everyone sees the same score but only their own vote
+	for _, tt := range []struct {
+		user   store.User
+		myVote int
+	}{
+		{alice, -1},
+		{bob, 1},
+		{store.User{}, 0},
+	} {
+		rec := ts.send(tt.user, http.MethodGet, "/posts/"+strconv.Itoa(post.ID), "")
+		if got := decode[store.Post](t, rec); got.Score != 0 || got.MyVote != tt.myVote {
+			t.Errorf("%q sees score %d and my_vote %d, want 0 and %d", tt.user.Username, got.Score, got.MyVote, tt.myVote)
+		}
+	}
+
+	for _, path := range []string{"/posts/999/vote", "/comments/999/vote"} {
+		if rec := ts.send(alice, http.MethodPost, path, `{"value": 1}`); rec.Code != http.StatusNotFound {
+			t.Errorf("%s got %d", path, rec.Code)
+		}
+	}
+	for _, path := range []string{"/posts/x/vote", "/comments/0/vote"} {
+		if rec := ts.send(alice, http.MethodPost, path, `{"value": 1}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s got %d", path, rec.Code)
+		}
+	}
+}
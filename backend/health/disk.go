@@ -0,0 +1,24 @@
+package health
+
+import (
+	"context"
+	"fmt"
+)
+
+// DiskSpace fails when the file system holding path has less than minFree bytes left for us
+func DiskSpace(path string, minFree uint64) CheckFunc {
+	return func(ctx context.Context) (map[string]any, error) {
+		free, total, err := diskUsage(path)
+		if err == errDiskUsageUnsupported {
+			return map[string]any{"path": path, "supported": false}, nil
+		}
+		if err != nil {
+			return map[string]any{"path": path}, err
+		}
+		details := map[string]any{"path": path, "free_bytes": free, "total_bytes": total, "min_free_bytes": minFree}
+		if free < minFree {
+			return details, fmt.Errorf("only %d MB free, need at least %d MB", free>>20, minFree>>20)
+		}
+		return details, nil
+	}
+}
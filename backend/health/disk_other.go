@@ -0,0 +1,12 @@
+//go:build !unix
+
+package health
+
+import "errors"
+
+var errDiskUsageUnsupported = errors.New("disk usage is not supported on this platform")
+
+// diskUsage isn't implemented here, the check reports itself as unsupported instead of failing
+func diskUsage(path string) (free, total uint64, err error) {
+	return 0, 0, errDiskUsageUnsupported
+}
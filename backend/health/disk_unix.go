@@ -0,0 +1,19 @@
+//go:build unix
+
+package health
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errDiskUsageUnsupported = errors.New("disk usage is not supported on this platform")
+
+// diskUsage returns the bytes an unprivileged process can still use and the size of the file system
+func diskUsage(path string) (free, total uint64, err error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return 0, 0, err
+	}
+	return fs.Bavail * uint64(fs.Bsize), fs.Blocks * uint64(fs.Bsize), nil
+}
@@ -0,0 +1,103 @@
+// Package health serves the probes: GET /healthz says the process is up, GET /readyz runs the
+// registered checks (database, migrations, disk space) and answers 503 if any of them fails.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CheckFunc checks one thing. The details end up in the /readyz output next to the status,
+// return them even when failing if they help explain why.
+type CheckFunc func(ctx context.Context) (details map[string]any, err error)
+
+type check struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker runs the readiness checks, each one gets at most timeout
+type Checker struct {
+	timeout time.Duration
+	checks  []check
+	started time.Time
+}
+
+func New(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout, started: time.Now()}
+}
+
+// Add registers a check for /readyz, call it before the server starts
+func (c *Checker) Add(name string, fn CheckFunc) {
+	c.checks = append(c.checks, check{name, fn})
+}
+
+type checkResult struct {
+	Status     string         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	DurationMS float64        `json:"duration_ms"`
+	Details    map[string]any `json:"details,omitempty"`
+}
+
+type report struct {
+	Status        string                 `json:"status"`
+	UptimeSeconds int64                  `json:"uptime_seconds"`
+	Checks        map[string]checkResult `json:"checks,omitempty"`
+}
+
+// Live handles GET /healthz. It doesn't look at anything outside the process, if it answers at all
+// the server isn't stuck, which is all a liveness probe should restart it for.
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, http.StatusOK, report{Status: "ok", UptimeSeconds: c.uptime()})
+}
+
+// Ready handles GET /readyz, running every check at the same time
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), c.timeout)
+	defer cancel()
+
+	results := make([]checkResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, ch := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			details, err := ch.fn(ctx)
+			result := checkResult{Status: "ok", Details: details}
+			if err != nil {
+				result.Status = "fail"
+				result.Error = err.Error()
+			}
+			result.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	rep := report{Status: "ok", UptimeSeconds: c.uptime(), Checks: map[string]checkResult{}}
+	status := http.StatusOK
+	for i, ch := range c.checks {
+		rep.Checks[ch.name] = results[i]
+		if results[i].Status != "ok" {
+			rep.Status = "fail"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	writeReport(w, status, rep)
+}
+
+func (c *Checker) uptime() int64 {
+	return int64(time.Since(c.started).Seconds())
+}
+
+func writeReport(w http.ResponseWriter, status int, rep report) {
+	w.Header().Set("Content-Type", "application/json")
+	// a cached "ok" is worse than no answer
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(rep)
+}
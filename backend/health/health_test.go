@@ -0,0 +1,73 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReady(t *testing.T) {
+	probes := New(50 * time.Millisecond)
+	probes.Add("fine", func(ctx context.Context) (map[string]any, error) {
+		return map[string]any{"answer": 42}, nil
+	})
+
+	get := func(handler http.HandlerFunc) (int, report) {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		var rep report
+		if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+			t.Fatalf("body %q isn't JSON: %v", rec.Body, err)
+		}
+		return rec.Code, rep
+	}
+
+	if status, rep := get(probes.Ready); status != http.StatusOK || rep.Status != "ok" || rep.Checks["fine"].Status != "ok" {
+		t.Errorf("got %d %+v, want 200 with every check ok", status, rep)
+	}
+
+	probes.Add("broken", func(ctx context.Context) (map[string]any, error) {
+		return nil, errors.New("disk on fire")
+	})
+	// a check that hangs is cut off by the timeout and counts as failed
+	probes.Add("slow", func(ctx context.Context) (map[string]any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	status, rep := get(probes.Ready)
+	if status != http.StatusServiceUnavailable || rep.Status != "fail" {
+		t.Errorf("got %d %q, want 503 fail", status, rep.Status)
+	}
+	if c := rep.Checks["broken"]; c.Status != "fail" || c.Error != "disk on fire" {
+		t.Errorf("broken check reported as %+v", c)
+	}
+	if c := rep.Checks["slow"]; c.Status != "fail" {
+		t.Errorf("slow check reported as %+v", c)
+	}
+	if c := rep.Checks["fine"]; c.Status != "ok" || c.Details["answer"] != float64(42) {
+		t.Errorf("fine check reported as %+v", c)
+	}
+
+	// liveness doesn't care
+	if status, rep := get(probes.Live); status != http.StatusOK || rep.Status != "ok" || rep.Checks != nil {
+		t.Errorf("got %d %+v from /healthz, want a bare 200 ok", status, rep)
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := DiskSpace(dir, 0)(context.Background()); err != nil {
+		t.Errorf("no minimum still failed: %v", err)
+	}
+	details, err := DiskSpace(dir, 1<<62)(context.Background())
+	if details["supported"] == false {
+		t.Skip("disk usage isn't supported here")
+	}
+	if err == nil {
+		t.Error("asking for 4 EB free passed")
+	}
+}
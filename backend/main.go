@@ -1,100 +1,296 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
 
+	"github.com/archonward/CampusCommons/backend/auth"
+	"github.com/archonward/CampusCommons/backend/config"
 	"github.com/archonward/CampusCommons/backend/database"
 	"github.com/archonward/CampusCommons/backend/handlers"
+	"github.com/archonward/CampusCommons/backend/health"
+	"github.com/archonward/CampusCommons/backend/metrics"
+	"github.com/archonward/CampusCommons/backend/openapi"
+	"github.com/archonward/CampusCommons/backend/ratelimit"
+	"github.com/archonward/CampusCommons/backend/store"
+	"github.com/archonward/CampusCommons/backend/store/memstore"
+	"github.com/archonward/CampusCommons/backend/store/sqlstore"
 	"github.com/rs/cors"
 )
 
 func main() {
-	
-	database.InitDB()
+	// `go run . migrate ...` manages the schema and exits, see migrate_cmd.go
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	// `go run . user ...` changes accounts and exits, see user_cmd.go
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		runUser(os.Args[2:])
+		return
+	}
+
+	// settings come from a config file, CAMPUSCOMMONS_* variables and flags, see the config package
+	cfg, args, err := config.Load(os.Args[0], os.Args[1:])
+	if err != nil {
+		log.Fatal("Invalid configuration:\n", err)
+	}
+	if len(args) > 0 {
+		log.Fatalf("Unexpected argument %q, did you mean `migrate %s`?", args[0], args[0])
+	}
+
+	// everything is logged through slog, including the log.Printf calls around the code base,
+	// which come out at info level once slog is the default
+	level, _ := cfg.LogLevel()
+	logOptions := &slog.HandlerOptions{Level: level}
+	if cfg.Log.Format == "text" {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, logOptions)))
+	} else {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, logOptions)))
+	}
+
+	// search is on wherever the database can do it, unless features.search turns it off
+	search := cfg.Features.Search == nil || *cfg.Features.Search
+
+	// the memory driver keeps everything in memory, handy for demos. Nothing is saved.
+	var st store.Store
+	if cfg.Database.Driver == "memory" {
+		st = memstore.New()
+		slog.Info("Using the in-memory store, nothing will be saved")
+	} else {
+		database.InitDB(database.Config{Driver: database.Dialect(cfg.Database.Driver), DSN: cfg.Database.DSN, Search: cfg.Features.Search})
+		st = sqlstore.New(database.DB, database.Driver, database.SearchEnabled)
+		metrics.WatchDB(database.DB)
+		search = search && database.SearchEnabled
+	}
+	srv := handlers.NewServer(handlers.Stores{Users: st, Topics: st, Posts: st, Comments: st, Search: st, Notifications: st})
+
+	auth.InitSessions(cfg.SessionSecret)
 	// I use a ServeMux here so that when we have more routes, the code will not be so confusing
 	mux := http.NewServeMux()
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintf(w, "Backend is running, database connected")
-	})
+	// liveness and readiness probes, /readyz answers 503 while a check fails
+	probes := health.New(cfg.Health.Timeout)
+	if cfg.Database.Driver != "memory" {
+		probes.Add("database", func(ctx context.Context) (map[string]any, error) {
+			return map[string]any{"driver": string(database.Driver)}, database.DB.PingContext(ctx)
+		})
+		probes.Add("migrations", func(ctx context.Context) (map[string]any, error) {
+			version, err := database.CheckMigrations(ctx)
+			return map[string]any{"version": version}, err
+		})
+		if database.DataDir != "" {
+			probes.Add("disk", health.DiskSpace(database.DataDir, cfg.Health.MinFreeDiskMB<<20))
+		}
+	}
+	mux.HandleFunc("GET /healthz", probes.Live)
+	mux.HandleFunc("GET /readyz", probes.Ready)
+	// the old name, for scripts that still poll it
+	mux.HandleFunc("GET /health", probes.Live)
 	
-	mux.HandleFunc("/login", handlers.Login)
-	//mux.HandleFunc("/topics/{id}", handlers.DeleteTopic)
+	if cfg.Features.Registration {
+		mux.HandleFunc("/register", srv.Register)
+	} else {
+		mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+			handlers.WriteError(w, r, handlers.ErrRegistrationClosed)
+		})
+	}
+	mux.HandleFunc("/login", srv.Login)
+	mux.HandleFunc("/logout", handlers.Logout)
+	mux.HandleFunc("/me", handlers.Me)
+	//mux.HandleFunc("/topics/{id}", srv.DeleteTopic)
 
 	mux.HandleFunc("/topics", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method { 	// switch here chooses which option to run based on the value of r.Method
 		case http.MethodGet:
-			handlers.GetTopics(w, r)
+			srv.GetTopics(w, r)
 		case http.MethodPost:
-			handlers.CreateTopic(w, r)
+			srv.CreateTopic(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			handlers.MethodNotAllowed(w, r)
 		}
 	})
 
 	mux.HandleFunc("/topics/{id}", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodDelete:
-			handlers.DeleteTopic(w, r)
+			srv.DeleteTopic(w, r)
 		case http.MethodPut:
-			handlers.UpdateTopic(w, r)
+			srv.UpdateTopic(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			handlers.MethodNotAllowed(w, r)
 		}
 	})
 	
 	mux.HandleFunc("/posts/{id}", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			handlers.GetPostByID(w, r)
+			srv.GetPostByID(w, r)
 		case http.MethodDelete:
-			handlers.DeletePost(w, r)
+			srv.DeletePost(w, r)
 		case http.MethodPut:
-			handlers.UpdatePost(w, r)
+			srv.UpdatePost(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			handlers.MethodNotAllowed(w, r)
 		}
 	})
 	
 	mux.HandleFunc("/posts/{id}/comments", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			handlers.GetCommentsByPost(w, r)
+			srv.GetCommentsByPost(w, r)
 		case http.MethodPost:
-			handlers.CreateComment(w, r)
+			srv.CreateComment(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			handlers.MethodNotAllowed(w, r)
 		}
 	})
 	
 	mux.HandleFunc("/topics/{id}/posts", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			handlers.GetPostsByTopic(w, r)
+			srv.GetPostsByTopic(w, r)
 		case http.MethodPost:
-			handlers.CreatePost(w, r)
+			srv.CreatePost(w, r)
+		default:
+			handlers.MethodNotAllowed(w, r)
+		}
+	})
+
+	mux.HandleFunc("/comments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			srv.UpdateComment(w, r)
+		case http.MethodDelete:
+			srv.DeleteComment(w, r)
+		default:
+			handlers.MethodNotAllowed(w, r)
+		}
+	})
+	mux.HandleFunc("GET /comments/{id}/revisions", srv.GetCommentRevisions)
+
+	mux.HandleFunc("POST /posts/{id}/vote", srv.VotePost)
+	mux.HandleFunc("POST /comments/{id}/vote", srv.VoteComment)
+
+	// full-text search over topics, posts and comments
+	if search {
+		mux.HandleFunc("GET /search", srv.Search)
+	} else {
+		mux.HandleFunc("GET /search", func(w http.ResponseWriter, r *http.Request) {
+			handlers.WriteError(w, r, handlers.ErrSearchDisabled)
+		})
+	}
+
+	// roles and topic moderators, changing them is admin only
+	mux.HandleFunc("PUT /users/{id}/role", srv.UpdateUserRole)
+	mux.HandleFunc("GET /topics/{id}/moderators", srv.GetTopicModerators)
+
+	mux.HandleFunc("/topics/{id}/moderators/{userID}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			srv.AddTopicModerator(w, r)
+		case http.MethodDelete:
+			srv.RemoveTopicModerator(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			handlers.MethodNotAllowed(w, r)
 		}
 	})
 
-	//mux.HandleFunc("/topics", handlers.GetTopics) // any request on get Topics handled here
-	//mux.HandleFunc("/topics", handlers.CreateTopic)
+	// notifications for replies, mentions and new activity on followed topics and posts
+	mux.HandleFunc("GET /notifications", srv.GetNotifications)
+	mux.HandleFunc("POST /notifications/read", srv.MarkNotificationsRead)
+	mux.HandleFunc("POST /notifications/{id}/read", srv.MarkNotificationRead)
+	mux.HandleFunc("GET /notifications/preferences", srv.GetNotificationPreferences)
+	mux.HandleFunc("PUT /notifications/preferences", srv.UpdateNotificationPreferences)
+	mux.HandleFunc("PUT /topics/{id}/follow", srv.FollowTopic)
+	mux.HandleFunc("DELETE /topics/{id}/follow", srv.UnfollowTopic)
+	mux.HandleFunc("PUT /posts/{id}/follow", srv.FollowPost)
+	mux.HandleFunc("DELETE /posts/{id}/follow", srv.UnfollowPost)
+
+	// live updates as Server-Sent Events, see handlers/event_handlers.go
+	mux.HandleFunc("GET /posts/{id}/events", srv.PostEvents)
+	mux.HandleFunc("GET /topics/{id}/events", srv.TopicEvents)
+	// the same over a WebSocket, with who is viewing and who is typing on top
+	mux.Handle("GET /ws", srv.Gateway(handlers.GatewayOptions{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		MaxConnsPerUser:  cfg.WebSocket.MaxConnectionsPerUser,
+		MaxSubscriptions: cfg.WebSocket.MaxSubscriptions,
+	}))
+
+	// Atom and RSS for feed readers, see handlers/feed_handlers.go
+	feeds := srv.Feeds(handlers.FeedOptions{Items: cfg.Feeds.Items, SiteURL: cfg.SiteURL(), APIURL: cfg.APIURL()})
+	mux.HandleFunc("GET /feed.atom", feeds.SiteAtom)
+	mux.HandleFunc("GET /feed.rss", feeds.SiteRSS)
+	mux.HandleFunc("GET /topics/{id}/feed.atom", feeds.TopicAtom)
+	mux.HandleFunc("GET /topics/{id}/feed.rss", feeds.TopicRSS)
+	mux.HandleFunc("GET /posts/{id}/comments.atom", feeds.CommentsAtom)
+
+	// the API description, see openapi/openapi.yaml. Request bodies are checked against it too.
+	spec, err := openapi.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux.HandleFunc("GET /openapi.json", spec.ServeJSON)
+	mux.HandleFunc("GET /docs", spec.ServeDocs)
+
+	// request, database pool and activity metrics for Prometheus to scrape
+	if cfg.Features.Metrics {
+		mux.Handle("GET /metrics", metrics.Handler())
+	}
+
+	//mux.HandleFunc("/topics", srv.GetTopics) // any request on get Topics handled here
+	//mux.HandleFunc("/topics", srv.CreateTopic)
 
 	// Enable CORS
 	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"http://localhost:3000"}, // React dev server
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Content-Type", "Authorization"},
-		Debug:          false, // may want to set to true to log CORS-related issues
+		AllowedOrigins:   cfg.CORS.AllowedOrigins, // the React dev server unless configured
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Last-Event-ID"}, // EventSource sends Last-Event-ID when it reconnects
+		// the request ID so the frontend can show it next to an error, and the rate limit headers
+		ExposedHeaders:   []string{"X-Request-ID", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
+		AllowCredentials: true,  // so the browser sends the session cookie along
+		Debug:            false, // may want to set to true to log CORS-related issues
 	})
 	
-	// Wrap the mux with CORS
-	handler := c.Handler(mux)
+	// Built from the inside out: the mux with JSON 404/405s, request body validation, rate limiting, session checking,
+	// panic recovery, metrics, the request log, request IDs, and CORS on the outside so preflights never need a session.
+	// Validation is inside the rate limit so a limited client can't make the server read and check its bodies.
+	handler := handlers.MuxErrors(mux)
+	handler = handlers.ValidateBodies(spec, mux, cfg.Server.MaxBodyBytes, handler)
+	if cfg.RateLimit.Enabled {
+		handler = handlers.RateLimit(limiter(cfg.RateLimit), handler)
+	}
+	handler = srv.Authenticate(handler)
+	handler = handlers.Recover(handler)
+	handler = metrics.Instrument(mux, handler)
+	handler = handlers.LogRequests(handler)
+	handler = handlers.RequestID(handler)
+	handler = c.Handler(handler)
+
+	// blocks until SIGINT/SIGTERM and the requests in flight are done, see serve.go.
+	// The event streams and WebSockets never finish by themselves so they are told to end.
+	serve(cfg, handler, srv.CloseStreams)
+
+	// nothing else runs in the background yet, so the database is the last thing to let go of
+	if database.DB != nil {
+		if err := database.DB.Close(); err != nil {
+			log.Println("Failed to close database:", err)
+		}
+	}
+	log.Println("Server stopped")
+}
 
-	port := ":8080"
-	fmt.Printf("Server starting on http://localhost%s\n", port)
-	fmt.Printf("CORS enabled for http://localhost:3000\n")
-	log.Fatal(http.ListenAndServe(port, handler))
+// limiter builds the rate limiter from the config, buckets are kept in memory
+func limiter(cfg config.RateLimit) *ratelimit.Limiter {
+	policy := func(p config.RatePolicy) ratelimit.Policy {
+		return ratelimit.Policy{Requests: p.Requests, Per: p.Per, Burst: p.Burst}
+	}
+	proxies, _ := cfg.Proxies() // checked by config.Validate already
+	return ratelimit.New(ratelimit.NewMemoryStore(), map[string]ratelimit.Policy{
+		ratelimit.Login:  policy(cfg.Login),
+		ratelimit.Writes: policy(cfg.Writes),
+		ratelimit.Reads:  policy(cfg.Reads),
+	}, proxies)
 }
@@ -0,0 +1,176 @@
+// Package metrics holds the Prometheus metrics the server exposes on /metrics: HTTP traffic per
+// route, the database connection pool, and counters for what users create.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "campuscommons"
+
+// Registry is a registry of our own rather than the global one, so only what is listed here gets exposed
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// HTTP traffic, labelled with the route pattern (/topics/{id}/posts) rather than the path,
+// so there is one series per endpoint instead of one per topic
+var (
+	requestsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	requestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to handle HTTP requests, by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	requestsInFlight = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being handled right now.",
+	})
+)
+
+// what users create, counted by the handlers once the store has saved it
+var (
+	TopicsCreated = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "topics_created_total",
+		Help:      "Topics created.",
+	})
+	PostsCreated = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_created_total",
+		Help:      "Posts created.",
+	})
+	CommentsCreated = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "comments_created_total",
+		Help:      "Comments created, replies included.",
+	})
+	VotesCast = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "votes_cast_total",
+		Help:      "Votes cast, changed or taken back, by what was voted on (post or comment).",
+	}, []string{"target"})
+	UsersRegistered = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "users_registered_total",
+		Help:      "Accounts created through /register.",
+	})
+	Logins = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Login attempts, by result (success or failure).",
+	}, []string{"result"})
+	RateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests refused by the rate limiter, by route class (login, writes or reads).",
+	}, []string{"class"})
+	NotificationsSent = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notifications_sent_total",
+		Help:      "Notifications saved for users, by type (reply, mention, new_post or new_comment).",
+	}, []string{"type"})
+)
+
+// live updates, which stay connected far longer than other requests
+var (
+	EventStreams = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "event_streams_open",
+		Help:      "Server-Sent Events streams connected right now.",
+	})
+	WebSockets = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websockets_open",
+		Help:      "WebSocket connections to /ws open right now.",
+	})
+	WebSocketsDropped = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websockets_dropped_total",
+		Help:      "WebSocket connections closed because the client couldn't keep up.",
+	})
+)
+
+// WatchDB exports the connection pool stats of db (open, in use, idle, waits and so on)
+func WatchDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Instrument records every request that goes through next. The route label comes from the
+// pattern mux would pick, requests that match no route all share the "unmatched" label.
+func Instrument(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if _, pattern := mux.Handler(r); pattern != "" {
+			route = pattern
+			// "GET /search" is labelled /search, the method has a label of its own
+			if _, path, ok := strings.Cut(pattern, " "); ok {
+				route = path
+			}
+		}
+
+		requestsInFlight.Inc()
+		defer requestsInFlight.Dec()
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			requestsTotal.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+			requestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach Flush, Hijack and deadlines on the real writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
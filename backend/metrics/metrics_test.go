@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentLabelsByRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /topics/{id}/posts", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("POST /topics", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	handler := Instrument(mux, mux)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/topics/1/posts", nil),
+		httptest.NewRequest(http.MethodGet, "/topics/2/posts", nil),
+		httptest.NewRequest(http.MethodPost, "/topics", nil),
+		httptest.NewRequest(http.MethodGet, "/nothing/here", nil),
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	for _, tt := range []struct {
+		method, route, status string
+		want                  float64
+	}{
+		{"GET", "/topics/{id}/posts", "200", 2},
+		{"POST", "/topics", "201", 1},
+		{"GET", "unmatched", "404", 1},
+	} {
+		got := testutil.ToFloat64(requestsTotal.WithLabelValues(tt.method, tt.route, tt.status))
+		if got != tt.want {
+			t.Errorf("%s %s %s: counted %v requests, want %v", tt.method, tt.route, tt.status, got, tt.want)
+		}
+	}
+	if got := testutil.ToFloat64(requestsInFlight); got != 0 {
+		t.Errorf("%v requests still in flight", got)
+	}
+}
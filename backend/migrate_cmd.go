@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/archonward/CampusCommons/backend/config"
+	"github.com/archonward/CampusCommons/backend/database"
+)
+
+const migrateUsage = `usage: go run . migrate [flags] [command]
+
+commands:
+  up         apply every pending migration (the default, the server also does this at startup)
+  down [n]   roll back the latest n migrations, 1 if n is left out
+  status     list the migrations and which ones are applied
+
+it reads the same config file, environment and -config / -db-driver / -db-dsn flags as the server`
+
+// runMigrate handles `go run . migrate ...`, it manages the schema without starting the server
+func runMigrate(args []string) {
+	cfg, args, err := config.Load("migrate", args)
+	if err != nil {
+		log.Fatal("Invalid configuration:\n", err)
+	}
+	if cfg.Database.Driver == "memory" {
+		fail("the in-memory store has no schema to migrate")
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	database.Open(database.Config{Driver: database.Dialect(cfg.Database.Driver), DSN: cfg.Database.DSN})
+	defer database.DB.Close()
+
+	switch command {
+	case "up":
+		if len(args) > 1 {
+			fail(migrateUsage)
+		}
+		if err := database.Migrate(); err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+		fmt.Println("Database is up to date")
+
+	case "down":
+		steps := 1
+		if len(args) > 2 {
+			fail(migrateUsage)
+		}
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				fail("down takes a positive number of migrations to roll back")
+			}
+			steps = n
+		}
+		if err := database.MigrateDown(steps); err != nil {
+			log.Fatal("Rollback failed: ", err)
+		}
+
+	case "status":
+		states, err := database.MigrationStatus()
+		if err != nil {
+			log.Fatal("Failed to read migration status: ", err)
+		}
+		for _, s := range states {
+			status := "pending"
+			if s.Skipped {
+				status = "skipped, the database has no " + s.Requires
+			}
+			if s.AppliedAt != nil {
+				status = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				status += " (file changed since it was applied!)"
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, status)
+		}
+
+	default:
+		fail(migrateUsage)
+	}
+}
+
+func fail(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+	os.Exit(2)
+}
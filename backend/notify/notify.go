@@ -0,0 +1,181 @@
+// Package notify works out who should hear about a new post or comment and saves their
+// notifications. Everyone gets at most one notification per post or comment, the most specific
+// one they haven't turned off: being replied to beats being mentioned, which beats activity on
+// something you follow.
+package notify
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/archonward/CampusCommons/backend/metrics"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// MaxMentions is how many different @names in one post or comment get notified, the rest are ignored
+const MaxMentions = 10
+
+// an @ that starts a word, followed by something shaped like a username (see handlers.Register).
+// Email addresses don't count because their @ comes after a letter.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.@-])@([A-Za-z0-9_.-]{3,32})`)
+
+// Mentions lists the usernames written as @name in text, each once and in the order they appear.
+// A dot at the end is taken as the end of the sentence, not part of the name.
+func Mentions(text string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(m[1], ".")
+		if len(name) < 3 || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+		if len(names) == MaxMentions {
+			break
+		}
+	}
+	return names
+}
+
+// how specific each type is, the higher one wins when someone qualifies for several
+var priority = map[string]int{
+	store.NotifyReply:      3,
+	store.NotifyMention:    2,
+	store.NotifyNewPost:    1,
+	store.NotifyNewComment: 1,
+}
+
+// Dispatcher is called by the handlers after a post or comment has been saved
+type Dispatcher struct {
+	users    store.UserStore
+	comments store.CommentStore
+	notes    store.NotificationStore
+}
+
+func New(users store.UserStore, comments store.CommentStore, notes store.NotificationStore) *Dispatcher {
+	return &Dispatcher{users: users, comments: comments, notes: notes}
+}
+
+// PostCreated notifies the people mentioned in the post and the topic's followers.
+// The author starts following their own post, so they hear about every comment on it.
+func (d *Dispatcher) PostCreated(ctx context.Context, post store.Post) error {
+	if err := d.notes.FollowPost(ctx, post.CreatedBy, post.ID); err != nil {
+		return err
+	}
+
+	r := recipients{}
+	if err := d.addMentions(ctx, r, post.Title+"\n"+post.Body); err != nil {
+		return err
+	}
+	followers, err := d.notes.TopicFollowers(ctx, post.TopicID)
+	if err != nil {
+		return err
+	}
+	for _, id := range followers {
+		r.add(id, store.NotifyNewPost)
+	}
+
+	return d.send(ctx, r, store.Notification{ActorID: post.CreatedBy, TopicID: post.TopicID, PostID: post.ID})
+}
+
+// CommentCreated notifies whoever the comment replies to (the parent comment's author, or the
+// post's author for a top level comment), the people it mentions and the post's followers
+func (d *Dispatcher) CommentCreated(ctx context.Context, post store.Post, comment store.Comment) error {
+	r := recipients{}
+	if comment.ParentID == nil {
+		r.add(post.CreatedBy, store.NotifyReply)
+	} else {
+		parent, err := d.comments.GetComment(ctx, *comment.ParentID, 0)
+		if err != nil {
+			return err
+		}
+		r.add(parent.CreatedBy, store.NotifyReply)
+	}
+	if err := d.addMentions(ctx, r, comment.Body); err != nil {
+		return err
+	}
+	followers, err := d.notes.PostFollowers(ctx, post.ID)
+	if err != nil {
+		return err
+	}
+	for _, id := range followers {
+		r.add(id, store.NotifyNewComment)
+	}
+
+	return d.send(ctx, r, store.Notification{ActorID: comment.CreatedBy, TopicID: post.TopicID, PostID: post.ID, CommentID: &comment.ID})
+}
+
+// addMentions looks up the @names in text, names nobody has are skipped
+func (d *Dispatcher) addMentions(ctx context.Context, r recipients, text string) error {
+	for _, name := range Mentions(text) {
+		user, err := d.users.GetUserByUsername(ctx, name)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		r.add(user.ID, store.NotifyMention)
+	}
+	return nil
+}
+
+// send saves one notification per recipient, copying about into each. The actor never hears
+// about their own doing, and recipients who turned off every type they qualify for are skipped.
+func (d *Dispatcher) send(ctx context.Context, r recipients, about store.Notification) error {
+	delete(r, about.ActorID)
+
+	userIDs := make([]int, 0, len(r))
+	for id := range r {
+		userIDs = append(userIDs, id)
+	}
+	sort.Ints(userIDs)
+
+	prefs, err := d.notes.NotificationPreferencesOf(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	var notes []store.Notification
+	for _, id := range userIDs {
+		typ := r.best(id, prefs[id])
+		if typ == "" {
+			continue
+		}
+		n := about
+		n.UserID = id
+		n.Type = typ
+		notes = append(notes, n)
+	}
+	if len(notes) == 0 {
+		return nil
+	}
+
+	if err := d.notes.CreateNotifications(ctx, notes); err != nil {
+		return err
+	}
+	for _, n := range notes {
+		metrics.NotificationsSent.WithLabelValues(n.Type).Inc()
+	}
+	return nil
+}
+
+// recipients maps user IDs to every type of notification they qualify for
+type recipients map[int][]string
+
+func (r recipients) add(userID int, typ string) {
+	r[userID] = append(r[userID], typ)
+}
+
+// best is the most specific type userID qualifies for and has enabled, "" if there is none
+func (r recipients) best(userID int, enabled map[string]bool) string {
+	best := ""
+	for _, typ := range r[userID] {
+		if enabled[typ] && priority[typ] > priority[best] {
+			best = typ
+		}
+	}
+	return best
+}
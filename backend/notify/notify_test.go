@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/archonward/CampusCommons/backend/store"
+	"github.com/archonward/CampusCommons/backend/store/memstore"
+)
+
+func TestMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"@alice have a look", []string{"alice"}},
+		{"thanks @bob.", []string{"bob"}},
+		{"(@carol_1) and @dave.smith, @alice @Alice", []string{"carol_1", "dave.smith", "alice"}},
+		{"mail me at someone@example.com", nil},
+		{"@al is too short, @@eve is not a mention", nil},
+		{"@a1c @b2c @c3c @d4c @e5c @f6c @g7c @h8c @i9c @j0c @k1c", []string{"a1c", "b2c", "c3c", "d4c", "e5c", "f6c", "g7c", "h8c", "i9c", "j0c"}},
+	}
+	for _, tt := range tests {
+		if got := Mentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Mentions(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+var ctx = context.Background()
+
+// setup is a topic by alice with a post by bob, carol follows the topic
+func setup(t *testing.T) (*memstore.Store, *Dispatcher, map[string]store.User, store.Topic) {
+	t.Helper()
+	s := memstore.New()
+	users := map[string]store.User{}
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		u, err := s.CreateUser(ctx, name, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[name] = u
+	}
+	topic, err := s.CreateTopic(ctx, "Golang", "", users["alice"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.FollowTopic(ctx, users["carol"].ID, topic.ID); err != nil {
+		t.Fatal(err)
+	}
+	return s, New(s, s, s), users, topic
+}
+
+// received lists the types of the notifications a user has, oldest first
+func received(t *testing.T, s *memstore.Store, user store.User) []string {
+	t.Helper()
+	page, err := s.ListNotifications(ctx, user.ID, false, store.PageRequest{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for i := len(page.Items) - 1; i >= 0; i-- {
+		types = append(types, page.Items[i].Type)
+	}
+	return types
+}
+
+func TestDispatcher(t *testing.T) {
+	s, d, users, topic := setup(t)
+	alice, bob, carol, dave := users["alice"], users["bob"], users["carol"], users["dave"]
+
+	// carol follows the topic, dave is mentioned, bob wrote it and hears nothing
+	post, err := s.CreatePost(ctx, topic.ID, "Channels", "what do you think @dave? cc @bob @nobody", bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PostCreated(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+
+	// a top level comment is a reply to the post's author, who follows their post since writing it
+	top, err := s.CreateComment(ctx, post.ID, nil, "looks good @carol", alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CommentCreated(ctx, post, top); err != nil {
+		t.Fatal(err)
+	}
+
+	// a reply goes to the parent's author, bob only hears about it as the post's follower.
+	// alice turned replies off but follows the post, so it reaches them as a new comment.
+	// dave turned mentions off and gets nothing.
+	if err := s.FollowPost(ctx, alice.ID, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetNotificationPreferences(ctx, alice.ID, map[string]bool{store.NotifyReply: false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetNotificationPreferences(ctx, dave.ID, map[string]bool{store.NotifyMention: false}); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := s.CreateComment(ctx, post.ID, &top.ID, "agreed @dave", carol.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CommentCreated(ctx, post, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"alice": {store.NotifyNewComment},
+		"bob":   {store.NotifyReply, store.NotifyNewComment},
+		"carol": {store.NotifyNewPost, store.NotifyMention},
+		"dave":  {store.NotifyMention},
+	}
+	for name, types := range want {
+		if got := received(t, s, users[name]); !reflect.DeepEqual(got, types) {
+			t.Errorf("%s got %v, want %v", name, got, types)
+		}
+	}
+
+	page, err := s.ListNotifications(ctx, alice.ID, false, store.PageRequest{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := page.Items[0]
+	if n.ActorID != carol.ID || n.TopicID != topic.ID || n.PostID != post.ID || n.CommentID == nil || *n.CommentID != reply.ID {
+		t.Errorf("alice's notification %+v", n)
+	}
+}
+
+func TestDispatcherPreferences(t *testing.T) {
+	s, d, users, topic := setup(t)
+	if err := s.SetNotificationPreferences(ctx, users["carol"].ID, map[string]bool{store.NotifyNewPost: false}); err != nil {
+		t.Fatal(err)
+	}
+
+	post, err := s.CreatePost(ctx, topic.ID, "Generics", "body", users["bob"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.PostCreated(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+	if got := received(t, s, users["carol"]); got != nil {
+		t.Errorf("carol turned new posts off but got %v", got)
+	}
+}
@@ -0,0 +1,229 @@
+package openapi
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// TestModelsMatchSpec fails when a struct the handlers send gets a field the spec doesn't have, loses one,
+// or changes its type. Fix the spec (or the struct) rather than the test.
+func TestModelsMatchSpec(t *testing.T) {
+	spec, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	models := map[string]any{
+		"User":            store.User{},
+		"Topic":           store.Topic{},
+		"Post":            store.Post{},
+		"Comment":         store.Comment{},
+		"ThreadedComment": store.ThreadedComment{},
+		"CommentRevision": store.CommentRevision{},
+		"SearchResult":    store.SearchResult{},
+		"Notification":    store.Notification{},
+	}
+	for name, model := range models {
+		t.Run(name, func(t *testing.T) {
+			ref := spec.doc.Components.Schemas[name]
+			if ref == nil {
+				t.Fatalf("the spec has no %s schema", name)
+			}
+			compareStruct(t, reflect.TypeOf(model), properties(ref.Value))
+		})
+	}
+}
+
+// properties collects the properties of a schema, following allOf, and whether each one is required
+func properties(schema *openapi3.Schema) map[string]property {
+	props := map[string]property{}
+	for _, part := range schema.AllOf {
+		for name, p := range properties(part.Value) {
+			props[name] = p
+		}
+	}
+	for name, ref := range schema.Properties {
+		props[name] = property{schema: ref.Value, required: slices.Contains(schema.Required, name)}
+	}
+	return props
+}
+
+type property struct {
+	schema   *openapi3.Schema
+	required bool
+}
+
+func compareStruct(t *testing.T, typ reflect.Type, props map[string]property) {
+	t.Helper()
+	seen := map[string]bool{}
+	for field := range jsonFields(typ) {
+		name, omitempty := field.name, field.omitempty
+		seen[name] = true
+		p, ok := props[name]
+		if !ok {
+			t.Errorf("%s.%s is sent as %q, which the spec doesn't list", typ.Name(), field.goName, name)
+			continue
+		}
+		if want := openAPIType(field.typ); !p.schema.Type.Is(want) {
+			t.Errorf("%q is a %s in Go but %v in the spec", name, want, p.schema.Type.Slice())
+		}
+		if field.typ.Kind() == reflect.Pointer && !omitempty && !p.schema.Nullable {
+			t.Errorf("%q can be null but the spec doesn't say nullable", name)
+		}
+		if p.required == omitempty {
+			t.Errorf("%q: omitempty is %v, so it should be required: %v in the spec", name, omitempty, !omitempty)
+		}
+	}
+	for name := range props {
+		if !seen[name] {
+			t.Errorf("the spec lists %q, which %s doesn't have", name, typ.Name())
+		}
+	}
+}
+
+type jsonField struct {
+	goName, name string
+	omitempty    bool
+	typ          reflect.Type
+}
+
+// jsonFields yields the fields encoding/json writes, embedded structs included
+func jsonFields(typ reflect.Type) func(yield func(jsonField) bool) {
+	return func(yield func(jsonField) bool) {
+		for i := range typ.NumField() {
+			f := typ.Field(i)
+			if f.Anonymous {
+				for inner := range jsonFields(f.Type) {
+					if !yield(inner) {
+						return
+					}
+				}
+				continue
+			}
+			tag := f.Tag.Get("json")
+			if !f.IsExported() || tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if name == "" {
+				name = f.Name
+			}
+			if !yield(jsonField{goName: f.Name, name: name, omitempty: strings.Contains(opts, "omitempty"), typ: f.Type}) {
+				return
+			}
+		}
+	}
+}
+
+func openAPIType(typ reflect.Type) string {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == reflect.TypeOf(time.Time{}) {
+		return openapi3.TypeString
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return openapi3.TypeInteger
+	case reflect.Float64, reflect.Float32:
+		return openapi3.TypeNumber
+	case reflect.String:
+		return openapi3.TypeString
+	case reflect.Bool:
+		return openapi3.TypeBoolean
+	case reflect.Slice:
+		return openapi3.TypeArray
+	default:
+		return openapi3.TypeObject
+	}
+}
+
+// TestRoutesMatchSpec reads the routes main.go registers and checks the spec has each of them, and nothing else
+func TestRoutesMatchSpec(t *testing.T) {
+	spec, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "../main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registered := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "HandleFunc" && sel.Sel.Name != "Handle") {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); !ok || ident.Name != "mux" {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok {
+			t.Errorf("%s: the route pattern isn't a string literal", fset.Position(call.Pos()))
+			return true
+		}
+		pattern, _ := strconv.Unquote(lit.Value)
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			method, path = "", pattern
+		}
+		registered[path] = true
+
+		item := spec.doc.Paths.Value(path)
+		if item == nil {
+			t.Errorf("main.go registers %s, which the spec doesn't have", path)
+			return true
+		}
+		if method != "" && item.GetOperation(method) == nil {
+			t.Errorf("main.go registers %s %s, which the spec doesn't have", method, path)
+		}
+		if method == "" && len(item.Operations()) == 0 {
+			t.Errorf("the spec has no operations for %s", path)
+		}
+		return true
+	})
+
+	if len(registered) == 0 {
+		t.Fatal("found no routes in main.go")
+	}
+	for _, path := range spec.doc.Paths.InMatchingOrder() {
+		if !registered[path] {
+			t.Errorf("the spec has %s, which main.go doesn't register", path)
+		}
+	}
+}
+
+func TestRequestSchema(t *testing.T) {
+	spec, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := spec.RequestSchema(http.MethodPost, "POST /posts/{id}/vote"); s == nil || !slices.Contains(s.Required, "value") {
+		t.Errorf("POST /posts/{id}/vote should take a body with a required value, got %v", s)
+	}
+	if s := spec.RequestSchema(http.MethodPut, "/topics/{id}"); s == nil {
+		t.Error("PUT /topics/{id} should take a body")
+	}
+	for _, c := range [][2]string{{http.MethodGet, "/topics"}, {http.MethodDelete, "/topics/{id}"}, {http.MethodGet, "/nowhere"}} {
+		if s := spec.RequestSchema(c[0], c[1]); s != nil {
+			t.Errorf("%s %s shouldn't take a body", c[0], c[1])
+		}
+	}
+}
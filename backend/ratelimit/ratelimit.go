@@ -0,0 +1,179 @@
+// Package ratelimit keeps clients from hammering the API. Every request takes a token from a bucket,
+// one bucket per client (the logged in user, or else the IP) and route class (login, writes, reads).
+// A bucket holds Burst tokens and refills at Requests per Per, an empty bucket means 429.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the route classes, each one gets its own Policy
+const (
+	Login  = "login"  // POST /login and /register, always keyed by IP since nobody is logged in yet
+	Writes = "writes" // anything that changes something
+	Reads  = "reads"
+)
+
+// Policy is how fast one client may go in one route class
+type Policy struct {
+	Requests int // the sustained rate is Requests every Per
+	Per      time.Duration
+	Burst    int // how many can come at once after a quiet spell
+}
+
+func (p Policy) rate() float64 {
+	return float64(p.Requests) / p.Per.Seconds()
+}
+
+// Result is the state of a bucket after taking from it
+type Result struct {
+	Allowed    bool
+	Limit      int           // the bucket size
+	Remaining  int           // whole tokens left
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token, zero when Allowed
+}
+
+// Bucket is the token bucket arithmetic, kept apart so another Store can reuse it for whatever it keeps
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time // zero for a new bucket, which starts full
+}
+
+// Take refills the bucket for the time since it was last used and takes a token if there is one
+func (b *Bucket) Take(p Policy, now time.Time) Result {
+	burst := float64(p.Burst)
+	if b.Updated.IsZero() {
+		b.Tokens = burst
+	} else if elapsed := now.Sub(b.Updated); elapsed > 0 {
+		b.Tokens = math.Min(burst, b.Tokens+elapsed.Seconds()*p.rate())
+	}
+	b.Updated = now
+
+	res := Result{Limit: p.Burst}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.Tokens) / p.rate())
+	}
+	res.Remaining = int(b.Tokens)
+	res.Reset = seconds((burst - b.Tokens) / p.rate())
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Store keeps the buckets. MemoryStore is enough for a single server, several servers behind a load
+// balancer need one they share (Redis, say), or a client gets a full set of buckets on each of them.
+type Store interface {
+	Take(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+// Limiter is the policies plus the store the buckets live in
+type Limiter struct {
+	store          Store
+	policies       map[string]Policy
+	trustedProxies []netip.Prefix
+}
+
+// New builds a limiter. Requests from trustedProxies are counted against the client in X-Forwarded-For
+// instead, without any every client behind a reverse proxy would share one bucket.
+func New(store Store, policies map[string]Policy, trustedProxies []netip.Prefix) *Limiter {
+	return &Limiter{store: store, policies: policies, trustedProxies: trustedProxies}
+}
+
+// Take takes a token from key's bucket for class. A class without a policy isn't limited.
+func (l *Limiter) Take(ctx context.Context, class, key string) (Result, error) {
+	p, ok := l.policies[class]
+	if !ok {
+		return Result{Allowed: true}, nil
+	}
+	// the class is part of the key, so logging in doesn't use up the reads
+	return l.store.Take(ctx, class+"|"+key, p)
+}
+
+// Policy returns the policy for class
+func (l *Limiter) Policy(class string) (Policy, bool) {
+	p, ok := l.policies[class]
+	return p, ok
+}
+
+// Classify puts a request in a route class, "" means it isn't limited at all.
+// Probes and metrics are left alone, they come from the infrastructure on a schedule.
+func Classify(r *http.Request) string {
+	switch r.URL.Path {
+	case "/healthz", "/readyz", "/health", "/metrics":
+		return ""
+	}
+	switch r.Method {
+	case http.MethodOptions:
+		return ""
+	case http.MethodGet, http.MethodHead:
+		return Reads
+	}
+	if r.Method == http.MethodPost && (r.URL.Path == "/login" || r.URL.Path == "/register") {
+		return Login
+	}
+	return Writes
+}
+
+// ClientIP is the address the request came from. When that is a trusted proxy, it walks
+// X-Forwarded-For from the right and takes the first address that isn't one, the entries
+// further left are whatever the client chose to send.
+func (l *Limiter) ClientIP(r *http.Request) string {
+	addr, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	ip := addr.Addr().Unmap()
+	if !l.trusted(ip) {
+		return ip.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap()
+		if !l.trusted(ip) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+func (l *Limiter) trusted(ip netip.Addr) bool {
+	for _, prefix := range l.trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHeaders adds the RateLimit-* headers (the IETF draft's names), and Retry-After when the request was refused
+func SetHeaders(h http.Header, p Policy, res Result) {
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", p.Requests, ceilSeconds(p.Per), p.Burst))
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(res.RetryAfter))))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	p := Policy{Requests: 60, Per: time.Minute, Burst: 3} // a token a second
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	var b Bucket
+
+	// a new bucket is full, so the burst goes through at once
+	for i := range 3 {
+		res := b.Take(p, start)
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("take %d: got %+v", i, res)
+		}
+	}
+	res := b.Take(p, start)
+	if res.Allowed || res.RetryAfter != time.Second || res.Reset != 3*time.Second {
+		t.Errorf("empty bucket: got %+v, want refused with retry in 1s and full in 3s", res)
+	}
+
+	// half a second isn't a token yet
+	if res := b.Take(p, start.Add(500*time.Millisecond)); res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("after 0.5s: got %+v", res)
+	}
+	if res := b.Take(p, start.Add(time.Second)); !res.Allowed || res.Remaining != 0 {
+		t.Errorf("after 1s: got %+v", res)
+	}
+
+	// a long wait doesn't fill it past the burst
+	if res := b.Take(p, start.Add(time.Hour)); !res.Allowed || res.Remaining != 2 {
+		t.Errorf("after an hour: got %+v", res)
+	}
+}
+
+func TestMemoryStoreForgetsFullBuckets(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	p := Policy{Requests: 10, Per: time.Second, Burst: 10}
+
+	s.Take(context.Background(), "a", p)
+	s.Take(context.Background(), "b", p)
+	if s.Len() != 2 {
+		t.Fatalf("got %d buckets, want 2", s.Len())
+	}
+
+	// both have long refilled by the next sweep, and only the one in use comes back
+	now = now.Add(sweepInterval)
+	s.Take(context.Background(), "c", p)
+	if s.Len() != 1 {
+		t.Errorf("got %d buckets after the sweep, want 1", s.Len())
+	}
+}
+
+func TestClassify(t *testing.T) {
+	cases := []struct{ method, path, want string }{
+		{http.MethodPost, "/login", Login},
+		{http.MethodPost, "/register", Login},
+		{http.MethodPost, "/topics/1/posts", Writes},
+		{http.MethodDelete, "/posts/3", Writes},
+		{http.MethodPost, "/logout", Writes},
+		{http.MethodGet, "/topics", Reads},
+		{http.MethodGet, "/login", Reads},
+		{http.MethodOptions, "/topics", ""},
+		{http.MethodGet, "/readyz", ""},
+		{http.MethodGet, "/metrics", ""},
+	}
+	for _, c := range cases {
+		if got := Classify(httptest.NewRequest(c.method, c.path, nil)); got != c.want {
+			t.Errorf("%s %s: got %q, want %q", c.method, c.path, got, c.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	l := New(NewMemoryStore(), nil, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+	cases := []struct{ remote, forwarded, want string }{
+		{"203.0.113.7:5000", "", "203.0.113.7"},
+		// only a trusted proxy gets to say who the client is
+		{"203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"10.0.0.2:5000", "198.51.100.1", "198.51.100.1"},
+		// the client can put anything at the front, the last hop before our proxies counts
+		{"10.0.0.2:5000", "1.2.3.4, 198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"10.0.0.2:5000", "", "10.0.0.2"},
+		{"[::ffff:203.0.113.7]:5000", "", "203.0.113.7"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if got := l.ClientIP(r); got != c.want {
+			t.Errorf("%s with X-Forwarded-For %q: got %s, want %s", c.remote, c.forwarded, got, c.want)
+		}
+	}
+}
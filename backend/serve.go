@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/archonward/CampusCommons/backend/config"
+)
+
+// serve runs the server until it gets SIGINT or SIGTERM, then stops taking new connections and
+// gives the requests in flight until server.shutdown_timeout to finish. It returns once they are
+// done (or cut off), so main can close the database after it. onShutdown runs as the shutdown
+// starts, for long-lived requests that need telling to finish, and is waited for like the requests.
+func serve(cfg config.Config, handler http.Handler, onShutdown ...func()) {
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	scheme, addr := "http", cfg.Listen
+	if cfg.TLSEnabled() {
+		scheme = "https"
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	slog.Info("Server starting", slog.String("url", scheme+"://"+addr), slog.String("cors_origins", strings.Join(cfg.CORS.AllowedOrigins, ", ")))
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.TLSEnabled() {
+			serveErr <- server.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		} else {
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		// it never got going, e.g. the port is taken
+		log.Fatal("Server failed: ", err)
+	case <-ctx.Done():
+	}
+	// from here on a second Ctrl+C kills the process straight away
+	stop()
+
+	log.Printf("Shutting down, waiting up to %v for requests in flight", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	// Shutdown doesn't wait for connections taken over from the server (the WebSockets), the hooks do that
+	hooksDone := make(chan struct{})
+	go func() {
+		for _, f := range onShutdown {
+			f()
+		}
+		close(hooksDone)
+	}()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Requests still running after the shutdown timeout were cut off:", err)
+		server.Close()
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Println("Server error while shutting down:", err)
+	}
+	select {
+	case <-hooksDone:
+	case <-shutdownCtx.Done():
+	}
+}
@@ -0,0 +1,219 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// comment returns a copy of the row as viewerID sees it
+func (s *Store) comment(c *commentRow, viewerID int) store.Comment {
+	comment := c.Comment
+	comment.MyVote = s.votes[voteKey{viewerID, "comment", c.ID}]
+	return comment
+}
+
+func (s *Store) GetComment(ctx context.Context, id, viewerID int) (store.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.comments[id]
+	if !ok {
+		return store.Comment{}, store.ErrNotFound
+	}
+	return s.comment(c, viewerID), nil
+}
+
+func (s *Store) CreateComment(ctx context.Context, postID int, parentID *int, body string, createdBy int) (store.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[postID]; !ok {
+		return store.Comment{}, store.ErrNotFound
+	}
+	if _, ok := s.users[createdBy]; !ok {
+		return store.Comment{}, store.ErrNotFound
+	}
+	if parentID != nil {
+		if _, ok := s.comments[*parentID]; !ok {
+			return store.Comment{}, store.ErrNotFound
+		}
+		id := *parentID
+		parentID = &id
+	}
+
+	c := &commentRow{Comment: store.Comment{
+		ID:        s.nextID("comments"),
+		PostID:    postID,
+		ParentID:  parentID,
+		Body:      body,
+		CreatedBy: createdBy,
+		CreatedAt: now(),
+	}}
+	s.comments[c.ID] = c
+	return s.comment(c, createdBy), nil
+}
+
+func (s *Store) UpdateComment(ctx context.Context, id int, body string, editedBy int) (store.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[id]
+	if !ok {
+		return store.Comment{}, store.ErrNotFound
+	}
+
+	editedAt := now()
+	s.revisions[id] = append(s.revisions[id], store.CommentRevision{
+		ID:        s.nextID("comment_revisions"),
+		CommentID: id,
+		Body:      c.Body,
+		EditedBy:  editedBy,
+		CreatedAt: editedAt,
+	})
+	c.Body = body
+	c.EditedAt = &editedAt
+	return s.comment(c, editedBy), nil
+}
+
+func (s *Store) DeleteComment(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.comments[id]; !ok {
+		return store.ErrNotFound
+	}
+	s.deleteComment(id)
+	return nil
+}
+
+// deleteComment removes a comment with its replies, revisions and votes, the caller holds the lock
+func (s *Store) deleteComment(id int) {
+	for _, c := range s.comments {
+		if c.ParentID != nil && *c.ParentID == id {
+			s.deleteComment(c.ID)
+		}
+	}
+	s.deleteVotes("comment", id)
+	for nid, n := range s.notes {
+		if n.CommentID != nil && *n.CommentID == id {
+			delete(s.notes, nid)
+		}
+	}
+	delete(s.revisions, id)
+	delete(s.comments, id)
+}
+
+func (s *Store) LatestComments(ctx context.Context, postID, limit int) ([]store.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var rows []*commentRow
+	for _, c := range s.comments {
+		if c.PostID == postID {
+			rows = append(rows, c)
+		}
+	}
+	keyOf := func(c *commentRow) sortKey { return sortKey{t: c.CreatedAt, id: c.ID} }
+	page := paginate(rows, keyOf, store.SortNew, store.PageRequest{Limit: limit})
+
+	comments := []store.Comment{}
+	for _, c := range page.Items {
+		comments = append(comments, s.comment(c, 0))
+	}
+	return comments, nil
+}
+
+func (s *Store) CommentRevisions(ctx context.Context, id int) ([]store.CommentRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// stored oldest first, listed newest first
+	stored := s.revisions[id]
+	revisions := make([]store.CommentRevision, len(stored))
+	for i, rev := range stored {
+		revisions[len(stored)-1-i] = rev
+	}
+	return revisions, nil
+}
+
+func (s *Store) VoteComment(ctx context.Context, commentID, userID, value int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.comments[commentID]
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+	c.ups, c.downs = s.setVote(voteKey{userID, "comment", commentID}, value)
+	c.Score = c.ups - c.downs
+	return c.Score, nil
+}
+
+func (s *Store) Thread(ctx context.Context, postID int, parentID *int, maxDepth int, page store.PageRequest, viewerID int) (store.Page[*store.ThreadedComment], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// the path of the parent, so depth and path stay absolute when loading more replies
+	var basePath []int
+	if parentID != nil {
+		for id := parentID; id != nil; {
+			c, ok := s.comments[*id]
+			if !ok {
+				return store.Page[*store.ThreadedComment]{}, store.ErrNotFound
+			}
+			basePath = append([]int{c.ID}, basePath...)
+			id = c.ParentID
+		}
+	}
+
+	// replies of every comment on the post, oldest first
+	replies := map[int][]*commentRow{}
+	starts := []*commentRow{}
+	for _, c := range s.comments {
+		if c.PostID != postID {
+			continue
+		}
+		isStart := c.ParentID == nil
+		if parentID != nil {
+			isStart = c.ParentID != nil && *c.ParentID == *parentID
+		}
+		if isStart {
+			starts = append(starts, c)
+		}
+		if c.ParentID != nil {
+			replies[*c.ParentID] = append(replies[*c.ParentID], c)
+		}
+	}
+	for _, list := range replies {
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	}
+
+	keyOf := func(c *commentRow) sortKey { return sortKey{t: c.CreatedAt, id: c.ID} }
+	startPage := paginate(starts, keyOf, store.SortOld, page)
+
+	comments := []*store.ThreadedComment{}
+	var walk func(c *commentRow, path []int, depth int)
+	walk = func(c *commentRow, path []int, depth int) {
+		path = append(append([]int{}, path...), c.ID)
+		tc := &store.ThreadedComment{
+			Comment:    s.comment(c, viewerID),
+			Depth:      len(path) - 1,
+			Path:       path,
+			ReplyCount: len(replies[c.ID]),
+		}
+		// stop at maxDepth, anything below that has to be loaded separately
+		tc.HasMoreReplies = tc.ReplyCount > 0 && depth == maxDepth
+		comments = append(comments, tc)
+		if depth < maxDepth {
+			for _, r := range replies[c.ID] {
+				walk(r, path, depth+1)
+			}
+		}
+	}
+	for _, c := range startPage.Items {
+		walk(c, basePath, 0)
+	}
+	return store.Page[*store.ThreadedComment]{Items: comments, Next: startPage.Next}, nil
+}
@@ -0,0 +1,170 @@
+// Package memstore implements the store interfaces in memory. Nothing is saved, it is meant for
+// tests and for trying the API out without a database. It behaves like sqlstore, down to
+// timestamps only keeping whole seconds the way SQLite's CURRENT_TIMESTAMP does.
+package memstore
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+type userRow struct {
+	store.User
+	passwordHash string
+}
+
+// postRow and commentRow keep the vote counts next to the row, like the columns in SQL.
+// MyVote is filled in per viewer when a copy is handed out.
+type postRow struct {
+	store.Post
+	ups, downs  int
+	hotRank     float64
+	controversy float64
+}
+
+type commentRow struct {
+	store.Comment
+	ups, downs int
+}
+
+type voteKey struct {
+	userID     int
+	targetType string
+	targetID   int
+}
+
+type moderatorKey struct {
+	topicID, userID int
+}
+
+// followKey is a user following a topic or a post, which one depends on the map it is in
+type followKey struct {
+	userID, targetID int
+}
+
+type preferenceKey struct {
+	userID int
+	typ    string
+}
+
+// Store implements every interface in the store package. One mutex guards everything,
+// which also makes every method atomic the way a transaction would.
+type Store struct {
+	mu           sync.RWMutex
+	users        map[int]*userRow
+	topics       map[int]*store.Topic
+	posts        map[int]*postRow
+	comments     map[int]*commentRow
+	revisions    map[int][]store.CommentRevision // by comment ID, oldest first
+	votes        map[voteKey]int
+	moderators   map[moderatorKey]bool
+	notes        map[int]*store.Notification
+	prefs        map[preferenceKey]bool
+	topicFollows map[followKey]bool
+	postFollows  map[followKey]bool
+	lastIDs      map[string]int // per table, like AUTOINCREMENT
+}
+
+func New() *Store {
+	return &Store{
+		users:        map[int]*userRow{},
+		topics:       map[int]*store.Topic{},
+		posts:        map[int]*postRow{},
+		comments:     map[int]*commentRow{},
+		revisions:    map[int][]store.CommentRevision{},
+		votes:        map[voteKey]int{},
+		moderators:   map[moderatorKey]bool{},
+		notes:        map[int]*store.Notification{},
+		prefs:        map[preferenceKey]bool{},
+		topicFollows: map[followKey]bool{},
+		postFollows:  map[followKey]bool{},
+		lastIDs:      map[string]int{},
+	}
+}
+
+var (
+	_ store.UserStore         = (*Store)(nil)
+	_ store.TopicStore        = (*Store)(nil)
+	_ store.PostStore         = (*Store)(nil)
+	_ store.CommentStore      = (*Store)(nil)
+	_ store.SearchStore       = (*Store)(nil)
+	_ store.NotificationStore = (*Store)(nil)
+)
+
+func (s *Store) nextID(table string) int {
+	s.lastIDs[table]++
+	return s.lastIDs[table]
+}
+
+// now is CURRENT_TIMESTAMP: UTC, whole seconds
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// sortKey is where a row sits in a listing, num is used by the numeric sorts and t by the others
+type sortKey struct {
+	num float64
+	t   time.Time
+	id  int
+}
+
+// compare orders two keys the way the sort lists them, ties broken by id in the same direction
+func compare(sort store.Sort, a, b sortKey) int {
+	c := 0
+	switch {
+	case sort.Numeric() && a.num != b.num:
+		c = cmpOf(a.num < b.num)
+	case !sort.Numeric() && !a.t.Equal(b.t):
+		c = cmpOf(a.t.Before(b.t))
+	case a.id != b.id:
+		c = cmpOf(a.id < b.id)
+	}
+	if sort != store.SortOld {
+		c = -c
+	}
+	return c
+}
+
+func cmpOf(less bool) int {
+	if less {
+		return -1
+	}
+	return 1
+}
+
+func cursorKey(sort store.Sort, c store.Cursor) sortKey {
+	key := sortKey{id: c.ID}
+	if sort.Numeric() {
+		key.num, _ = strconv.ParseFloat(c.Key, 64)
+	} else {
+		key.t, _ = time.Parse(store.TimeFormat, c.Key)
+	}
+	return key
+}
+
+// paginate sorts the rows, skips everything up to the cursor and returns one page
+func paginate[T any](items []T, keyOf func(T) sortKey, sortBy store.Sort, page store.PageRequest) store.Page[T] {
+	sort.Slice(items, func(i, j int) bool { return compare(sortBy, keyOf(items[i]), keyOf(items[j])) < 0 })
+
+	if page.After != nil {
+		after := cursorKey(sortBy, *page.After)
+		start := sort.Search(len(items), func(i int) bool { return compare(sortBy, keyOf(items[i]), after) > 0 })
+		items = items[start:]
+	}
+
+	result := store.Page[T]{Items: items}
+	if len(items) > page.Limit {
+		result.Items = items[:page.Limit]
+		last := keyOf(result.Items[page.Limit-1])
+		key := last.t.Format(store.TimeFormat)
+		if sortBy.Numeric() {
+			key = strconv.FormatFloat(last.num, 'g', -1, 64)
+		}
+		result.Next = &store.Cursor{Key: key, ID: last.id}
+	}
+	return result
+}
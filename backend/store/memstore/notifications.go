@@ -0,0 +1,205 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func notificationKey(n store.Notification) sortKey {
+	return sortKey{t: n.CreatedAt, id: n.ID}
+}
+
+func (s *Store) CreateNotifications(ctx context.Context, notes []store.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// check everything first, the batch goes in whole or not at all
+	for _, n := range notes {
+		_, userOK := s.users[n.UserID]
+		_, actorOK := s.users[n.ActorID]
+		_, topicOK := s.topics[n.TopicID]
+		_, postOK := s.posts[n.PostID]
+		commentOK := true
+		if n.CommentID != nil {
+			_, commentOK = s.comments[*n.CommentID]
+		}
+		if !userOK || !actorOK || !topicOK || !postOK || !commentOK {
+			return store.ErrNotFound
+		}
+	}
+	for _, n := range notes {
+		n.ID = s.nextID("notifications")
+		n.CreatedAt = now()
+		n.ReadAt = nil
+		s.notes[n.ID] = &n
+	}
+	return nil
+}
+
+func (s *Store) ListNotifications(ctx context.Context, userID int, unreadOnly bool, page store.PageRequest) (store.Page[store.Notification], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notes := []store.Notification{}
+	for _, n := range s.notes {
+		if n.UserID == userID && (!unreadOnly || n.ReadAt == nil) {
+			notes = append(notes, *n)
+		}
+	}
+	return paginate(notes, notificationKey, store.SortNew, page), nil
+}
+
+func (s *Store) UnreadNotifications(ctx context.Context, userID int) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, n := range s.notes {
+		if n.UserID == userID && n.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) MarkNotificationRead(ctx context.Context, userID, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notes[id]
+	if !ok || n.UserID != userID {
+		return store.ErrNotFound
+	}
+	if n.ReadAt == nil {
+		readAt := now()
+		n.ReadAt = &readAt
+	}
+	return nil
+}
+
+func (s *Store) MarkNotificationsRead(ctx context.Context, userID int, ids []int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var listed map[int]bool
+	if ids != nil {
+		listed = map[int]bool{}
+		for _, id := range ids {
+			listed[id] = true
+		}
+	}
+
+	marked := 0
+	readAt := now()
+	for _, n := range s.notes {
+		if n.UserID == userID && n.ReadAt == nil && (listed == nil || listed[n.ID]) {
+			n.ReadAt = &readAt
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (s *Store) NotificationPreferences(ctx context.Context, userID int) (map[string]bool, error) {
+	all, err := s.NotificationPreferencesOf(ctx, []int{userID})
+	return all[userID], err
+}
+
+func (s *Store) NotificationPreferencesOf(ctx context.Context, userIDs []int) (map[int]map[string]bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := map[int]map[string]bool{}
+	for _, id := range userIDs {
+		prefs := map[string]bool{}
+		for _, t := range store.NotificationTypes {
+			enabled, ok := s.prefs[preferenceKey{id, t}]
+			prefs[t] = enabled || !ok
+		}
+		all[id] = prefs
+	}
+	return all, nil
+}
+
+func (s *Store) SetNotificationPreferences(ctx context.Context, userID int, prefs map[string]bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return store.ErrNotFound
+	}
+	for t, enabled := range prefs {
+		s.prefs[preferenceKey{userID, t}] = enabled
+	}
+	return nil
+}
+
+func (s *Store) FollowTopic(ctx context.Context, userID, topicID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, topicOK := s.topics[topicID]
+	_, userOK := s.users[userID]
+	if !topicOK || !userOK {
+		return store.ErrNotFound
+	}
+	s.topicFollows[followKey{userID, topicID}] = true
+	return nil
+}
+
+func (s *Store) UnfollowTopic(ctx context.Context, userID, topicID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.topicFollows, followKey{userID, topicID})
+	return nil
+}
+
+func (s *Store) TopicFollowers(ctx context.Context, topicID int) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return followers(s.topicFollows, topicID), nil
+}
+
+func (s *Store) FollowPost(ctx context.Context, userID, postID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, postOK := s.posts[postID]
+	_, userOK := s.users[userID]
+	if !postOK || !userOK {
+		return store.ErrNotFound
+	}
+	s.postFollows[followKey{userID, postID}] = true
+	return nil
+}
+
+func (s *Store) UnfollowPost(ctx context.Context, userID, postID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.postFollows, followKey{userID, postID})
+	return nil
+}
+
+func (s *Store) PostFollowers(ctx context.Context, postID int) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return followers(s.postFollows, postID), nil
+}
+
+// followers lists the users following targetID in follows, sorted like the SQL version
+func followers(follows map[followKey]bool, targetID int) []int {
+	userIDs := []int{}
+	for key := range follows {
+		if key.targetID == targetID {
+			userIDs = append(userIDs, key.userID)
+		}
+	}
+	sort.Ints(userIDs)
+	return userIDs
+}
@@ -0,0 +1,168 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// post returns a copy of the row as viewerID sees it
+func (s *Store) post(p *postRow, viewerID int) store.Post {
+	post := p.Post
+	post.MyVote = s.votes[voteKey{viewerID, "post", p.ID}]
+	return post
+}
+
+func (s *Store) ListPosts(ctx context.Context, topicID int, sortBy store.Sort, since time.Time, page store.PageRequest, viewerID int) (store.Page[store.Post], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows := []*postRow{}
+	for _, p := range s.posts {
+		if p.TopicID == topicID && !p.CreatedAt.Before(since) {
+			rows = append(rows, p)
+		}
+	}
+
+	keyOf := func(p *postRow) sortKey {
+		key := sortKey{t: p.CreatedAt, id: p.ID}
+		switch sortBy {
+		case store.SortTop:
+			key.num = float64(p.Score)
+		case store.SortHot:
+			key.num = p.hotRank
+		case store.SortControversial:
+			key.num = p.controversy
+		}
+		return key
+	}
+	rowPage := paginate(rows, keyOf, sortBy, page)
+
+	posts := make([]store.Post, len(rowPage.Items))
+	for i, p := range rowPage.Items {
+		posts[i] = s.post(p, viewerID)
+	}
+	return store.Page[store.Post]{Items: posts, Next: rowPage.Next}, nil
+}
+
+func (s *Store) GetPost(ctx context.Context, id, viewerID int) (store.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.posts[id]
+	if !ok {
+		return store.Post{}, store.ErrNotFound
+	}
+	return s.post(p, viewerID), nil
+}
+
+func (s *Store) CreatePost(ctx context.Context, topicID int, title, body string, createdBy int) (store.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.topics[topicID]; !ok {
+		return store.Post{}, store.ErrNotFound
+	}
+	if _, ok := s.users[createdBy]; !ok {
+		return store.Post{}, store.ErrNotFound
+	}
+
+	createdAt := now()
+	p := &postRow{
+		Post:    store.Post{ID: s.nextID("posts"), TopicID: topicID, Title: title, Body: body, CreatedBy: createdBy, CreatedAt: createdAt},
+		hotRank: store.HotRank(0, 0, createdAt),
+	}
+	s.posts[p.ID] = p
+	return s.post(p, createdBy), nil
+}
+
+func (s *Store) UpdatePost(ctx context.Context, id int, title, body string, viewerID int) (store.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.posts[id]
+	if !ok {
+		return store.Post{}, store.ErrNotFound
+	}
+	editedAt := now()
+	p.Title = title
+	p.Body = body
+	p.EditedAt = &editedAt
+	return s.post(p, viewerID), nil
+}
+
+func (s *Store) DeletePost(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.posts[id]; !ok {
+		return store.ErrNotFound
+	}
+	s.deletePost(id)
+	return nil
+}
+
+// deletePost removes a post with its comments and votes, the caller holds the lock
+func (s *Store) deletePost(id int) {
+	for _, c := range s.comments {
+		if c.PostID == id {
+			s.deleteComment(c.ID)
+		}
+	}
+	s.deleteVotes("post", id)
+	for nid, n := range s.notes {
+		if n.PostID == id {
+			delete(s.notes, nid)
+		}
+	}
+	for key := range s.postFollows {
+		if key.targetID == id {
+			delete(s.postFollows, key)
+		}
+	}
+	delete(s.posts, id)
+}
+
+func (s *Store) VotePost(ctx context.Context, postID, userID, value int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.posts[postID]
+	if !ok {
+		return 0, store.ErrNotFound
+	}
+	p.ups, p.downs = s.setVote(voteKey{userID, "post", postID}, value)
+	p.Score = p.ups - p.downs
+	p.hotRank = store.HotRank(p.ups, p.downs, p.CreatedAt)
+	p.controversy = store.Controversy(p.ups, p.downs)
+	return p.Score, nil
+}
+
+// setVote records (or with 0 removes) one vote and recounts the target's up and down votes
+func (s *Store) setVote(key voteKey, value int) (ups, downs int) {
+	if value == 0 {
+		delete(s.votes, key)
+	} else {
+		s.votes[key] = value
+	}
+
+	for k, v := range s.votes {
+		if k.targetType == key.targetType && k.targetID == key.targetID {
+			if v > 0 {
+				ups++
+			} else {
+				downs++
+			}
+		}
+	}
+	return ups, downs
+}
+
+func (s *Store) deleteVotes(targetType string, targetID int) {
+	for k := range s.votes {
+		if k.targetType == targetType && k.targetID == targetID {
+			delete(s.votes, k)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// snippetWords is how many words of the body a snippet shows, like the 24 in sqlstore's snippet()
+const snippetWords = 24
+
+// word is one word of a text, start and end are byte offsets into it
+type word struct {
+	text       string // lower case
+	start, end int
+}
+
+// words splits text on anything that isn't a letter or digit, roughly like FTS5's unicode61 tokenizer
+func words(text string) []word {
+	var list []word
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if inWord && start < 0 {
+			start = i
+		} else if !inWord && start >= 0 {
+			list = append(list, word{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		list = append(list, word{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return list
+}
+
+// matches finds every place the term occurs in the words, as a list of flags for the matched words
+func matches(term []word, prefix bool, in []word, matched []bool) int {
+	count := 0
+	for i := 0; i+len(term) <= len(in); i++ {
+		ok := true
+		for k, w := range term {
+			last := k == len(term)-1
+			if in[i+k].text != w.text && !(last && prefix && strings.HasPrefix(in[i+k].text, w.text)) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			count++
+			for k := range term {
+				matched[i+k] = true
+			}
+		}
+	}
+	return count
+}
+
+// highlight puts the match markers around the matched words. With limit > 0 only that many
+// words are kept, starting a little before the first match, and cut off ends get an ellipsis.
+func highlight(text string, list []word, matched []bool, limit int) string {
+	from, to := 0, len(list)
+	if limit > 0 && len(list) > limit {
+		first := 0
+		for i, m := range matched {
+			if m {
+				first = i
+				break
+			}
+		}
+		from = max(0, min(first-limit/4, len(list)-limit))
+		to = from + limit
+	}
+
+	var b strings.Builder
+	start, end := 0, len(text)
+	if from > 0 {
+		b.WriteString("…")
+		start = list[from].start
+	}
+	if to < len(list) {
+		end = list[to-1].end
+	}
+	pos := start
+	for i := from; i < to; i++ {
+		if !matched[i] {
+			continue
+		}
+		b.WriteString(text[pos:list[i].start])
+		b.WriteString(store.MatchStart + text[list[i].start:list[i].end] + store.MatchEnd)
+		pos = list[i].end
+	}
+	b.WriteString(text[pos:end])
+	if to < len(list) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+type searchDoc struct {
+	result   store.SearchResult
+	rowOrder int // the rowid sqlstore's index gives the row, for the same tie breaks
+	title    string
+	body     string
+}
+
+// Search does plain word matching over everything in memory, ranked by how often the terms
+// appear with title matches counting four times as much as body matches
+func (s *Store) Search(ctx context.Context, q store.SearchQuery) ([]store.SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var docs []searchDoc
+	for _, t := range s.topics {
+		docs = append(docs, searchDoc{
+			result:   store.SearchResult{Type: "topic", ID: t.ID, TopicID: t.ID, CreatedBy: t.CreatedBy, CreatedAt: t.CreatedAt},
+			rowOrder: t.ID*4 + 1, title: t.Title, body: t.Description,
+		})
+	}
+	for _, p := range s.posts {
+		postID := p.ID
+		docs = append(docs, searchDoc{
+			result:   store.SearchResult{Type: "post", ID: p.ID, TopicID: p.TopicID, PostID: &postID, CreatedBy: p.CreatedBy, CreatedAt: p.CreatedAt},
+			rowOrder: p.ID*4 + 2, title: p.Title, body: p.Body,
+		})
+	}
+	for _, c := range s.comments {
+		postID := c.PostID
+		docs = append(docs, searchDoc{
+			result:   store.SearchResult{Type: "comment", ID: c.ID, TopicID: s.posts[c.PostID].TopicID, PostID: &postID, CreatedBy: c.CreatedBy, CreatedAt: c.CreatedAt},
+			rowOrder: c.ID*4 + 3, body: c.Body,
+		})
+	}
+
+	terms := make([][]word, len(q.Terms))
+	for i, t := range q.Terms {
+		terms[i] = words(t.Text)
+	}
+
+	type hit struct {
+		result   store.SearchResult
+		rowOrder int
+	}
+	var hits []hit
+	for _, d := range docs {
+		if !matchesFilters(q, d.result) {
+			continue
+		}
+
+		titleWords, bodyWords := words(d.title), words(d.body)
+		titleMatched, bodyMatched := make([]bool, len(titleWords)), make([]bool, len(bodyWords))
+		score := 0
+		for i, term := range terms {
+			if len(term) == 0 {
+				continue
+			}
+			n := 4*matches(term, q.Terms[i].Prefix, titleWords, titleMatched) + matches(term, q.Terms[i].Prefix, bodyWords, bodyMatched)
+			if n == 0 {
+				score = 0
+				break
+			}
+			score += n
+		}
+		if score == 0 {
+			continue
+		}
+
+		r := d.result
+		r.Title = highlight(d.title, titleWords, titleMatched, 0)
+		r.Snippet = highlight(d.body, bodyWords, bodyMatched, snippetWords)
+		r.Relevance = float64(score)
+		hits = append(hits, hit{r, d.rowOrder})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].result.Relevance != hits[j].result.Relevance {
+			return hits[i].result.Relevance > hits[j].result.Relevance
+		}
+		return hits[i].rowOrder < hits[j].rowOrder
+	})
+
+	results := []store.SearchResult{}
+	for i := q.Offset; i < len(hits) && len(results) < q.Limit; i++ {
+		results = append(results, hits[i].result)
+	}
+	return results, nil
+}
+
+// matchesFilters checks everything in the query but the terms
+func matchesFilters(q store.SearchQuery, r store.SearchResult) bool {
+	if len(q.Types) > 0 && !slices.Contains(q.Types, r.Type) {
+		return false
+	}
+	if q.TopicID != 0 && r.TopicID != q.TopicID {
+		return false
+	}
+	if q.AuthorID != 0 && r.CreatedBy != q.AuthorID {
+		return false
+	}
+	if !q.From.IsZero() && r.CreatedAt.Before(q.From) {
+		return false
+	}
+	return q.To.IsZero() || r.CreatedAt.Before(q.To)
+}
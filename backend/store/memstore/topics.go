@@ -0,0 +1,134 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func topicKey(t store.Topic) sortKey {
+	return sortKey{t: t.CreatedAt, id: t.ID}
+}
+
+func (s *Store) ListTopics(ctx context.Context, sortBy store.Sort, page store.PageRequest) (store.Page[store.Topic], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	topics := make([]store.Topic, 0, len(s.topics))
+	for _, t := range s.topics {
+		topics = append(topics, *t)
+	}
+	return paginate(topics, topicKey, sortBy, page), nil
+}
+
+func (s *Store) GetTopic(ctx context.Context, id int) (store.Topic, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.topics[id]
+	if !ok {
+		return store.Topic{}, store.ErrNotFound
+	}
+	return *t, nil
+}
+
+func (s *Store) CreateTopic(ctx context.Context, title, description string, createdBy int) (store.Topic, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[createdBy]; !ok {
+		return store.Topic{}, store.ErrNotFound
+	}
+	t := &store.Topic{ID: s.nextID("topics"), Title: title, Description: description, CreatedBy: createdBy, CreatedAt: now()}
+	s.topics[t.ID] = t
+	return *t, nil
+}
+
+func (s *Store) UpdateTopic(ctx context.Context, id int, title, description string) (store.Topic, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.topics[id]
+	if !ok {
+		return store.Topic{}, store.ErrNotFound
+	}
+	editedAt := now()
+	t.Title = title
+	t.Description = description
+	t.EditedAt = &editedAt
+	return *t, nil
+}
+
+func (s *Store) DeleteTopic(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.topics[id]; !ok {
+		return store.ErrNotFound
+	}
+	for _, p := range s.posts {
+		if p.TopicID == id {
+			s.deletePost(p.ID)
+		}
+	}
+	for key := range s.moderators {
+		if key.topicID == id {
+			delete(s.moderators, key)
+		}
+	}
+	for key := range s.topicFollows {
+		if key.targetID == id {
+			delete(s.topicFollows, key)
+		}
+	}
+	delete(s.topics, id)
+	return nil
+}
+
+func (s *Store) TopicModerators(ctx context.Context, topicID int) ([]store.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// someone who lost the moderator role keeps their assignment, but doesn't count any more
+	moderators := []store.User{}
+	for key := range s.moderators {
+		if u, ok := s.users[key.userID]; ok && key.topicID == topicID && u.Role == store.RoleModerator {
+			moderators = append(moderators, u.User)
+		}
+	}
+	sort.Slice(moderators, func(i, j int) bool { return moderators[i].Username < moderators[j].Username })
+	return moderators, nil
+}
+
+func (s *Store) IsTopicModerator(ctx context.Context, topicID, userID int) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.moderators[moderatorKey{topicID, userID}], nil
+}
+
+func (s *Store) AddTopicModerator(ctx context.Context, topicID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, topicOK := s.topics[topicID]
+	_, userOK := s.users[userID]
+	if !topicOK || !userOK {
+		return store.ErrNotFound
+	}
+	s.moderators[moderatorKey{topicID, userID}] = true
+	return nil
+}
+
+func (s *Store) RemoveTopicModerator(ctx context.Context, topicID, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := moderatorKey{topicID, userID}
+	if !s.moderators[key] {
+		return store.ErrNotFound
+	}
+	delete(s.moderators, key)
+	return nil
+}
@@ -0,0 +1,91 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func (s *Store) CreateUser(ctx context.Context, username, passwordHash string) (store.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.userByName(username); ok {
+		return store.User{}, store.ErrUsernameTaken
+	}
+
+	role := store.RoleMember
+	if len(s.users) == 0 {
+		role = store.RoleAdmin
+	}
+	u := &userRow{User: store.User{ID: s.nextID("users"), Username: username, Role: role}, passwordHash: passwordHash}
+	s.users[u.ID] = u
+	return u.User, nil
+}
+
+func (s *Store) GetUser(ctx context.Context, id int) (store.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return store.User{}, store.ErrNotFound
+	}
+	return u.User, nil
+}
+
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (store.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.userByName(username)
+	if !ok {
+		return store.User{}, store.ErrNotFound
+	}
+	return u.User, nil
+}
+
+func (s *Store) PasswordHash(ctx context.Context, username string) (store.User, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.userByName(username)
+	if !ok {
+		return store.User{}, "", store.ErrNotFound
+	}
+	return u.User, u.passwordHash, nil
+}
+
+func (s *Store) SetPassword(ctx context.Context, id int, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	u.passwordHash = passwordHash
+	return nil
+}
+
+func (s *Store) SetRole(ctx context.Context, id int, role string) (store.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return store.User{}, store.ErrNotFound
+	}
+	u.Role = role
+	return u.User, nil
+}
+
+// usernames are unique, and compared exactly like the SQLite column
+func (s *Store) userByName(username string) (*userRow, bool) {
+	for _, u := range s.users {
+		if u.Username == username {
+			return u, true
+		}
+	}
+	return nil, false
+}
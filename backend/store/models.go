@@ -0,0 +1,127 @@
+package store
+
+import "time"
+
+// ID, Username and the role used for permission checks
+type User struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type Topic struct {
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	CreatedBy   int        `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"` // nil until the topic is edited for the first time
+}
+
+type Post struct {
+	ID        int        `json:"id"`
+	TopicID   int        `json:"topic_id"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	CreatedBy int        `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"` // nil until the post is edited for the first time
+	Score     int        `json:"score"`               // upvotes minus downvotes
+	MyVote    int        `json:"my_vote"`             // -1, 0 or 1 for whoever is asking
+}
+
+type Comment struct {
+	ID        int        `json:"id"`
+	PostID    int        `json:"post_id"`
+	ParentID  *int       `json:"parent_id"` // nil for top level comments, otherwise the comment this replies to
+	Body      string     `json:"body"`
+	CreatedBy int        `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"` // nil until the comment is edited for the first time
+	Score     int        `json:"score"`               // upvotes minus downvotes
+	MyVote    int        `json:"my_vote"`             // -1, 0 or 1 for whoever is asking
+}
+
+// ThreadedComment is a comment plus where it sits in the reply tree.
+// Depth 0 is a top level comment, Path is the IDs from the top level comment down to this one.
+// When HasMoreReplies is true the replies were cut off by the depth limit.
+type ThreadedComment struct {
+	Comment
+	Depth          int                `json:"depth"`
+	Path           []int              `json:"path"`
+	ReplyCount     int                `json:"reply_count"`
+	HasMoreReplies bool               `json:"has_more_replies"`
+	Replies        []*ThreadedComment `json:"replies,omitempty"` // only filled in for the tree view
+}
+
+// CommentRevision is an earlier version of a comment, saved every time it gets edited
+type CommentRevision struct {
+	ID        int       `json:"id"`
+	CommentID int       `json:"comment_id"`
+	Body      string    `json:"body"`
+	EditedBy  int       `json:"edited_by"`
+	CreatedAt time.Time `json:"created_at"` // when this version was replaced
+}
+
+// Notification types, a user can turn each of them off
+const (
+	NotifyReply      = "reply"       // someone answered your post or comment
+	NotifyMention    = "mention"     // someone wrote @yourname
+	NotifyNewPost    = "new_post"    // a post went up in a topic you follow
+	NotifyNewComment = "new_comment" // a comment went up on a post you follow
+)
+
+// NotificationTypes is every type there is
+var NotificationTypes = []string{NotifyReply, NotifyMention, NotifyNewPost, NotifyNewComment}
+
+// Notification tells UserID that ActorID did something on a post.
+// CommentID is the comment that did it, nil when it was the post itself.
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"-"`
+	Type      string     `json:"type"`
+	ActorID   int        `json:"actor_id"`
+	TopicID   int        `json:"topic_id"`
+	PostID    int        `json:"post_id"`
+	CommentID *int       `json:"comment_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at"` // nil while unread
+}
+
+// SearchTerm is one word (or a phrase, when Text has spaces) that every result has to contain.
+// Prefix matches any word starting with the last word of Text.
+type SearchTerm struct {
+	Text   string
+	Prefix bool
+}
+
+// SearchQuery is what to search for, the zero value of each filter means no filter
+type SearchQuery struct {
+	Terms    []SearchTerm
+	Types    []string // topic, post, comment
+	TopicID  int
+	AuthorID int
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+	Limit    int
+	Offset   int
+}
+
+// MatchStart and MatchEnd surround the matched words in SearchResult.Title and Snippet
+const (
+	MatchStart = "\x01"
+	MatchEnd   = "\x02"
+)
+
+// SearchResult is one hit, best matches come first
+type SearchResult struct {
+	Type      string    `json:"type"` // topic, post or comment
+	ID        int       `json:"id"`
+	TopicID   int       `json:"topic_id"`
+	PostID    *int      `json:"post_id,omitempty"` // the post itself for posts, the parent post for comments
+	CreatedBy int       `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	Title     string    `json:"title,omitempty"`
+	Snippet   string    `json:"snippet"`
+	Relevance float64   `json:"relevance"` // higher is better
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"math"
+	"time"
+)
+
+// redditEpoch is the zero point of the hot ranking (2005-12-08), it only has to stay fixed
+const redditEpoch = 1134028003
+
+// HotRank is reddit's hot formula: the order of magnitude of the score plus the post's age,
+// where every 12.5 hours newer counts as much as 10 times the votes. It doesn't change as
+// time passes, only when votes do, so it is stored on the post and can be indexed.
+func HotRank(ups, downs int, createdAt time.Time) float64 {
+	score := float64(ups - downs)
+	order := math.Log10(math.Max(math.Abs(score), 1))
+	sign := 0.0
+	if score > 0 {
+		sign = 1
+	} else if score < 0 {
+		sign = -1
+	}
+	seconds := float64(createdAt.Unix() - redditEpoch)
+	return math.Round((sign*order+seconds/45000)*1e7) / 1e7
+}
+
+// Controversy is reddit's controversial formula: lots of votes, split close to evenly
+func Controversy(ups, downs int) float64 {
+	if ups <= 0 || downs <= 0 {
+		return 0
+	}
+	magnitude := float64(ups + downs)
+	balance := float64(downs) / float64(ups)
+	if ups < downs {
+		balance = float64(ups) / float64(downs)
+	}
+	return math.Pow(magnitude, balance)
+}
@@ -0,0 +1,305 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/archonward/CampusCommons/backend/database"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// the comment columns in the order scanComment expects them
+const commentColumns = "id, post_id, parent_id, body, created_by, created_at, edited_at, score"
+
+// commentSelect is the select list for a comment, with the caller's vote on the end.
+// Its placeholder takes the viewer ID for my_vote.
+func commentSelect(alias string) string {
+	return prefixColumns(alias, commentColumns) + ", " + myVoteColumn("comment", alias+".id")
+}
+
+// scanComment copies one row of commentSelect (and any extra columns after it) into c
+func scanComment(row rowScanner, c *store.Comment, extra ...any) error {
+	var parentID sql.NullInt64
+	var editedAt sql.NullTime
+	dest := append([]any{&c.ID, &c.PostID, &parentID, &c.Body, &c.CreatedBy, &c.CreatedAt, &editedAt, &c.Score, &c.MyVote}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		c.ParentID = &id
+	}
+	if editedAt.Valid {
+		c.EditedAt = &editedAt.Time
+	}
+	return nil
+}
+
+func (s *Store) GetComment(ctx context.Context, id, viewerID int) (store.Comment, error) {
+	var c store.Comment
+	err := scanComment(s.db.QueryRowContext(ctx, `SELECT `+commentSelect("c")+`
+		FROM comments c
+		WHERE c.id = ?`, viewerID, id), &c)
+	return c, notFound(err)
+}
+
+func (s *Store) CreateComment(ctx context.Context, postID int, parentID *int, body string, createdBy int) (store.Comment, error) {
+	found, err := exists(ctx, s.db, "posts", postID)
+	if err != nil {
+		return store.Comment{}, err
+	}
+	if !found {
+		return store.Comment{}, store.ErrNotFound
+	}
+
+	id, err := insert(ctx, s.db, `INSERT INTO comments (post_id, parent_id, body, created_by)
+		VALUES (?, ?, ?, ?)`, postID, parentID, body, createdBy)
+	if err != nil {
+		return store.Comment{}, err
+	}
+	return s.GetComment(ctx, id, createdBy)
+}
+
+func (s *Store) UpdateComment(ctx context.Context, id int, body string, editedBy int) (store.Comment, error) {
+	// saving the old version and updating the comment have to happen together
+	err := s.inTx(ctx, func(tx conn) error {
+		// the CAST is for Postgres, which can't tell the type of a bare placeholder in a select list
+		result, err := tx.ExecContext(ctx, `INSERT INTO comment_revisions (comment_id, body, edited_by)
+			SELECT id, body, CAST(? AS INTEGER) FROM comments WHERE id = ?`, editedBy, id)
+		if err != nil {
+			return err
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return store.ErrNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE comments
+			SET body = ?, edited_at = CURRENT_TIMESTAMP
+			WHERE id = ?`, body, id)
+		return err
+	})
+	if err != nil {
+		return store.Comment{}, err
+	}
+	return s.GetComment(ctx, id, editedBy)
+}
+
+// DeleteComment is a single statement, replies cascade through parent_id so the whole subtree
+// goes with the comment, along with the revisions and votes of every comment in it
+func (s *Store) DeleteComment(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM comments WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// LatestComments ignores the reply tree, the feed has every comment as its own entry.
+// Nobody is logged in to a feed reader so my_vote is always 0.
+func (s *Store) LatestComments(ctx context.Context, postID, limit int) ([]store.Comment, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+commentSelect("c")+`
+		FROM comments c
+		WHERE c.post_id = ?
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT ?`, 0, postID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []store.Comment{}
+	for rows.Next() {
+		var c store.Comment
+		if err := scanComment(rows, &c); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func (s *Store) CommentRevisions(ctx context.Context, id int) ([]store.CommentRevision, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, comment_id, body, edited_by, created_at
+		FROM comment_revisions
+		WHERE comment_id = ?
+		ORDER BY created_at DESC, id DESC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []store.CommentRevision{}
+	for rows.Next() {
+		var rev store.CommentRevision
+		if err := rows.Scan(&rev.ID, &rev.CommentID, &rev.Body, &rev.EditedBy, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// Thread walks the reply tree of a post with a recursive query. It starts at a page of top level
+// comments, or of the direct replies of parentID when one is given, and goes maxDepth levels down.
+func (s *Store) Thread(ctx context.Context, postID int, parentID *int, maxDepth int, page store.PageRequest, viewerID int) (store.Page[*store.ThreadedComment], error) {
+	// the path of the parent, so depth and path stay absolute when loading more replies
+	var basePath []int
+	if parentID != nil {
+		var err error
+		basePath, err = s.commentPath(ctx, *parentID)
+		if err != nil {
+			return store.Page[*store.ThreadedComment]{}, err
+		}
+	}
+
+	starts, err := s.threadStarts(ctx, postID, parentID, page)
+	if err != nil || len(starts.Items) == 0 {
+		return store.Page[*store.ThreadedComment]{Items: []*store.ThreadedComment{}}, err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(starts.Items)), ", ")
+	args := make([]any, 0, len(starts.Items)+2)
+	for _, id := range starts.Items {
+		args = append(args, id)
+	}
+	args = append(args, maxDepth, viewerID)
+
+	// sort_path is the zero padded IDs joined by '/', so sorting by it gives thread order.
+	// IDs only ever go up, so ordering by ID is the same as ordering by created_at here.
+	rows, err := s.db.QueryContext(ctx, `
+		WITH RECURSIVE thread(id, depth, sort_path) AS (
+			SELECT c.id, 0, `+s.paddedID("c.id")+`
+			FROM comments c
+			WHERE c.id IN (`+placeholders+`)
+			UNION ALL
+			SELECT c.id, t.depth + 1, t.sort_path || '/' || `+s.paddedID("c.id")+`
+			FROM comments c
+			JOIN thread t ON c.parent_id = t.id
+			WHERE t.depth < ?
+		)
+		SELECT `+commentSelect("c")+`, t.depth, t.sort_path,
+			(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id)
+		FROM thread t
+		JOIN comments c ON c.id = t.id
+		ORDER BY t.sort_path`, args...)
+	if err != nil {
+		return store.Page[*store.ThreadedComment]{}, err
+	}
+	defer rows.Close()
+
+	comments := []*store.ThreadedComment{}
+	for rows.Next() {
+		var tc store.ThreadedComment
+		var sortPath string
+		if err := scanComment(rows, &tc.Comment, &tc.Depth, &sortPath, &tc.ReplyCount); err != nil {
+			return store.Page[*store.ThreadedComment]{}, err
+		}
+
+		tc.Path = append(append([]int{}, basePath...), parseSortPath(sortPath)...)
+		tc.Depth += len(basePath)
+		// the query stopped at maxDepth, anything below that has to be loaded separately
+		tc.HasMoreReplies = tc.ReplyCount > 0 && tc.Depth-len(basePath) == maxDepth
+		comments = append(comments, &tc)
+	}
+	if err := rows.Err(); err != nil {
+		return store.Page[*store.ThreadedComment]{}, err
+	}
+	return store.Page[*store.ThreadedComment]{Items: comments, Next: starts.Next}, nil
+}
+
+// threadStarts pages through the IDs of the comments a thread starts from, oldest first
+func (s *Store) threadStarts(ctx context.Context, postID int, parentID *int, page store.PageRequest) (store.Page[int], error) {
+	where := "post_id = ? AND parent_id IS NULL"
+	args := []any{postID}
+	if parentID != nil {
+		where = "post_id = ? AND parent_id = ?"
+		args = append(args, *parentID)
+	}
+	if page.After != nil {
+		where += " AND " + after(store.SortOld, "")
+		args = append(args, keysetArgs(store.SortOld, *page.After)...)
+	}
+	args = append(args, page.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id, `+s.keyColumn(store.SortOld, "")+`
+		FROM comments
+		WHERE `+where+`
+		ORDER BY `+orderBy(store.SortOld, "")+`
+		LIMIT ?`, args...)
+	if err != nil {
+		return store.Page[int]{}, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	var keys []string
+	for rows.Next() {
+		var id int
+		var key string
+		if err := rows.Scan(&id, &key); err != nil {
+			return store.Page[int]{}, err
+		}
+		ids = append(ids, id)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return store.Page[int]{}, err
+	}
+	return newPage(ids, keys, ids, page.Limit), nil
+}
+
+// commentPath returns the IDs from the top level comment down to (and including) this one
+func (s *Store) commentPath(ctx context.Context, commentID int) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		WITH RECURSIVE ancestors(id, parent_id, lvl) AS (
+			SELECT id, parent_id, 0 FROM comments WHERE id = ?
+			UNION ALL
+			SELECT c.id, c.parent_id, a.lvl + 1
+			FROM comments c
+			JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT id FROM ancestors ORDER BY lvl DESC`, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var path []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		path = append(path, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, store.ErrNotFound
+	}
+	return path, nil
+}
+
+// paddedID formats an id column as ten digits with leading zeros
+func (s *Store) paddedID(column string) string {
+	if s.dialect == database.Postgres {
+		return "lpad(CAST(" + column + " AS TEXT), 10, '0')"
+	}
+	return "printf('%010d', " + column + ")"
+}
+
+func parseSortPath(sortPath string) []int {
+	parts := strings.Split(sortPath, "/")
+	ids := make([]int, 0, len(parts))
+	for _, part := range parts {
+		id, _ := strconv.Atoi(part)
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,254 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// the notification columns in the order scanNotification expects them
+const notificationColumns = "id, user_id, type, actor_id, topic_id, post_id, comment_id, created_at, read_at"
+
+func scanNotification(row rowScanner, extra ...any) (store.Notification, error) {
+	var n store.Notification
+	var commentID sql.NullInt64
+	var readAt sql.NullTime
+	dest := append([]any{&n.ID, &n.UserID, &n.Type, &n.ActorID, &n.TopicID, &n.PostID, &commentID, &n.CreatedAt, &readAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return n, err
+	}
+	if commentID.Valid {
+		id := int(commentID.Int64)
+		n.CommentID = &id
+	}
+	if readAt.Valid {
+		n.ReadAt = &readAt.Time
+	}
+	return n, nil
+}
+
+func (s *Store) CreateNotifications(ctx context.Context, notes []store.Notification) error {
+	return s.inTx(ctx, func(tx conn) error {
+		for _, n := range notes {
+			_, err := tx.ExecContext(ctx, `INSERT INTO notifications (user_id, type, actor_id, topic_id, post_id, comment_id)
+				VALUES (?, ?, ?, ?, ?, ?)`, n.UserID, n.Type, n.ActorID, n.TopicID, n.PostID, n.CommentID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) ListNotifications(ctx context.Context, userID int, unreadOnly bool, page store.PageRequest) (store.Page[store.Notification], error) {
+	where := "WHERE user_id = ?"
+	args := []any{userID}
+	if unreadOnly {
+		where += " AND read_at IS NULL"
+	}
+	if page.After != nil {
+		where += " AND " + after(store.SortNew, "")
+		args = append(args, keysetArgs(store.SortNew, *page.After)...)
+	}
+	args = append(args, page.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+notificationColumns+`, `+s.keyColumn(store.SortNew, "")+`
+		FROM notifications
+		`+where+`
+		ORDER BY `+orderBy(store.SortNew, "")+`
+		LIMIT ?`, args...)
+	if err != nil {
+		return store.Page[store.Notification]{}, err
+	}
+	defer rows.Close()
+
+	notes := []store.Notification{}
+	var keys []string
+	var ids []int
+	for rows.Next() {
+		var key string
+		n, err := scanNotification(rows, &key)
+		if err != nil {
+			return store.Page[store.Notification]{}, err
+		}
+		notes = append(notes, n)
+		keys = append(keys, key)
+		ids = append(ids, n.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return store.Page[store.Notification]{}, err
+	}
+	return newPage(notes, keys, ids, page.Limit), nil
+}
+
+func (s *Store) UnreadNotifications(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM notifications
+		WHERE user_id = ? AND read_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
+
+func (s *Store) MarkNotificationRead(ctx context.Context, userID, id int) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE notifications
+		SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) MarkNotificationsRead(ctx context.Context, userID int, ids []int) (int, error) {
+	if ids != nil && len(ids) == 0 {
+		return 0, nil
+	}
+	where := "WHERE user_id = ? AND read_at IS NULL"
+	args := []any{userID}
+	if ids != nil {
+		where += " AND id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ") + ")"
+		for _, id := range ids {
+			args = append(args, id)
+		}
+	}
+
+	result, err := s.db.ExecContext(ctx, "UPDATE notifications SET read_at = CURRENT_TIMESTAMP "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	marked, err := result.RowsAffected()
+	return int(marked), err
+}
+
+func (s *Store) NotificationPreferences(ctx context.Context, userID int) (map[string]bool, error) {
+	all, err := s.NotificationPreferencesOf(ctx, []int{userID})
+	return all[userID], err
+}
+
+// preferencesChunk is how many users NotificationPreferencesOf asks about per query, everyone
+// following a busy topic could go past the number of parameters a query can have
+const preferencesChunk = 500
+
+func (s *Store) NotificationPreferencesOf(ctx context.Context, userIDs []int) (map[int]map[string]bool, error) {
+	all := map[int]map[string]bool{}
+	for _, id := range userIDs {
+		all[id] = map[string]bool{}
+		for _, t := range store.NotificationTypes {
+			all[id][t] = true
+		}
+	}
+
+	for len(userIDs) > 0 {
+		chunk := userIDs[:min(len(userIDs), preferencesChunk)]
+		userIDs = userIDs[len(chunk):]
+		if err := s.loadPreferences(ctx, chunk, all); err != nil {
+			return nil, err
+		}
+	}
+	return all, nil
+}
+
+// loadPreferences applies what the users in userIDs changed from the defaults to all
+func (s *Store) loadPreferences(ctx context.Context, userIDs []int, all map[int]map[string]bool) error {
+	args := make([]any, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT user_id, type, enabled FROM notification_preferences WHERE user_id IN ("+
+		strings.TrimSuffix(strings.Repeat("?, ", len(userIDs)), ", ")+")", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID int
+		var t string
+		var enabled bool
+		if err := rows.Scan(&userID, &t, &enabled); err != nil {
+			return err
+		}
+		all[userID][t] = enabled
+	}
+	return rows.Err()
+}
+
+func (s *Store) SetNotificationPreferences(ctx context.Context, userID int, prefs map[string]bool) error {
+	return s.inTx(ctx, func(tx conn) error {
+		for t, enabled := range prefs {
+			_, err := tx.ExecContext(ctx, `INSERT INTO notification_preferences (user_id, type, enabled)
+				VALUES (?, ?, ?)
+				ON CONFLICT(user_id, type)
+				DO UPDATE SET enabled = excluded.enabled`, userID, t, enabled)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) FollowTopic(ctx context.Context, userID, topicID int) error {
+	return s.follow(ctx, "topic_follows", "topic_id", "topics", userID, topicID)
+}
+
+func (s *Store) UnfollowTopic(ctx context.Context, userID, topicID int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM topic_follows WHERE user_id = ? AND topic_id = ?", userID, topicID)
+	return err
+}
+
+func (s *Store) TopicFollowers(ctx context.Context, topicID int) ([]int, error) {
+	return s.followers(ctx, "SELECT user_id FROM topic_follows WHERE topic_id = ? ORDER BY user_id", topicID)
+}
+
+func (s *Store) FollowPost(ctx context.Context, userID, postID int) error {
+	return s.follow(ctx, "post_follows", "post_id", "posts", userID, postID)
+}
+
+func (s *Store) UnfollowPost(ctx context.Context, userID, postID int) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM post_follows WHERE user_id = ? AND post_id = ?", userID, postID)
+	return err
+}
+
+func (s *Store) PostFollowers(ctx context.Context, postID int) ([]int, error) {
+	return s.followers(ctx, "SELECT user_id FROM post_follows WHERE post_id = ? ORDER BY user_id", postID)
+}
+
+// follow adds a row to one of the follows tables, checking first that what is followed exists
+// so a missing topic or post comes back as ErrNotFound rather than a foreign key error
+func (s *Store) follow(ctx context.Context, table, column, target string, userID, targetID int) error {
+	return s.inTx(ctx, func(tx conn) error {
+		found, err := exists(ctx, tx, target, targetID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return store.ErrNotFound
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO `+table+` (user_id, `+column+`)
+			VALUES (?, ?)
+			ON CONFLICT DO NOTHING`, userID, targetID)
+		return err
+	})
+}
+
+func (s *Store) followers(ctx context.Context, query string, targetID int) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, query, targetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userIDs := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
@@ -0,0 +1,127 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// the post columns in the order scanPost expects them
+const postColumns = "id, topic_id, title, body, created_by, created_at, edited_at, score"
+
+// postSelect is the select list for a post, with the caller's vote on the end.
+// The first placeholder in the query is the viewer ID for my_vote.
+func postSelect(alias string) string {
+	return prefixColumns(alias, postColumns) + ", " + myVoteColumn("post", alias+".id")
+}
+
+// scanPost copies one row of postSelect (and any extra columns after it) into a Post
+func scanPost(row rowScanner, extra ...any) (store.Post, error) {
+	var p store.Post
+	var editedAt sql.NullTime
+	dest := append([]any{&p.ID, &p.TopicID, &p.Title, &p.Body, &p.CreatedBy, &p.CreatedAt, &editedAt, &p.Score, &p.MyVote}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return p, err
+	}
+	if editedAt.Valid {
+		p.EditedAt = &editedAt.Time
+	}
+	return p, nil
+}
+
+func (s *Store) ListPosts(ctx context.Context, topicID int, sort store.Sort, since time.Time, page store.PageRequest, viewerID int) (store.Page[store.Post], error) {
+	// the first placeholder is my_vote's viewer ID inside postSelect
+	where := "p.topic_id = ?"
+	args := []any{viewerID, topicID}
+	if !since.IsZero() {
+		where += " AND p.created_at >= ?"
+		args = append(args, since.UTC().Format(store.TimeFormat))
+	}
+	if page.After != nil {
+		where += " AND " + after(sort, "p.")
+		args = append(args, keysetArgs(sort, *page.After)...)
+	}
+	args = append(args, page.Limit+1)
+
+	// The ranking columns are kept up to date when votes come in,
+	// so the database does all the sorting (and can use an index for it).
+	rows, err := s.db.QueryContext(ctx, `SELECT `+postSelect("p")+`, `+s.keyColumn(sort, "p.")+`
+		FROM posts p
+		WHERE `+where+`
+		ORDER BY `+orderBy(sort, "p.")+`
+		LIMIT ?`, args...)
+	if err != nil {
+		return store.Page[store.Post]{}, err
+	}
+	defer rows.Close()
+
+	posts := []store.Post{}
+	var keys []string
+	var ids []int
+	for rows.Next() {
+		var key string
+		p, err := scanPost(rows, &key)
+		if err != nil {
+			return store.Page[store.Post]{}, err
+		}
+		posts = append(posts, p)
+		keys = append(keys, key)
+		ids = append(ids, p.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return store.Page[store.Post]{}, err
+	}
+	return newPage(posts, keys, ids, page.Limit), nil
+}
+
+func (s *Store) GetPost(ctx context.Context, id, viewerID int) (store.Post, error) {
+	p, err := scanPost(s.db.QueryRowContext(ctx, `SELECT `+postSelect("p")+`
+		FROM posts p
+		WHERE p.id = ?`, viewerID, id))
+	return p, notFound(err)
+}
+
+func (s *Store) CreatePost(ctx context.Context, topicID int, title, body string, createdBy int) (store.Post, error) {
+	found, err := exists(ctx, s.db, "topics", topicID)
+	if err != nil {
+		return store.Post{}, err
+	}
+	if !found {
+		return store.Post{}, store.ErrNotFound
+	}
+
+	// a new post starts with no votes so its hot rank is just its age
+	id, err := insert(ctx, s.db, `INSERT INTO posts (topic_id, title, body, created_by, hot_rank)
+		VALUES (?, ?, ?, ?, ?)`, topicID, title, body, createdBy, store.HotRank(0, 0, time.Now()))
+	if err != nil {
+		return store.Post{}, err
+	}
+	return s.GetPost(ctx, id, createdBy)
+}
+
+func (s *Store) UpdatePost(ctx context.Context, id int, title, body string, viewerID int) (store.Post, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE posts
+		SET title = ?, body = ?, edited_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, title, body, id)
+	if err != nil {
+		return store.Post{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return store.Post{}, store.ErrNotFound
+	}
+	return s.GetPost(ctx, id, viewerID)
+}
+
+// DeletePost is a single statement, the comments, their revisions and every vote go with the post through the cascades
+func (s *Store) DeletePost(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM posts WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
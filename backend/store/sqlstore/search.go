@@ -0,0 +1,148 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/archonward/CampusCommons/backend/database"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// titles count for more than bodies when ranking
+const searchRank = "bm25(search_index, 4.0, 1.0)"
+
+// Search runs the query against search_index. On SQLite that is the FTS5 table from
+// migrations/sqlite/0004_search_index, on Postgres a table with a tsvector column (see migrations/postgres).
+func (s *Store) Search(ctx context.Context, q store.SearchQuery) ([]store.SearchResult, error) {
+	if !s.search {
+		return nil, store.ErrSearchUnavailable
+	}
+
+	var match string
+	if s.dialect == database.Postgres {
+		match = tsQuery(q.Terms)
+		if match == "" {
+			// nothing in the terms that Postgres would index, so nothing can match
+			return []store.SearchResult{}, nil
+		}
+	} else {
+		match = matchQuery(q.Terms)
+	}
+
+	var where []string
+	args := []any{match}
+
+	if len(q.Types) > 0 {
+		where = append(where, "doc_type IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(q.Types)), ", ")+")")
+		for _, t := range q.Types {
+			args = append(args, t)
+		}
+	}
+	if q.TopicID != 0 {
+		where = append(where, "topic_id = ?")
+		args = append(args, q.TopicID)
+	}
+	if q.AuthorID != 0 {
+		where = append(where, "created_by = ?")
+		args = append(args, q.AuthorID)
+	}
+	// created_at is stored as text in the FTS5 index, in the same format as CURRENT_TIMESTAMP
+	if !q.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, q.From.UTC().Format(store.TimeFormat))
+	}
+	if !q.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, q.To.UTC().Format(store.TimeFormat))
+	}
+	args = append(args, q.Limit, q.Offset)
+
+	filters := ""
+	if len(where) > 0 {
+		filters = " AND " + strings.Join(where, " AND ")
+	}
+
+	// char(1) and char(2) are store.MatchStart and store.MatchEnd (chr on Postgres).
+	// bm25 gives lower numbers to better matches, hence the minus for Relevance.
+	query := `
+		SELECT doc_type, doc_id, topic_id, post_id, created_by, created_at,
+			highlight(search_index, 0, char(1), char(2)),
+			snippet(search_index, 1, char(1), char(2), '…', 24),
+			-` + searchRank + `
+		FROM search_index
+		WHERE search_index MATCH ?` + filters + `
+		ORDER BY ` + searchRank + `, rowid
+		LIMIT ? OFFSET ?`
+	if s.dialect == database.Postgres {
+		// ts_rank already gives higher numbers to better matches, the A weight on titles counts most
+		query = `
+			SELECT doc_type, doc_id, topic_id, post_id, created_by, ` + s.timeText("created_at") + `,
+				ts_headline('simple', title, q, 'HighlightAll=true, StartSel=' || chr(1) || ', StopSel=' || chr(2)),
+				ts_headline('simple', body, q, 'MaxWords=24, MinWords=12, StartSel=' || chr(1) || ', StopSel=' || chr(2)),
+				ts_rank(document, q)
+			FROM search_index, to_tsquery('simple', ?) q
+			WHERE document @@ q` + filters + `
+			ORDER BY ts_rank(document, q) DESC, doc_id, doc_type
+			LIMIT ? OFFSET ?`
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []store.SearchResult{}
+	for rows.Next() {
+		var r store.SearchResult
+		var postID sql.NullInt64
+		var createdAt string
+		err := rows.Scan(&r.Type, &r.ID, &r.TopicID, &postID, &r.CreatedBy, &createdAt, &r.Title, &r.Snippet, &r.Relevance)
+		if err != nil {
+			return nil, err
+		}
+		if postID.Valid {
+			id := int(postID.Int64)
+			r.PostID = &id
+		}
+		r.CreatedAt, _ = time.Parse(store.TimeFormat, createdAt)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// matchQuery writes the terms as an FTS5 query. Every term is quoted, so nothing the user
+// typed can break the query syntax, and FTS5 requires all of them to match.
+func matchQuery(terms []store.SearchTerm) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = `"` + strings.ReplaceAll(t.Text, `"`, `""`) + `"`
+		if t.Prefix {
+			parts[i] += "*"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// tsQuery writes the terms for Postgres' to_tsquery: the words of a term have to follow each
+// other (<->) and every term has to match (&). Only letters and digits make it into a word,
+// so nothing the user typed can be read as tsquery syntax.
+func tsQuery(terms []store.SearchTerm) string {
+	var parts []string
+	for _, t := range terms {
+		words := strings.FieldsFunc(t.Text, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(words) == 0 {
+			continue
+		}
+		if t.Prefix {
+			words[len(words)-1] += ":*"
+		}
+		parts = append(parts, strings.Join(words, " <-> "))
+	}
+	return strings.Join(parts, " & ")
+}
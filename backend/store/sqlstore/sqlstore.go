@@ -0,0 +1,198 @@
+// Package sqlstore implements the store interfaces on the database set up by the database package.
+// Queries are written for SQLite with ? placeholders, the conn they go through rebinds them for
+// Postgres, and the few expressions that differ between the two are picked by dialect.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/archonward/CampusCommons/backend/database"
+	"github.com/archonward/CampusCommons/backend/store"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Store implements every interface in the store package
+type Store struct {
+	sqlDB   *sql.DB
+	db      conn
+	dialect database.Dialect
+	search  bool // the search_index table is there (always on Postgres, SQLite needs FTS5)
+}
+
+// New wraps an open database whose migrations have been applied.
+// search says whether the full-text index is available, see database.SearchEnabled.
+func New(db *sql.DB, dialect database.Dialect, search bool) *Store {
+	return &Store{sqlDB: db, db: conn{db, dialect}, dialect: dialect, search: search}
+}
+
+var (
+	_ store.UserStore         = (*Store)(nil)
+	_ store.TopicStore        = (*Store)(nil)
+	_ store.PostStore         = (*Store)(nil)
+	_ store.CommentStore      = (*Store)(nil)
+	_ store.SearchStore       = (*Store)(nil)
+	_ store.NotificationStore = (*Store)(nil)
+)
+
+// conn is a *sql.DB or *sql.Tx that rebinds every query for the dialect on the way through
+type conn struct {
+	q interface {
+		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+		QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+		QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	}
+	dialect database.Dialect
+}
+
+func (c conn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.q.ExecContext(ctx, c.dialect.Rebind(query), args...)
+}
+
+func (c conn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.q.QueryContext(ctx, c.dialect.Rebind(query), args...)
+}
+
+func (c conn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return c.q.QueryRowContext(ctx, c.dialect.Rebind(query), args...)
+}
+
+// insert runs an INSERT ... RETURNING id and gives back the new id. LastInsertId isn't
+// supported by the Postgres driver, RETURNING works on both.
+func insert(ctx context.Context, c conn, query string, args ...any) (int, error) {
+	var id int
+	err := c.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// notFound turns sql.ErrNoRows into store.ErrNotFound
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return store.ErrNotFound
+	}
+	return err
+}
+
+// uniqueViolation says whether err is an insert that broke a UNIQUE constraint, in either database
+func uniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" // unique_violation
+}
+
+// inTx runs fn in a transaction, committing if it returns nil and rolling back otherwise
+func (s *Store) inTx(ctx context.Context, fn func(tx conn) error) error {
+	tx, err := s.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op once committed
+
+	if err := fn(conn{tx, s.dialect}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// exists checks for a row with this id, table is always one of ours and never user input
+func exists(ctx context.Context, q conn, table string, id int) (bool, error) {
+	var found bool
+	err := q.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM "+table+" WHERE id = ?)", id).Scan(&found)
+	return found, err
+}
+
+// prefixColumns turns "id, body" into "c.id, c.body" for queries that join other tables
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ", ")
+	for i, col := range parts {
+		parts[i] = alias + "." + col
+	}
+	return strings.Join(parts, ", ")
+}
+
+// myVoteColumn is the select expression for the caller's own vote on each row.
+// Its placeholder takes the viewer ID.
+func myVoteColumn(targetType, idColumn string) string {
+	return `COALESCE((SELECT v.value FROM votes v
+		WHERE v.user_id = ? AND v.target_type = '` + targetType + `' AND v.target_id = ` + idColumn + `), 0)`
+}
+
+// the column each sort orders by, rows with the same value are ordered by id
+var sortColumns = map[store.Sort]struct {
+	column string
+	desc   bool
+}{
+	store.SortNew:           {"created_at", true},
+	store.SortOld:           {"created_at", false},
+	store.SortTop:           {"score", true},
+	store.SortHot:           {"hot_rank", true},
+	store.SortControversial: {"controversy", true},
+}
+
+// orderBy is the ORDER BY clause for a sort
+func orderBy(sort store.Sort, alias string) string {
+	col := sortColumns[sort]
+	dir := " ASC"
+	if col.desc {
+		dir = " DESC"
+	}
+	return alias + col.column + dir + ", " + alias + "id" + dir
+}
+
+// after is the keyset condition for rows that come after a cursor, its args come from keysetArgs
+func after(sort store.Sort, alias string) string {
+	col := sortColumns[sort]
+	op := ">"
+	if col.desc {
+		op = "<"
+	}
+	return "(" + alias + col.column + ", " + alias + "id) " + op + " (?, ?)"
+}
+
+// keysetArgs are the two values for the placeholders in after
+func keysetArgs(sort store.Sort, c store.Cursor) []any {
+	if sort.Numeric() {
+		key, _ := strconv.ParseFloat(c.Key, 64)
+		return []any{key, c.ID}
+	}
+	return []any{c.Key, c.ID}
+}
+
+// keyColumn selects the sort value in the same text form a cursor stores it in
+func (s *Store) keyColumn(sort store.Sort, alias string) string {
+	if sort.Numeric() {
+		return alias + sortColumns[sort].column
+	}
+	return s.timeText(alias + sortColumns[sort].column)
+}
+
+// timeText formats a timestamp column as store.TimeFormat
+func (s *Store) timeText(column string) string {
+	if s.dialect == database.Postgres {
+		return "to_char(" + column + ", 'YYYY-MM-DD HH24:MI:SS')"
+	}
+	return "strftime('%Y-%m-%d %H:%M:%S', " + column + ")"
+}
+
+// newPage trims the extra row a query fetched (limit+1) and makes the next cursor from the
+// last row kept. keys[i] is the sort value of items[i].
+func newPage[T any](items []T, keys []string, ids []int, limit int) store.Page[T] {
+	page := store.Page[T]{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.Next = &store.Cursor{Key: keys[limit-1], ID: ids[limit-1]}
+	}
+	return page
+}
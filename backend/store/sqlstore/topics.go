@@ -0,0 +1,151 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+const topicColumns = "id, title, description, created_by, created_at, edited_at"
+
+func scanTopic(row rowScanner, extra ...any) (store.Topic, error) {
+	var t store.Topic
+	var editedAt sql.NullTime
+	dest := append([]any{&t.ID, &t.Title, &t.Description, &t.CreatedBy, &t.CreatedAt, &editedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return t, err
+	}
+	if editedAt.Valid {
+		t.EditedAt = &editedAt.Time
+	}
+	return t, nil
+}
+
+func (s *Store) ListTopics(ctx context.Context, sort store.Sort, page store.PageRequest) (store.Page[store.Topic], error) {
+	// one row more than the limit so we know if there is another page
+	where := ""
+	args := []any{}
+	if page.After != nil {
+		where = "WHERE " + after(sort, "")
+		args = append(args, keysetArgs(sort, *page.After)...)
+	}
+	args = append(args, page.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+topicColumns+`, `+s.keyColumn(sort, "")+`
+		FROM topics
+		`+where+`
+		ORDER BY `+orderBy(sort, "")+`
+		LIMIT ?`, args...)
+	if err != nil {
+		return store.Page[store.Topic]{}, err
+	}
+	defer rows.Close()
+
+	topics := []store.Topic{}
+	var keys []string
+	var ids []int
+	for rows.Next() {
+		var key string
+		t, err := scanTopic(rows, &key)
+		if err != nil {
+			return store.Page[store.Topic]{}, err
+		}
+		topics = append(topics, t)
+		keys = append(keys, key)
+		ids = append(ids, t.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return store.Page[store.Topic]{}, err
+	}
+	return newPage(topics, keys, ids, page.Limit), nil
+}
+
+func (s *Store) GetTopic(ctx context.Context, id int) (store.Topic, error) {
+	t, err := scanTopic(s.db.QueryRowContext(ctx, "SELECT "+topicColumns+" FROM topics WHERE id = ?", id))
+	return t, notFound(err)
+}
+
+func (s *Store) CreateTopic(ctx context.Context, title, description string, createdBy int) (store.Topic, error) {
+	id, err := insert(ctx, s.db, `INSERT INTO topics (title, description, created_by)
+		VALUES (?, ?, ?)`, title, description, createdBy)
+	if err != nil {
+		return store.Topic{}, err
+	}
+	// read it back for the timestamps the database filled in
+	return s.GetTopic(ctx, id)
+}
+
+func (s *Store) UpdateTopic(ctx context.Context, id int, title, description string) (store.Topic, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE topics
+		SET title = ?, description = ?, edited_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, title, description, id)
+	if err != nil {
+		return store.Topic{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return store.Topic{}, store.ErrNotFound
+	}
+	return s.GetTopic(ctx, id)
+}
+
+// DeleteTopic is a single statement: posts, comments, revisions and moderator assignments all
+// cascade from the topic and triggers clear the votes, so the database removes everything in one go
+func (s *Store) DeleteTopic(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM topics WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// someone who lost the moderator role keeps their row, but doesn't count any more
+func (s *Store) TopicModerators(ctx context.Context, topicID int) ([]store.User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT u.id, u.username, u.role
+		FROM topic_moderators m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.topic_id = ? AND u.role = ?
+		ORDER BY u.username`, topicID, store.RoleModerator)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	moderators := []store.User{}
+	for rows.Next() {
+		var u store.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role); err != nil {
+			return nil, err
+		}
+		moderators = append(moderators, u)
+	}
+	return moderators, rows.Err()
+}
+
+func (s *Store) IsTopicModerator(ctx context.Context, topicID, userID int) (bool, error) {
+	var assigned bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM topic_moderators
+		WHERE topic_id = ? AND user_id = ?)`, topicID, userID).Scan(&assigned)
+	return assigned, err
+}
+
+func (s *Store) AddTopicModerator(ctx context.Context, topicID, userID int) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO topic_moderators (topic_id, user_id)
+		VALUES (?, ?)
+		ON CONFLICT DO NOTHING`, topicID, userID)
+	return err
+}
+
+func (s *Store) RemoveTopicModerator(ctx context.Context, topicID, userID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM topic_moderators WHERE topic_id = ? AND user_id = ?", topicID, userID)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
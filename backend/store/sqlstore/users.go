@@ -0,0 +1,74 @@
+package sqlstore
+
+import (
+	"context"
+
+	"github.com/archonward/CampusCommons/backend/database"
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func (s *Store) CreateUser(ctx context.Context, username, passwordHash string) (store.User, error) {
+	user := store.User{Username: username}
+
+	// the role is picked by the insert itself, so two people signing up at once on a fresh install
+	// can't both become admin. SQLite runs one write at a time, under READ COMMITTED Postgres could
+	// still have both see an empty table, so there sign-ups wait on a lock.
+	err := s.inTx(ctx, func(tx conn) error {
+		if s.dialect == database.Postgres {
+			if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('campuscommons.users'))"); err != nil {
+				return err
+			}
+		}
+		return tx.QueryRowContext(ctx, `INSERT INTO users (username, password_hash, role)
+			SELECT ?, ?, CASE WHEN EXISTS(SELECT 1 FROM users) THEN 'member' ELSE 'admin' END
+			RETURNING id, role`, username, passwordHash).Scan(&user.ID, &user.Role)
+	})
+	if uniqueViolation(err) {
+		return store.User{}, store.ErrUsernameTaken
+	}
+	return user, err
+}
+
+func (s *Store) GetUser(ctx context.Context, id int) (store.User, error) {
+	var user store.User
+	err := s.db.QueryRowContext(ctx, "SELECT id, username, role FROM users WHERE id = ?", id).
+		Scan(&user.ID, &user.Username, &user.Role)
+	return user, notFound(err)
+}
+
+func (s *Store) GetUserByUsername(ctx context.Context, username string) (store.User, error) {
+	var user store.User
+	err := s.db.QueryRowContext(ctx, "SELECT id, username, role FROM users WHERE username = ?", username).
+		Scan(&user.ID, &user.Username, &user.Role)
+	return user, notFound(err)
+}
+
+func (s *Store) PasswordHash(ctx context.Context, username string) (store.User, string, error) {
+	var user store.User
+	var hash string
+	err := s.db.QueryRowContext(ctx, "SELECT id, username, role, password_hash FROM users WHERE username = ?", username).
+		Scan(&user.ID, &user.Username, &user.Role, &hash)
+	return user, hash, notFound(err)
+}
+
+func (s *Store) SetPassword(ctx context.Context, id int, passwordHash string) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET password_hash = ? WHERE id = ?", passwordHash, id)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+func (s *Store) SetRole(ctx context.Context, id int, role string) (store.User, error) {
+	result, err := s.db.ExecContext(ctx, "UPDATE users SET role = ? WHERE id = ?", role, id)
+	if err != nil {
+		return store.User{}, err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return store.User{}, store.ErrNotFound
+	}
+	return s.GetUser(ctx, id)
+}
@@ -0,0 +1,77 @@
+package sqlstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+func (s *Store) VotePost(ctx context.Context, postID, userID, value int) (int, error) {
+	return s.castVote(ctx, "post", "posts", postID, userID, value)
+}
+
+func (s *Store) VoteComment(ctx context.Context, commentID, userID, value int) (int, error) {
+	return s.castVote(ctx, "comment", "comments", commentID, userID, value)
+}
+
+// castVote records the vote and updates the cached counts on the post/comment row in the
+// same transaction, so listings never have to add up votes
+func (s *Store) castVote(ctx context.Context, targetType, table string, targetID, userID, value int) (int, error) {
+	var score int
+	err := s.inTx(ctx, func(tx conn) error {
+		found, err := exists(ctx, tx, table, targetID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return store.ErrNotFound
+		}
+
+		if value == 0 {
+			_, err = tx.ExecContext(ctx, `DELETE FROM votes
+				WHERE user_id = ? AND target_type = ? AND target_id = ?`, userID, targetType, targetID)
+		} else {
+			_, err = tx.ExecContext(ctx, `INSERT INTO votes (user_id, target_type, target_id, value)
+				VALUES (?, ?, ?, ?)
+				ON CONFLICT(user_id, target_type, target_id)
+				DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`, userID, targetType, targetID, value)
+		}
+		if err != nil {
+			return err
+		}
+
+		score, err = refreshVoteCounts(ctx, tx, targetType, table, targetID)
+		return err
+	})
+	return score, err
+}
+
+// refreshVoteCounts recounts the votes of one post/comment into its upvotes, downvotes and score columns
+// (and the ranking columns for posts)
+func refreshVoteCounts(ctx context.Context, tx conn, targetType, table string, targetID int) (int, error) {
+	var ups, downs int
+	err := tx.QueryRowContext(ctx, `SELECT
+			COALESCE(SUM(CASE WHEN value = 1 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN value = -1 THEN 1 ELSE 0 END), 0)
+		FROM votes
+		WHERE target_type = ? AND target_id = ?`, targetType, targetID).Scan(&ups, &downs)
+	if err != nil {
+		return 0, err
+	}
+
+	if table != "posts" {
+		_, err = tx.ExecContext(ctx, "UPDATE "+table+" SET upvotes = ?, downvotes = ?, score = ? WHERE id = ?", ups, downs, ups-downs, targetID)
+		return ups - downs, err
+	}
+
+	// posts also keep the hot and controversial rankings, so the listing sorts can use them directly
+	var createdAt time.Time
+	if err := tx.QueryRowContext(ctx, "SELECT created_at FROM posts WHERE id = ?", targetID).Scan(&createdAt); err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE posts
+		SET upvotes = ?, downvotes = ?, score = ?, hot_rank = ?, controversy = ?
+		WHERE id = ?`, ups, downs, ups-downs, store.HotRank(ups, downs, createdAt), store.Controversy(ups, downs), targetID)
+	return ups - downs, err
+}
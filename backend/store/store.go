@@ -0,0 +1,182 @@
+// Package store is the data layer the handlers talk to. The interfaces here are implemented by
+// sqlstore (the real database) and memstore (everything in memory, for tests and demos), and the
+// handlers only ever see the interfaces.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the row asked for (or the one it hangs off) doesn't exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrUsernameTaken is returned by CreateUser when someone already has that username
+	ErrUsernameTaken = errors.New("username is already taken")
+
+	// ErrSearchUnavailable is returned by Search when the backend can't do full-text search
+	ErrSearchUnavailable = errors.New("search is not available")
+)
+
+// Roles live on the user. Moderators only have extra powers in the topics
+// they are assigned to, admins can do anything.
+const (
+	RoleMember    = "member"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Sort is a way of ordering a listing, rows with the same sort value are ordered by id
+type Sort string
+
+const (
+	SortNew           Sort = "new"
+	SortOld           Sort = "old"
+	SortTop           Sort = "top"           // by score
+	SortHot           Sort = "hot"           // by HotRank
+	SortControversial Sort = "controversial" // by Controversy
+)
+
+// Numeric is true for sorts on a number, the others sort on created_at
+func (s Sort) Numeric() bool {
+	return s == SortTop || s == SortHot || s == SortControversial
+}
+
+// TimeFormat is how cursor keys for the created_at sorts are written
+const TimeFormat = "2006-01-02 15:04:05"
+
+// Cursor marks the last row of the previous page: its value in the sort column
+// (a number, or a UTC time in TimeFormat) plus its id
+type Cursor struct {
+	Key string
+	ID  int
+}
+
+// PageRequest asks for up to Limit rows after After (nil for the first page)
+type PageRequest struct {
+	Limit int
+	After *Cursor
+}
+
+// Page is one page of a listing, Next is nil on the last page
+type Page[T any] struct {
+	Items []T
+	Next  *Cursor
+}
+
+// Store is everything the server needs from a storage backend, sqlstore and memstore both implement it
+type Store interface {
+	UserStore
+	TopicStore
+	PostStore
+	CommentStore
+	SearchStore
+	NotificationStore
+}
+
+// UserStore holds the accounts
+type UserStore interface {
+	// CreateUser adds an account. The very first account gets RoleAdmin so a fresh install
+	// can hand out roles, everyone after that starts as RoleMember.
+	CreateUser(ctx context.Context, username, passwordHash string) (User, error)
+	GetUser(ctx context.Context, id int) (User, error)
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	// PasswordHash returns the user with that username and their bcrypt hash, for logging in
+	PasswordHash(ctx context.Context, username string) (User, string, error)
+	// SetPassword replaces the hash of an account, for the operator resetting a password or
+	// giving one to an account from before logins
+	SetPassword(ctx context.Context, id int, passwordHash string) error
+	SetRole(ctx context.Context, id int, role string) (User, error)
+}
+
+// TopicStore holds topics and who moderates them
+type TopicStore interface {
+	ListTopics(ctx context.Context, sort Sort, page PageRequest) (Page[Topic], error)
+	GetTopic(ctx context.Context, id int) (Topic, error)
+	CreateTopic(ctx context.Context, title, description string, createdBy int) (Topic, error)
+	UpdateTopic(ctx context.Context, id int, title, description string) (Topic, error)
+	// DeleteTopic removes the topic with all of its posts, comments and votes
+	DeleteTopic(ctx context.Context, id int) error
+
+	// TopicModerators lists the users assigned to the topic who still have RoleModerator
+	TopicModerators(ctx context.Context, topicID int) ([]User, error)
+	IsTopicModerator(ctx context.Context, topicID, userID int) (bool, error)
+	// AddTopicModerator does nothing if the user is already assigned
+	AddTopicModerator(ctx context.Context, topicID, userID int) error
+	// RemoveTopicModerator returns ErrNotFound if the user wasn't assigned
+	RemoveTopicModerator(ctx context.Context, topicID, userID int) error
+}
+
+// PostStore holds posts and their votes. viewerID fills in Post.MyVote, 0 for anonymous.
+type PostStore interface {
+	// ListPosts pages through a topic's posts, only the ones created at or after since
+	// when it isn't the zero time
+	ListPosts(ctx context.Context, topicID int, sort Sort, since time.Time, page PageRequest, viewerID int) (Page[Post], error)
+	GetPost(ctx context.Context, id, viewerID int) (Post, error)
+	CreatePost(ctx context.Context, topicID int, title, body string, createdBy int) (Post, error)
+	UpdatePost(ctx context.Context, id int, title, body string, viewerID int) (Post, error)
+	// DeletePost removes the post with all of its comments and votes
+	DeletePost(ctx context.Context, id int) error
+	// VotePost records userID's vote (-1 or 1, 0 takes it back) and returns the post's new score
+	VotePost(ctx context.Context, postID, userID, value int) (int, error)
+}
+
+// CommentStore holds comments, their edit history and their votes.
+// viewerID fills in Comment.MyVote, 0 for anonymous.
+type CommentStore interface {
+	GetComment(ctx context.Context, id, viewerID int) (Comment, error)
+	// Thread pages through the top level comments of a post (or the direct replies of parentID),
+	// each followed by maxDepth levels of its replies, in thread order
+	Thread(ctx context.Context, postID int, parentID *int, maxDepth int, page PageRequest, viewerID int) (Page[*ThreadedComment], error)
+	CreateComment(ctx context.Context, postID int, parentID *int, body string, createdBy int) (Comment, error)
+	// UpdateComment saves the current body as a revision and replaces it
+	UpdateComment(ctx context.Context, id int, body string, editedBy int) (Comment, error)
+	// DeleteComment removes the comment with all of its replies
+	DeleteComment(ctx context.Context, id int) error
+	// LatestComments lists up to limit of a post's comments newest first, replies included, for the feeds
+	LatestComments(ctx context.Context, postID, limit int) ([]Comment, error)
+	// CommentRevisions lists the earlier versions of a comment, newest first
+	CommentRevisions(ctx context.Context, id int) ([]CommentRevision, error)
+	// VoteComment records userID's vote (-1 or 1, 0 takes it back) and returns the comment's new score
+	VoteComment(ctx context.Context, commentID, userID, value int) (int, error)
+}
+
+// NotificationStore holds notifications, what users follow and which notifications they want
+type NotificationStore interface {
+	// CreateNotifications saves a batch of notifications at once, ID, CreatedAt and ReadAt are ignored
+	CreateNotifications(ctx context.Context, notes []Notification) error
+	// ListNotifications pages through a user's notifications newest first, only the unread ones if unreadOnly
+	ListNotifications(ctx context.Context, userID int, unreadOnly bool, page PageRequest) (Page[Notification], error)
+	UnreadNotifications(ctx context.Context, userID int) (int, error)
+	// MarkNotificationRead returns ErrNotFound unless the notification is userID's, marking it twice is fine
+	MarkNotificationRead(ctx context.Context, userID, id int) error
+	// MarkNotificationsRead marks the listed notifications of userID as read, or every one of them
+	// when ids is nil, and returns how many were unread. IDs of other users' notifications are skipped.
+	MarkNotificationsRead(ctx context.Context, userID int, ids []int) (int, error)
+
+	// NotificationPreferences has an entry for every type in NotificationTypes
+	NotificationPreferences(ctx context.Context, userID int) (map[string]bool, error)
+	// NotificationPreferencesOf is NotificationPreferences for many users at once, by user ID
+	NotificationPreferencesOf(ctx context.Context, userIDs []int) (map[int]map[string]bool, error)
+	// SetNotificationPreferences only changes the types in prefs
+	SetNotificationPreferences(ctx context.Context, userID int, prefs map[string]bool) error
+
+	// FollowTopic returns ErrNotFound if the topic doesn't exist, following twice is fine
+	FollowTopic(ctx context.Context, userID, topicID int) error
+	// UnfollowTopic does nothing if the user wasn't following
+	UnfollowTopic(ctx context.Context, userID, topicID int) error
+	TopicFollowers(ctx context.Context, topicID int) ([]int, error)
+	// FollowPost returns ErrNotFound if the post doesn't exist, following twice is fine
+	FollowPost(ctx context.Context, userID, postID int) error
+	// UnfollowPost does nothing if the user wasn't following
+	UnfollowPost(ctx context.Context, userID, postID int) error
+	PostFollowers(ctx context.Context, postID int) ([]int, error)
+}
+
+// SearchStore is full-text search over topics, posts and comments
+type SearchStore interface {
+	// Search returns ErrSearchUnavailable if the backend can't search
+	Search(ctx context.Context, q SearchQuery) ([]SearchResult, error)
+}
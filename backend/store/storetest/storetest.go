@@ -0,0 +1,871 @@
+// Package storetest is the conformance suite for store.Store implementations. Every backend runs
+// it from its own tests (see memstore and sqlstore), so they all look the same to the handlers.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/archonward/CampusCommons/backend/store"
+)
+
+// Run checks the store returned by newStore, which has to be empty every time it is called
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store)
+	}{
+		{"Users", testUsers},
+		{"SignupRace", testSignupRace},
+		{"Topics", testTopics},
+		{"TopicPages", testTopicPages},
+		{"Moderators", testModerators},
+		{"Posts", testPosts},
+		{"PostSorts", testPostSorts},
+		{"Votes", testVotes},
+		{"Comments", testComments},
+		{"Threads", testThreads},
+		{"Cascades", testCascades},
+		{"Search", testSearch},
+		{"Notifications", testNotifications},
+		{"NotificationPreferences", testNotificationPreferences},
+		{"Follows", testFollows},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+var ctx = context.Background()
+
+func check(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkNotFound(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("got error %v, want store.ErrNotFound", err)
+	}
+}
+
+func newUser(t *testing.T, s store.Store, username string) store.User {
+	t.Helper()
+	user, err := s.CreateUser(ctx, username, "hash-of-"+username)
+	check(t, err)
+	return user
+}
+
+func newTopic(t *testing.T, s store.Store, title string, createdBy int) store.Topic {
+	t.Helper()
+	topic, err := s.CreateTopic(ctx, title, "about "+title, createdBy)
+	check(t, err)
+	return topic
+}
+
+func newPost(t *testing.T, s store.Store, topicID int, title, body string, createdBy int) store.Post {
+	t.Helper()
+	post, err := s.CreatePost(ctx, topicID, title, body, createdBy)
+	check(t, err)
+	return post
+}
+
+func newComment(t *testing.T, s store.Store, postID int, parentID *int, body string, createdBy int) store.Comment {
+	t.Helper()
+	comment, err := s.CreateComment(ctx, postID, parentID, body, createdBy)
+	check(t, err)
+	return comment
+}
+
+// ids lists the IDs of whatever has one, to compare orderings
+func ids[T any](items []T, id func(T) int) []int {
+	out := make([]int, len(items))
+	for i, item := range items {
+		out[i] = id(item)
+	}
+	return out
+}
+
+func sameIDs(t *testing.T, what string, got, want []int) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got IDs %v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s: got IDs %v, want %v", what, got, want)
+		}
+	}
+}
+
+func topicID(t store.Topic) int               { return t.ID }
+func postID(p store.Post) int                 { return p.ID }
+func commentID(c store.Comment) int           { return c.ID }
+func threadedID(c *store.ThreadedComment) int { return c.ID }
+func resultID(r store.SearchResult) int       { return r.ID }
+func notificationID(n store.Notification) int { return n.ID }
+func userID(u store.User) int                 { return u.ID }
+
+func testUsers(t *testing.T, s store.Store) {
+	admin := newUser(t, s, "alice")
+	if admin.Role != store.RoleAdmin {
+		t.Errorf("first user got role %q, want admin", admin.Role)
+	}
+	member := newUser(t, s, "bob")
+	if member.Role != store.RoleMember {
+		t.Errorf("second user got role %q, want member", member.Role)
+	}
+	if member.ID == admin.ID {
+		t.Fatalf("both users got ID %d", admin.ID)
+	}
+
+	if _, err := s.CreateUser(ctx, "bob", "other"); !errors.Is(err, store.ErrUsernameTaken) {
+		t.Errorf("duplicate username: got %v, want store.ErrUsernameTaken", err)
+	}
+
+	got, err := s.GetUser(ctx, member.ID)
+	check(t, err)
+	if got != member {
+		t.Errorf("GetUser: got %+v, want %+v", got, member)
+	}
+	got, err = s.GetUserByUsername(ctx, "alice")
+	check(t, err)
+	if got != admin {
+		t.Errorf("GetUserByUsername: got %+v, want %+v", got, admin)
+	}
+
+	got, hash, err := s.PasswordHash(ctx, "bob")
+	check(t, err)
+	if got != member || hash != "hash-of-bob" {
+		t.Errorf("PasswordHash: got %+v %q", got, hash)
+	}
+
+	// accounts from before logins have no hash until the operator sets one
+	legacy, err := s.CreateUser(ctx, "carol", "")
+	check(t, err)
+	check(t, s.SetPassword(ctx, legacy.ID, "hash-of-carol"))
+	if _, hash, _ := s.PasswordHash(ctx, "carol"); hash != "hash-of-carol" {
+		t.Errorf("after SetPassword the hash is %q", hash)
+	}
+
+	got, err = s.SetRole(ctx, member.ID, store.RoleModerator)
+	check(t, err)
+	if got.Role != store.RoleModerator {
+		t.Errorf("SetRole: got role %q", got.Role)
+	}
+
+	_, err = s.GetUser(ctx, 999)
+	checkNotFound(t, err)
+	_, err = s.GetUserByUsername(ctx, "nobody")
+	checkNotFound(t, err)
+	_, _, err = s.PasswordHash(ctx, "nobody")
+	checkNotFound(t, err)
+	_, err = s.SetRole(ctx, 999, store.RoleAdmin)
+	checkNotFound(t, err)
+	checkNotFound(t, s.SetPassword(ctx, 999, "hash"))
+}
+
+// testSignupRace signs people up all at once on an empty store, exactly one of them has to
+// end up admin however the inserts interleave
+func testSignupRace(t *testing.T, s store.Store) {
+	const signups = 8
+	roles := make(chan string, signups)
+	var wg sync.WaitGroup
+	for i := range signups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			user, err := s.CreateUser(ctx, fmt.Sprintf("user%d", i), "hash")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			roles <- user.Role
+		}()
+	}
+	wg.Wait()
+	close(roles)
+
+	admins := 0
+	for role := range roles {
+		if role == store.RoleAdmin {
+			admins++
+		}
+	}
+	if admins != 1 {
+		t.Errorf("%d of %d users became admin", admins, signups)
+	}
+
+	// the same username at once, one of them gets it
+	taken := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := s.CreateUser(ctx, "twin", "hash")
+			taken <- err
+		}()
+	}
+	first, second := <-taken, <-taken
+	if (first == nil) == (second == nil) || !errors.Is(errors.Join(first, second), store.ErrUsernameTaken) {
+		t.Errorf("got %v and %v, want one store.ErrUsernameTaken", first, second)
+	}
+}
+
+func testTopics(t *testing.T, s store.Store) {
+	user := newUser(t, s, "alice")
+	topic := newTopic(t, s, "Golang", user.ID)
+	if topic.ID == 0 || topic.Title != "Golang" || topic.Description != "about Golang" || topic.CreatedBy != user.ID || topic.EditedAt != nil {
+		t.Fatalf("CreateTopic returned %+v", topic)
+	}
+	if topic.CreatedAt.IsZero() || time.Since(topic.CreatedAt) > time.Minute {
+		t.Errorf("CreateTopic: created_at is %v", topic.CreatedAt)
+	}
+
+	got, err := s.GetTopic(ctx, topic.ID)
+	check(t, err)
+	if !got.CreatedAt.Equal(topic.CreatedAt) || got.Title != topic.Title {
+		t.Errorf("GetTopic: got %+v, want %+v", got, topic)
+	}
+
+	updated, err := s.UpdateTopic(ctx, topic.ID, "Go", "the language")
+	check(t, err)
+	if updated.Title != "Go" || updated.Description != "the language" || !updated.CreatedAt.Equal(topic.CreatedAt) || updated.EditedAt == nil {
+		t.Errorf("UpdateTopic returned %+v", updated)
+	}
+
+	check(t, s.DeleteTopic(ctx, topic.ID))
+	_, err = s.GetTopic(ctx, topic.ID)
+	checkNotFound(t, err)
+	checkNotFound(t, s.DeleteTopic(ctx, topic.ID))
+	_, err = s.UpdateTopic(ctx, topic.ID, "x", "y")
+	checkNotFound(t, err)
+}
+
+func testTopicPages(t *testing.T, s store.Store) {
+	user := newUser(t, s, "alice")
+	var created []int
+	for _, title := range []string{"one", "two", "three", "four", "five"} {
+		created = append(created, newTopic(t, s, title, user.ID).ID)
+	}
+
+	// topics made in the same second are ordered by ID, so old is creation order and new the reverse
+	reversed := make([]int, len(created))
+	for i, id := range created {
+		reversed[len(created)-1-i] = id
+	}
+	for sort, want := range map[store.Sort][]int{store.SortOld: created, store.SortNew: reversed} {
+		var got []int
+		page := store.PageRequest{Limit: 2}
+		for pages := 0; ; pages++ {
+			if pages > len(created) {
+				t.Fatalf("sort %s: cursors never ran out", sort)
+			}
+			result, err := s.ListTopics(ctx, sort, page)
+			check(t, err)
+			if len(result.Items) > page.Limit {
+				t.Fatalf("sort %s: got %d topics with limit %d", sort, len(result.Items), page.Limit)
+			}
+			got = append(got, ids(result.Items, topicID)...)
+			if result.Next == nil {
+				break
+			}
+			page.After = result.Next
+		}
+		sameIDs(t, "ListTopics sort "+string(sort), got, want)
+	}
+
+	result, err := s.ListTopics(ctx, store.SortNew, store.PageRequest{Limit: 5})
+	check(t, err)
+	if len(result.Items) != 5 || result.Next != nil {
+		t.Errorf("a page holding every topic should have no next cursor, got %d topics and %v", len(result.Items), result.Next)
+	}
+}
+
+func testModerators(t *testing.T, s store.Store) {
+	admin := newUser(t, s, "alice")
+	mod := newUser(t, s, "bob")
+	member := newUser(t, s, "carol")
+	topic := newTopic(t, s, "Golang", admin.ID)
+
+	_, err := s.SetRole(ctx, mod.ID, store.RoleModerator)
+	check(t, err)
+	check(t, s.AddTopicModerator(ctx, topic.ID, mod.ID))
+	check(t, s.AddTopicModerator(ctx, topic.ID, mod.ID)) // adding twice is fine
+	check(t, s.AddTopicModerator(ctx, topic.ID, member.ID))
+
+	// carol is assigned but isn't a moderator, so she isn't listed
+	mods, err := s.TopicModerators(ctx, topic.ID)
+	check(t, err)
+	sameIDs(t, "TopicModerators", ids(mods, userID), []int{mod.ID})
+
+	assigned, err := s.IsTopicModerator(ctx, topic.ID, mod.ID)
+	check(t, err)
+	if !assigned {
+		t.Error("IsTopicModerator: bob should be assigned")
+	}
+
+	check(t, s.RemoveTopicModerator(ctx, topic.ID, mod.ID))
+	checkNotFound(t, s.RemoveTopicModerator(ctx, topic.ID, mod.ID))
+	assigned, err = s.IsTopicModerator(ctx, topic.ID, mod.ID)
+	check(t, err)
+	if assigned {
+		t.Error("IsTopicModerator: bob was removed")
+	}
+}
+
+func testPosts(t *testing.T, s store.Store) {
+	user := newUser(t, s, "alice")
+	topic := newTopic(t, s, "Golang", user.ID)
+
+	_, err := s.CreatePost(ctx, 999, "title", "body", user.ID)
+	checkNotFound(t, err)
+
+	post := newPost(t, s, topic.ID, "Channels", "how do they work", user.ID)
+	if post.TopicID != topic.ID || post.Title != "Channels" || post.Body != "how do they work" || post.Score != 0 || post.MyVote != 0 || post.EditedAt != nil {
+		t.Fatalf("CreatePost returned %+v", post)
+	}
+
+	got, err := s.GetPost(ctx, post.ID, 0)
+	check(t, err)
+	if got != post {
+		t.Errorf("GetPost: got %+v, want %+v", got, post)
+	}
+
+	updated, err := s.UpdatePost(ctx, post.ID, "Channels!", "edited", user.ID)
+	check(t, err)
+	if updated.Title != "Channels!" || updated.Body != "edited" || !updated.CreatedAt.Equal(post.CreatedAt) || updated.EditedAt == nil {
+		t.Errorf("UpdatePost returned %+v", updated)
+	}
+
+	check(t, s.DeletePost(ctx, post.ID))
+	_, err = s.GetPost(ctx, post.ID, 0)
+	checkNotFound(t, err)
+	checkNotFound(t, s.DeletePost(ctx, post.ID))
+	_, err = s.UpdatePost(ctx, post.ID, "x", "y", user.ID)
+	checkNotFound(t, err)
+}
+
+func testPostSorts(t *testing.T, s store.Store) {
+	alice := newUser(t, s, "alice")
+	bob := newUser(t, s, "bob")
+	carol := newUser(t, s, "carol")
+	topic := newTopic(t, s, "Golang", alice.ID)
+	other := newTopic(t, s, "Other", alice.ID)
+
+	quiet := newPost(t, s, topic.ID, "quiet", "no votes", alice.ID)
+	liked := newPost(t, s, topic.ID, "liked", "two up", alice.ID)
+	split := newPost(t, s, topic.ID, "split", "one up one down", alice.ID)
+	disliked := newPost(t, s, topic.ID, "disliked", "one down", alice.ID)
+	newPost(t, s, other.ID, "elsewhere", "not in this topic", alice.ID)
+
+	for _, v := range []struct{ post, user, value int }{
+		{liked.ID, bob.ID, 1}, {liked.ID, carol.ID, 1},
+		{split.ID, bob.ID, 1}, {split.ID, carol.ID, -1},
+		{disliked.ID, bob.ID, -1},
+	} {
+		_, err := s.VotePost(ctx, v.post, v.user, v.value)
+		check(t, err)
+	}
+
+	list := func(sort store.Sort, since time.Time, limit int) []int {
+		t.Helper()
+		var got []int
+		page := store.PageRequest{Limit: limit}
+		for {
+			result, err := s.ListPosts(ctx, topic.ID, sort, since, page, 0)
+			check(t, err)
+			got = append(got, ids(result.Items, postID)...)
+			if result.Next == nil {
+				return got
+			}
+			page.After = result.Next
+		}
+	}
+
+	// every sort is paged one post at a time too, to check the cursors keep the order
+	for _, tt := range []struct {
+		sort store.Sort
+		want []int
+	}{
+		{store.SortOld, []int{quiet.ID, liked.ID, split.ID, disliked.ID}},
+		{store.SortNew, []int{disliked.ID, split.ID, liked.ID, quiet.ID}},
+		{store.SortTop, []int{liked.ID, split.ID, quiet.ID, disliked.ID}},
+		// hot only counts the size of the score, below 1 vote it's newest first
+		{store.SortHot, []int{liked.ID, disliked.ID, split.ID, quiet.ID}},
+		{store.SortControversial, []int{split.ID, disliked.ID, liked.ID, quiet.ID}},
+	} {
+		sameIDs(t, "ListPosts sort "+string(tt.sort), list(tt.sort, time.Time{}, 10), tt.want)
+		sameIDs(t, "ListPosts sort "+string(tt.sort)+" one per page", list(tt.sort, time.Time{}, 1), tt.want)
+	}
+
+	if got := list(store.SortTop, time.Now().Add(time.Hour), 10); len(got) != 0 {
+		t.Errorf("ListPosts since an hour from now: got %v, want nothing", got)
+	}
+	if got := list(store.SortTop, time.Now().Add(-time.Hour), 10); len(got) != 4 {
+		t.Errorf("ListPosts since an hour ago: got %v, want all 4 posts", got)
+	}
+}
+
+func testVotes(t *testing.T, s store.Store) {
+	alice := newUser(t, s, "alice")
+	bob := newUser(t, s, "bob")
+	topic := newTopic(t, s, "Golang", alice.ID)
+	post := newPost(t, s, topic.ID, "Channels", "body", alice.ID)
+	comment := newComment(t, s, post.ID, nil, "nice", bob.ID)
+
+	for _, v := range []struct{ user, value, score int }{
+		{alice.ID, 1, 1},
+		{bob.ID, 1, 2},
+		{bob.ID, -1, 0}, // changing a vote replaces it
+		{bob.ID, 0, 1},  // 0 takes it back
+		{bob.ID, 0, 1},
+	} {
+		score, err := s.VotePost(ctx, post.ID, v.user, v.value)
+		check(t, err)
+		if score != v.score {
+			t.Errorf("VotePost(user %d, %d): got score %d, want %d", v.user, v.value, score, v.score)
+		}
+	}
+
+	got, err := s.GetPost(ctx, post.ID, alice.ID)
+	check(t, err)
+	if got.Score != 1 || got.MyVote != 1 {
+		t.Errorf("alice sees score %d and my_vote %d, want 1 and 1", got.Score, got.MyVote)
+	}
+	got, err = s.GetPost(ctx, post.ID, bob.ID)
+	check(t, err)
+	if got.MyVote != 0 {
+		t.Errorf("bob took his vote back but sees my_vote %d", got.MyVote)
+	}
+	page, err := s.ListPosts(ctx, topic.ID, store.SortOld, time.Time{}, store.PageRequest{Limit: 10}, alice.ID)
+	check(t, err)
+	if len(page.Items) != 1 || page.Items[0].MyVote != 1 {
+		t.Errorf("ListPosts should carry alice's vote, got %+v", page.Items)
+	}
+
+	score, err := s.VoteComment(ctx, comment.ID, alice.ID, -1)
+	check(t, err)
+	if score != -1 {
+		t.Errorf("VoteComment: got score %d, want -1", score)
+	}
+	c, err := s.GetComment(ctx, comment.ID, alice.ID)
+	check(t, err)
+	if c.Score != -1 || c.MyVote != -1 {
+		t.Errorf("comment has score %d and my_vote %d, want -1 and -1", c.Score, c.MyVote)
+	}
+
+	_, err = s.VotePost(ctx, 999, alice.ID, 1)
+	checkNotFound(t, err)
+	_, err = s.VoteComment(ctx, 999, alice.ID, 1)
+	checkNotFound(t, err)
+}
+
+func testComments(t *testing.T, s store.Store) {
+	alice := newUser(t, s, "alice")
+	bob := newUser(t, s, "bob")
+	topic := newTopic(t, s, "Golang", alice.ID)
+	post := newPost(t, s, topic.ID, "Channels", "body", alice.ID)
+
+	_, err := s.CreateComment(ctx, 999, nil, "lost", bob.ID)
+	checkNotFound(t, err)
+
+	comment := newComment(t, s, post.ID, nil, "first", bob.ID)
+	if comment.PostID != post.ID || comment.ParentID != nil || comment.Body != "first" || comment.EditedAt != nil {
+		t.Fatalf("CreateComment returned %+v", comment)
+	}
+	reply := newComment(t, s, post.ID, &comment.ID, "reply", alice.ID)
+	if reply.ParentID == nil || *reply.ParentID != comment.ID {
+		t.Fatalf("reply has parent %v, want %d", reply.ParentID, comment.ID)
+	}
+
+	// every edit keeps the body it replaced, newest first
+	_, err = s.UpdateComment(ctx, comment.ID, "second", bob.ID)
+	check(t, err)
+	edited, err := s.UpdateComment(ctx, comment.ID, "third", alice.ID)
+	check(t, err)
+	if edited.Body != "third" || edited.EditedAt == nil {
+		t.Errorf("UpdateComment returned %+v", edited)
+	}
+	revisions, err := s.CommentRevisions(ctx, comment.ID)
+	check(t, err)
+	if len(revisions) != 2 || revisions[0].Body != "second" || revisions[0].EditedBy != alice.ID ||
+		revisions[1].Body != "first" || revisions[1].EditedBy != bob.ID {
+		t.Errorf("CommentRevisions returned %+v", revisions)
+	}
+	_, err = s.UpdateComment(ctx, 999, "x", bob.ID)
+	checkNotFound(t, err)
+
+	// the feed's view: newest first with the replies mixed in
+	other := newPost(t, s, topic.ID, "Goroutines", "body", alice.ID)
+	newComment(t, s, other.ID, nil, "elsewhere", bob.ID)
+	latest, err := s.LatestComments(ctx, post.ID, 10)
+	check(t, err)
+	sameIDs(t, "LatestComments", ids(latest, commentID), []int{reply.ID, comment.ID})
+	latest, err = s.LatestComments(ctx, post.ID, 1)
+	check(t, err)
+	sameIDs(t, "LatestComments limited", ids(latest, commentID), []int{reply.ID})
+
+	// deleting a comment takes its replies with it
+	check(t, s.DeleteComment(ctx, comment.ID))
+	_, err = s.GetComment(ctx, reply.ID, 0)
+	checkNotFound(t, err)
+	checkNotFound(t, s.DeleteComment(ctx, comment.ID))
+	revisions, err = s.CommentRevisions(ctx, comment.ID)
+	check(t, err)
+	if len(revisions) != 0 {
+		t.Errorf("revisions of a deleted comment are still there: %+v", revisions)
+	}
+}
+
+func testThreads(t *testing.T, s store.Store) {
+	user := newUser(t, s, "alice")
+	topic := newTopic(t, s, "Golang", user.ID)
+	post := newPost(t, s, topic.ID, "Channels", "body", user.ID)
+
+	// a -> b -> c, and d on its own
+	a := newComment(t, s, post.ID, nil, "a", user.ID)
+	b := newComment(t, s, post.ID, &a.ID, "b", user.ID)
+	c := newComment(t, s, post.ID, &b.ID, "c", user.ID)
+	d := newComment(t, s, post.ID, nil, "d", user.ID)
+
+	thread, err := s.Thread(ctx, post.ID, nil, 1, store.PageRequest{Limit: 10}, 0)
+	check(t, err)
+	sameIDs(t, "Thread depth 1", ids(thread.Items, threadedID), []int{a.ID, b.ID, d.ID})
+	if thread.Next != nil {
+		t.Errorf("Thread: every top level comment fit on the page, but got a next cursor")
+	}
+	first, second := thread.Items[0], thread.Items[1]
+	if first.Depth != 0 || first.ReplyCount != 1 || first.HasMoreReplies {
+		t.Errorf("a: got depth %d, %d replies, has more %v", first.Depth, first.ReplyCount, first.HasMoreReplies)
+	}
+	if second.Depth != 1 || second.ReplyCount != 1 || !second.HasMoreReplies {
+		t.Errorf("b: got depth %d, %d replies, has more %v", second.Depth, second.ReplyCount, second.HasMoreReplies)
+	}
+	sameIDs(t, "path of b", second.Path, []int{a.ID, b.ID})
+
+	// loading more under b keeps depth and path relative to the whole post
+	more, err := s.Thread(ctx, post.ID, &b.ID, 3, store.PageRequest{Limit: 10}, 0)
+	check(t, err)
+	sameIDs(t, "Thread under b", ids(more.Items, threadedID), []int{c.ID})
+	if more.Items[0].Depth != 2 || more.Items[0].HasMoreReplies {
+		t.Errorf("c: got depth %d, has more %v", more.Items[0].Depth, more.Items[0].HasMoreReplies)
+	}
+	sameIDs(t, "path of c", more.Items[0].Path, []int{a.ID, b.ID, c.ID})
+
+	// pages go by top level comment, each with its replies
+	page, err := s.Thread(ctx, post.ID, nil, 3, store.PageRequest{Limit: 1}, 0)
+	check(t, err)
+	sameIDs(t, "Thread first page", ids(page.Items, threadedID), []int{a.ID, b.ID, c.ID})
+	if page.Next == nil {
+		t.Fatal("Thread first page: want a next cursor")
+	}
+	page, err = s.Thread(ctx, post.ID, nil, 3, store.PageRequest{Limit: 1, After: page.Next}, 0)
+	check(t, err)
+	sameIDs(t, "Thread second page", ids(page.Items, threadedID), []int{d.ID})
+	if page.Next != nil {
+		t.Errorf("Thread second page: got a next cursor on the last page")
+	}
+
+	_, err = s.Thread(ctx, post.ID, new(int), 3, store.PageRequest{Limit: 10}, 0)
+	checkNotFound(t, err)
+}
+
+func testCascades(t *testing.T, s store.Store) {
+	alice := newUser(t, s, "alice")
+	bob := newUser(t, s, "bob")
+	topic := newTopic(t, s, "Golang", alice.ID)
+	kept := newTopic(t, s, "Kept", alice.ID)
+	post := newPost(t, s, topic.ID, "Channels", "body", alice.ID)
+	keptPost := newPost(t, s, kept.ID, "Still here", "body", alice.ID)
+	comment := newComment(t, s, post.ID, nil, "nice", bob.ID)
+	_, err := s.VotePost(ctx, post.ID, bob.ID, 1)
+	check(t, err)
+	_, err = s.VotePost(ctx, keptPost.ID, bob.ID, 1)
+	check(t, err)
+	check(t, s.AddTopicModerator(ctx, topic.ID, bob.ID))
+
+	check(t, s.DeleteTopic(ctx, topic.ID))
+	_, err = s.GetPost(ctx, post.ID, 0)
+	checkNotFound(t, err)
+	_, err = s.GetComment(ctx, comment.ID, 0)
+	checkNotFound(t, err)
+	assigned, err := s.IsTopicModerator(ctx, topic.ID, bob.ID)
+	check(t, err)
+	if assigned {
+		t.Error("moderator assignment outlived its topic")
+	}
+
+	got, err := s.GetPost(ctx, keptPost.ID, bob.ID)
+	check(t, err)
+	if got.Score != 1 || got.MyVote != 1 {
+		t.Errorf("post in another topic lost its vote: %+v", got)
+	}
+}
+
+func testSearch(t *testing.T, s store.Store) {
+	alice := newUser(t, s, "alice")
+	bob := newUser(t, s, "bob")
+	topic := newTopic(t, s, "Golang", alice.ID)
+	other := newTopic(t, s, "Cooking", alice.ID)
+	post := newPost(t, s, topic.ID, "Concurrency patterns", "channels and goroutines", alice.ID)
+	comment := newComment(t, s, post.ID, nil, "goroutines can leak", bob.ID)
+	newPost(t, s, other.ID, "Pasta", "boil the water", bob.ID)
+
+	search := func(q store.SearchQuery) []store.SearchResult {
+		t.Helper()
+		if q.Limit == 0 {
+			q.Limit = 10
+		}
+		results, err := s.Search(ctx, q)
+		if errors.Is(err, store.ErrSearchUnavailable) {
+			t.Skip("search isn't available on this store")
+		}
+		check(t, err)
+		return results
+	}
+	terms := func(text string, prefix bool) []store.SearchTerm {
+		return []store.SearchTerm{{Text: text, Prefix: prefix}}
+	}
+	// the ranking differs between backends, so most checks only look at which results came back
+	count := func(what string, results []store.SearchResult, want int) {
+		t.Helper()
+		if len(results) != want {
+			t.Errorf("%s: got %d results (%v), want %d", what, len(results), ids(results, resultID), want)
+		}
+	}
+
+	results := search(store.SearchQuery{Terms: terms("goroutines", false)})
+	count("goroutines", results, 2)
+	for _, r := range results {
+		if r.TopicID != topic.ID || r.PostID == nil || *r.PostID != post.ID {
+			t.Errorf("result %+v should point at topic %d and post %d", r, topic.ID, post.ID)
+		}
+		if !strings.Contains(r.Snippet, store.MatchStart+"goroutines"+store.MatchEnd) {
+			t.Errorf("snippet %q doesn't mark the match", r.Snippet)
+		}
+	}
+
+	count("prefix gorout", search(store.SearchQuery{Terms: terms("gorout", true)}), 2)
+	count("word gorout", search(store.SearchQuery{Terms: terms("gorout", false)}), 0)
+	count("phrase", search(store.SearchQuery{Terms: terms("channels and goroutines", false)}), 1)
+	count("two terms", search(store.SearchQuery{Terms: []store.SearchTerm{{Text: "goroutines"}, {Text: "leak"}}}), 1)
+	count("title", search(store.SearchQuery{Terms: terms("golang", false)}), 1)
+
+	results = search(store.SearchQuery{Terms: terms("goroutines", false), Types: []string{"comment"}})
+	count("comments only", results, 1)
+	if len(results) == 1 && (results[0].Type != "comment" || results[0].ID != comment.ID) {
+		t.Errorf("comments only: got %+v", results[0])
+	}
+	count("by bob", search(store.SearchQuery{Terms: terms("goroutines", false), AuthorID: bob.ID}), 1)
+	count("other topic", search(store.SearchQuery{Terms: terms("goroutines", false), TopicID: other.ID}), 0)
+	count("from tomorrow", search(store.SearchQuery{Terms: terms("goroutines", false), From: time.Now().Add(24 * time.Hour)}), 0)
+	count("up to yesterday", search(store.SearchQuery{Terms: terms("goroutines", false), To: time.Now().Add(-24 * time.Hour)}), 0)
+
+	first := search(store.SearchQuery{Terms: terms("goroutines", false), Limit: 1})
+	rest := search(store.SearchQuery{Terms: terms("goroutines", false), Limit: 10, Offset: 1})
+	count("first page", first, 1)
+	count("second page", rest, 1)
+	if len(first) == 1 && len(rest) == 1 && first[0].Type == rest[0].Type && first[0].ID == rest[0].ID {
+		t.Errorf("both pages returned %s %d", first[0].Type, first[0].ID)
+	}
+
+	// the index follows edits and deletes
+	_, err := s.UpdateComment(ctx, comment.ID, "threads can leak", bob.ID)
+	check(t, err)
+	count("after editing", search(store.SearchQuery{Terms: terms("goroutines", false)}), 1)
+	check(t, s.DeleteTopic(ctx, topic.ID))
+	count("after deleting", search(store.SearchQuery{Terms: terms("leak", false)}), 0)
+}
+
+func testNotifications(t *testing.T, s store.Store) {
+	alice := newUser(t, s, "alice")
+	bob := newUser(t, s, "bob")
+	topic := newTopic(t, s, "Golang", alice.ID)
+	post := newPost(t, s, topic.ID, "Channels", "body", alice.ID)
+	other := newPost(t, s, topic.ID, "Generics", "body", alice.ID)
+	reply := newComment(t, s, post.ID, nil, "nice", bob.ID)
+	doomed := newComment(t, s, other.ID, nil, "@alice look", bob.ID)
+
+	check(t, s.CreateNotifications(ctx, []store.Notification{
+		{UserID: alice.ID, Type: store.NotifyReply, ActorID: bob.ID, TopicID: topic.ID, PostID: post.ID, CommentID: &reply.ID},
+		{UserID: alice.ID, Type: store.NotifyNewPost, ActorID: bob.ID, TopicID: topic.ID, PostID: other.ID},
+		{UserID: alice.ID, Type: store.NotifyMention, ActorID: bob.ID, TopicID: topic.ID, PostID: other.ID, CommentID: &doomed.ID},
+		{UserID: bob.ID, Type: store.NotifyNewComment, ActorID: alice.ID, TopicID: topic.ID, PostID: post.ID},
+	}))
+
+	list := func(userID int, unreadOnly bool, page store.PageRequest) store.Page[store.Notification] {
+		t.Helper()
+		got, err := s.ListNotifications(ctx, userID, unreadOnly, page)
+		check(t, err)
+		return got
+	}
+	unread := func(userID, want int) {
+		t.Helper()
+		count, err := s.UnreadNotifications(ctx, userID)
+		check(t, err)
+		if count != want {
+			t.Errorf("user %d has %d unread, want %d", userID, count, want)
+		}
+	}
+
+	// newest first, the three were created in the same second so the id decides
+	first := list(alice.ID, false, store.PageRequest{Limit: 2})
+	if len(first.Items) != 2 || first.Next == nil {
+		t.Fatalf("first page: got %d items, next %v", len(first.Items), first.Next)
+	}
+	rest := list(alice.ID, false, store.PageRequest{Limit: 2, After: first.Next})
+	all := append(ids(first.Items, notificationID), ids(rest.Items, notificationID)...)
+	if len(all) != 3 || all[0] < all[1] || all[1] < all[2] || rest.Next != nil {
+		t.Errorf("pages gave %v (next %v), want 3 ids newest first", all, rest.Next)
+	}
+	n := first.Items[1]
+	if n.UserID != alice.ID || n.ActorID != bob.ID || n.ReadAt != nil || n.CreatedAt.IsZero() {
+		t.Errorf("notification %+v", n)
+	}
+	last := rest.Items[0]
+	if last.Type != store.NotifyReply || last.CommentID == nil || *last.CommentID != reply.ID || last.PostID != post.ID {
+		t.Errorf("reply notification %+v", last)
+	}
+	unread(alice.ID, 3)
+	unread(bob.ID, 1)
+
+	// one at a time, only your own
+	check(t, s.MarkNotificationRead(ctx, alice.ID, last.ID))
+	check(t, s.MarkNotificationRead(ctx, alice.ID, last.ID))
+	checkNotFound(t, s.MarkNotificationRead(ctx, bob.ID, last.ID))
+	checkNotFound(t, s.MarkNotificationRead(ctx, alice.ID, 9999))
+	unread(alice.ID, 2)
+	if got := list(alice.ID, true, store.PageRequest{Limit: 10}); len(got.Items) != 2 {
+		t.Errorf("unread only: got %v", ids(got.Items, notificationID))
+	}
+	read := list(alice.ID, false, store.PageRequest{Limit: 10}).Items
+	if read[2].ReadAt == nil {
+		t.Error("read notification has no read_at")
+	}
+
+	// in bulk, other people's ids are skipped
+	bobs := list(bob.ID, false, store.PageRequest{Limit: 10}).Items
+	marked, err := s.MarkNotificationsRead(ctx, alice.ID, []int{read[0].ID, last.ID, bobs[0].ID})
+	check(t, err)
+	if marked != 1 {
+		t.Errorf("marked %d, want 1", marked)
+	}
+	unread(alice.ID, 1)
+	unread(bob.ID, 1)
+	marked, err = s.MarkNotificationsRead(ctx, alice.ID, nil)
+	check(t, err)
+	if marked != 1 {
+		t.Errorf("marking all marked %d, want 1", marked)
+	}
+	unread(alice.ID, 0)
+
+	// they go with the comment or post they are about
+	check(t, s.DeleteComment(ctx, doomed.ID))
+	if got := list(alice.ID, false, store.PageRequest{Limit: 10}); len(got.Items) != 2 {
+		t.Errorf("after deleting the comment: got %v", ids(got.Items, notificationID))
+	}
+	check(t, s.DeletePost(ctx, post.ID))
+	if got := list(alice.ID, false, store.PageRequest{Limit: 10}); len(got.Items) != 1 {
+		t.Errorf("after deleting the post: got %v", ids(got.Items, notificationID))
+	}
+	unread(bob.ID, 0)
+}
+
+func testNotificationPreferences(t *testing.T, s store.Store) {
+	alice := newUser(t, s, "alice")
+	bob := newUser(t, s, "bob")
+
+	prefs, err := s.NotificationPreferences(ctx, alice.ID)
+	check(t, err)
+	if len(prefs) != len(store.NotificationTypes) {
+		t.Errorf("got %v, want every type", prefs)
+	}
+	for _, typ := range store.NotificationTypes {
+		if !prefs[typ] {
+			t.Errorf("%s is off by default", typ)
+		}
+	}
+
+	check(t, s.SetNotificationPreferences(ctx, alice.ID, map[string]bool{store.NotifyNewPost: false, store.NotifyMention: false}))
+	check(t, s.SetNotificationPreferences(ctx, alice.ID, map[string]bool{store.NotifyMention: true}))
+	prefs, err = s.NotificationPreferences(ctx, alice.ID)
+	check(t, err)
+	if prefs[store.NotifyNewPost] || !prefs[store.NotifyMention] || !prefs[store.NotifyReply] {
+		t.Errorf("after setting: got %v", prefs)
+	}
+	prefs, err = s.NotificationPreferences(ctx, bob.ID)
+	check(t, err)
+	if !prefs[store.NotifyNewPost] {
+		t.Error("alice's preferences changed bob's")
+	}
+
+	// everyone in one go, someone who never set any still gets the defaults
+	all, err := s.NotificationPreferencesOf(ctx, []int{alice.ID, bob.ID, 999})
+	check(t, err)
+	if len(all) != 3 || all[alice.ID][store.NotifyNewPost] || !all[alice.ID][store.NotifyReply] || !all[bob.ID][store.NotifyNewPost] ||
+		len(all[999]) != len(store.NotificationTypes) {
+		t.Errorf("NotificationPreferencesOf: got %v", all)
+	}
+	// more users than fit in one query
+	many := []int{alice.ID}
+	for id := 1000; id < 2200; id++ {
+		many = append(many, id)
+	}
+	all, err = s.NotificationPreferencesOf(ctx, many)
+	check(t, err)
+	if len(all) != len(many) || all[alice.ID][store.NotifyNewPost] || !all[2199][store.NotifyNewPost] {
+		t.Errorf("NotificationPreferencesOf %d users: got %d, alice's %v", len(many), len(all), all[alice.ID])
+	}
+	if all, err := s.NotificationPreferencesOf(ctx, nil); err != nil || len(all) != 0 {
+		t.Errorf("NotificationPreferencesOf nobody: got %v, %v", all, err)
+	}
+}
+
+func testFollows(t *testing.T, s store.Store) {
+	alice := newUser(t, s, "alice")
+	bob := newUser(t, s, "bob")
+	topic := newTopic(t, s, "Golang", alice.ID)
+	post := newPost(t, s, topic.ID, "Channels", "body", alice.ID)
+
+	followers := func(what string, got []int, err error, want ...int) {
+		t.Helper()
+		check(t, err)
+		sameIDs(t, what, got, want)
+	}
+
+	check(t, s.FollowTopic(ctx, bob.ID, topic.ID))
+	check(t, s.FollowTopic(ctx, bob.ID, topic.ID))
+	check(t, s.FollowTopic(ctx, alice.ID, topic.ID))
+	checkNotFound(t, s.FollowTopic(ctx, bob.ID, 9999))
+	got, err := s.TopicFollowers(ctx, topic.ID)
+	followers("topic followers", got, err, alice.ID, bob.ID)
+	check(t, s.UnfollowTopic(ctx, alice.ID, topic.ID))
+	check(t, s.UnfollowTopic(ctx, alice.ID, topic.ID))
+	got, err = s.TopicFollowers(ctx, topic.ID)
+	followers("after unfollowing", got, err, bob.ID)
+
+	check(t, s.FollowPost(ctx, bob.ID, post.ID))
+	checkNotFound(t, s.FollowPost(ctx, bob.ID, 9999))
+	got, err = s.PostFollowers(ctx, post.ID)
+	followers("post followers", got, err, bob.ID)
+	check(t, s.UnfollowPost(ctx, bob.ID, post.ID))
+	got, err = s.PostFollowers(ctx, post.ID)
+	followers("after unfollowing the post", got, err)
+
+	// following goes with the topic or post
+	check(t, s.FollowPost(ctx, bob.ID, post.ID))
+	check(t, s.DeleteTopic(ctx, topic.ID))
+	got, err = s.TopicFollowers(ctx, topic.ID)
+	followers("deleted topic", got, err)
+	got, err = s.PostFollowers(ctx, post.ID)
+	followers("deleted post", got, err)
+}
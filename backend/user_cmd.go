@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/archonward/CampusCommons/backend/auth"
+	"github.com/archonward/CampusCommons/backend/config"
+	"github.com/archonward/CampusCommons/backend/database"
+	"github.com/archonward/CampusCommons/backend/store"
+	"github.com/archonward/CampusCommons/backend/store/sqlstore"
+)
+
+const userUsage = `usage: go run . user [flags] command
+
+commands:
+  set-password <username>      set the password of an account, read from the first line of standard input
+  set-role <username> <role>   make an account a member, moderator or admin, e.g. the first admin of an upgraded database
+
+it reads the same config file, environment and -config / -db-driver / -db-dsn flags as the server`
+
+// runUser handles `go run . user ...`, the account changes only the operator gets to make
+func runUser(args []string) {
+	cfg, args, err := config.Load("user", args)
+	if err != nil {
+		log.Fatal("Invalid configuration:\n", err)
+	}
+	if cfg.Database.Driver == "memory" {
+		fail("the in-memory store has no accounts to change")
+	}
+	if len(args) == 0 {
+		fail(userUsage)
+	}
+
+	database.Open(database.Config{Driver: database.Dialect(cfg.Database.Driver), DSN: cfg.Database.DSN})
+	defer database.DB.Close()
+	// a database from before migrations only gets its password_hash column from the upgrade
+	if err := database.Migrate(); err != nil {
+		log.Fatal("Failed to migrate database: ", err)
+	}
+	st := sqlstore.New(database.DB, database.Driver, false)
+	ctx := context.Background()
+
+	switch args[0] {
+	case "set-password":
+		if len(args) != 2 {
+			fail(userUsage)
+		}
+		user := findUser(ctx, st, args[1])
+		password, err := readPassword(user.Username)
+		if err != nil {
+			log.Fatal("Failed to read the password: ", err)
+		}
+		if len(password) < auth.MinPasswordLength || len(password) > auth.MaxPasswordLength {
+			fail("the password must be between 8 and 72 characters")
+		}
+		hash, err := auth.HashPassword(password)
+		if err != nil {
+			log.Fatal("Failed to hash password: ", err)
+		}
+		if err := st.SetPassword(ctx, user.ID, hash); err != nil {
+			log.Fatal("Failed to set the password: ", err)
+		}
+		fmt.Printf("Set the password of %s\n", user.Username)
+
+	case "set-role":
+		if len(args) != 3 {
+			fail(userUsage)
+		}
+		role := args[2]
+		if !slices.Contains([]string{store.RoleMember, store.RoleModerator, store.RoleAdmin}, role) {
+			fail("the role must be one of member, moderator or admin")
+		}
+		user := findUser(ctx, st, args[1])
+		if _, err := st.SetRole(ctx, user.ID, role); err != nil {
+			log.Fatal("Failed to set the role: ", err)
+		}
+		fmt.Printf("%s is now %s\n", user.Username, role)
+
+	default:
+		fail(userUsage)
+	}
+}
+
+func findUser(ctx context.Context, st *sqlstore.Store, username string) store.User {
+	user, err := st.GetUserByUsername(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		fail(fmt.Sprintf("there is no user %q", username))
+	} else if err != nil {
+		log.Fatal("Failed to look up the user: ", err)
+	}
+	return user
+}
+
+// readPassword takes the first line of standard input, so the password stays out of the
+// shell history and can be piped in
+func readPassword(username string) (string, error) {
+	fmt.Fprintf(os.Stderr, "New password for %s: ", username)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -1,6 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate, useParams } from 'react-router-dom';
 import { Post } from '../types';
+import { apiError } from '../services/api';
 
 const EditPostPage: React.FC = () => {
   const { postId } = useParams<{ postId: string }>();
@@ -15,9 +16,9 @@ const EditPostPage: React.FC = () => {
   useEffect(() => {
     if (!postId) return;
 
-    fetch(`http://localhost:8080/posts/${postId}`)
-      .then(res => {
-        if (!res.ok) throw new Error('Post not found');
+    fetch(`http://localhost:8080/posts/${postId}`, { credentials: 'include' })
+      .then(async res => {
+        if (!res.ok) throw await apiError(res, 'Failed to load post');
         return res.json();
       })
       .then((post: Post) => {
@@ -36,11 +37,12 @@ const EditPostPage: React.FC = () => {
     try {
       const response = await fetch(`http://localhost:8080/posts/${postId}`, {
         method: 'PUT',
+        credentials: 'include',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ title: title.trim(), body: body.trim() }),
       });
 
-      if (!response.ok) throw new Error('Failed to update post');
+      if (!response.ok) throw await apiError(response, 'Failed to update post');
 
       navigate(`/posts/${postId}`);
     } catch (err: any) {
@@ -1,6 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate, useParams } from 'react-router-dom';
 import { Topic } from '../types';
+import { apiError, fetchAll } from '../services/api';
 
 const EditTopicPage: React.FC = () => {
   const { id } = useParams<{ id: string }>();
@@ -16,9 +17,8 @@ const EditTopicPage: React.FC = () => {
     if (!id) return;
 
     // my backend does not support GET /topics/:id
-    fetch(`http://localhost:8080/topics`)	// hence, we get the whole list of topics first, then search the list for the one with corresponding id
-      .then(res => res.json())
-      .then((topics: Topic[]) => {
+    fetchAll<Topic>('/topics?limit=100')	// hence, we get the whole list of topics first (every page), then search the list for the one with corresponding id
+      .then(topics => {
         const topic = topics.find(t => t.id === parseInt(id));
         if (topic) {
           setTitle(topic.title);
@@ -39,11 +39,12 @@ const EditTopicPage: React.FC = () => {
     try {
       const response = await fetch(`http://localhost:8080/topics/${id}`, {
         method: 'PUT',
+        credentials: 'include',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ title: title.trim(), description: description.trim() }),
       });
 
-      if (!response.ok) throw new Error('Failed to update topic');
+      if (!response.ok) throw await apiError(response, 'Failed to update topic');
 
       navigate(`/topics/${id}`); // go back to detail page
     } catch (err: any) {
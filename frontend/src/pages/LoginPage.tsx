@@ -1,9 +1,11 @@
 import React, { useState } from 'react';
 import { useNavigate } from 'react-router-dom';
-import { login } from '../services/api';
+import { login, register } from '../services/api';
 
 const LoginPage: React.FC = () => {
   const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [signingUp, setSigningUp] = useState(false);	// the same form registers a new account
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
 
@@ -15,16 +17,22 @@ const LoginPage: React.FC = () => {
       setError('Username is required');
       return;
     }
+    if (password === '') {
+      setError('Password is required');
+      return;
+    }
 
     setLoading(true);
     setError(null);
 
     try {
-      const user = await login(username.trim());
+      const user = signingUp
+        ? await register(username.trim(), password)
+        : await login(username.trim(), password);
       localStorage.setItem('currentUser', JSON.stringify(user));
       navigate('/topics');
     } catch (err: any) {
-      setError(err.message || 'Login failed');
+      setError(err.message || (signingUp ? 'Registration failed' : 'Login failed'));
       console.error(err);
     } finally {
       setLoading(false);
@@ -50,10 +58,10 @@ const LoginPage: React.FC = () => {
         maxWidth: '400px'
       }}>
         <h2 style={{ textAlign: 'center', margin: '0 0 1rem 0', color: '#333' }}>
-          CampusCommons Login
+          {signingUp ? 'Create a CampusCommons account' : 'CampusCommons Login'}
         </h2>
         <p style={{ textAlign: 'center', color: '#666', marginBottom: '1.5rem' }}>
-          Enter your username to continue
+          {signingUp ? 'Pick a username and a password of at least 8 characters' : 'Enter your username and password to continue'}
         </p>
 
         {error && (
@@ -91,6 +99,28 @@ const LoginPage: React.FC = () => {
             />
           </div>
 
+          <div style={{ marginBottom: '1.5rem' }}>
+            <label htmlFor="password" style={{ display: 'block', marginBottom: '0.5rem', fontWeight: 'bold', color: '#444' }}>
+              Password:
+            </label>
+            <input
+              id="password"
+              type="password"
+              autoComplete={signingUp ? 'new-password' : 'current-password'}
+              value={password}
+              onChange={(e) => setPassword(e.target.value)}
+              disabled={loading}
+              style={{
+                width: '100%',
+                padding: '0.75rem',
+                border: '1px solid #ccc',
+                borderRadius: '4px',
+                fontSize: '1rem',
+                boxSizing: 'border-box'
+              }}
+            />
+          </div>
+
           <button
             type="submit"
             disabled={loading}
@@ -106,9 +136,21 @@ const LoginPage: React.FC = () => {
               fontWeight: 'bold'
             }}
           >
-            {loading ? 'Logging in...' : 'Log In'}
+            {loading ? (signingUp ? 'Creating account...' : 'Logging in...') : (signingUp ? 'Sign Up' : 'Log In')}
           </button>
         </form>
+
+        <p style={{ textAlign: 'center', marginTop: '1rem', color: '#666' }}>
+          {signingUp ? 'Already have an account? ' : 'New here? '}
+          <button
+            type="button"
+            onClick={() => { setSigningUp(!signingUp); setError(null); }}
+            disabled={loading}
+            style={{ background: 'none', border: 'none', color: '#1976d2', cursor: 'pointer', padding: 0, fontSize: '1rem' }}
+          >
+            {signingUp ? 'Log in' : 'Create an account'}
+          </button>
+        </p>
       </div>
     </div>
   );
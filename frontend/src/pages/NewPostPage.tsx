@@ -1,5 +1,6 @@
 import React, { useState } from 'react';
 import { useNavigate, useParams } from 'react-router-dom';
+import { apiError } from '../services/api';
 
 const NewPostPage: React.FC = () => {
   const { id } = useParams<{ id: string }>();
@@ -41,6 +42,7 @@ const NewPostPage: React.FC = () => {
     try {
       const response = await fetch(`http://localhost:8080/topics/${id}/posts`, {
         method: 'POST',
+        credentials: 'include',
         headers: {
           'Content-Type': 'application/json',
         },
@@ -52,8 +54,7 @@ const NewPostPage: React.FC = () => {
       });
 
       if (!response.ok) {
-        const errorText = await response.text();
-        throw new Error(`Failed to create post: ${response.status} ${errorText}`);
+        throw await apiError(response, 'Failed to create post');
       }
 
       navigate(`/topics/${id}`);
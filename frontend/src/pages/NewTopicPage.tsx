@@ -1,5 +1,6 @@
 import React, { useState } from "react";
 import { useNavigate } from "react-router-dom";
+import { apiError } from "../services/api";
 
 type CurrentUser = { id: number; username?: string } | null;
 
@@ -31,6 +32,7 @@ export default function NewTopicPage() {
     try {
       const res = await fetch("http://localhost:8080/topics", {
         method: "POST",
+        credentials: "include",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({
           title: form.title.trim(),
@@ -39,7 +41,7 @@ export default function NewTopicPage() {
         }),
       });
 
-      if (!res.ok) throw new Error(await res.text());
+      if (!res.ok) throw await apiError(res, "Failed to create topic");
       navigate("/topics");
     } catch (err) {
       setError(
@@ -1,6 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate, useParams } from 'react-router-dom';
 import { Post, Comment } from '../types';
+import { apiError, fetchAll } from '../services/api';
 
 const PostDetailPage: React.FC = () => {
   const { postId } = useParams<{ postId: string }>();
@@ -25,14 +26,12 @@ const PostDetailPage: React.FC = () => {
   const fetchPostAndComments = async () => {
     try {
       // Fetch single post
-      const postRes = await fetch(`http://localhost:8080/posts/${postId}`);
-      if (!postRes.ok) throw new Error('Post not found');
+      const postRes = await fetch(`http://localhost:8080/posts/${postId}`, { credentials: 'include' });
+      if (!postRes.ok) throw await apiError(postRes, 'Failed to load post');
       const postData: Post = await postRes.json();
 
-      // Fetch comments
-      const commentsRes = await fetch(`http://localhost:8080/posts/${postId}/comments`);
-      if (!commentsRes.ok) throw new Error('Failed to fetch comments');
-      const commentsData: Comment[] = await commentsRes.json();
+      // Fetch comments, every page of them
+      const commentsData = await fetchAll<Comment>(`/posts/${postId}/comments?limit=100`);
 
       setPost(postData);
       setComments(commentsData);
@@ -54,6 +53,7 @@ const PostDetailPage: React.FC = () => {
     try {
       const response = await fetch(`http://localhost:8080/posts/${postId}/comments`, {
         method: 'POST',
+        credentials: 'include',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
           body: newComment.trim(),
@@ -61,7 +61,7 @@ const PostDetailPage: React.FC = () => {
         }),
       });
 
-      if (!response.ok) throw new Error('Failed to add comment');
+      if (!response.ok) throw await apiError(response, 'Failed to add comment');
 
       const comment: Comment = await response.json();
       setComments([...comments, comment]);
@@ -90,12 +90,12 @@ const PostDetailPage: React.FC = () => {
             <button
               onClick={() => {
                 if (window.confirm('Delete this post and all its comments?')) {
-                  fetch(`http://localhost:8080/posts/${post.id}`, { method: 'DELETE' })
-                    .then(res => {
+                  fetch(`http://localhost:8080/posts/${post.id}`, { method: 'DELETE', credentials: 'include' })
+                    .then(async res => {
                       if (res.ok) {
                         navigate(`/topics/${post.topic_id}`); // go back to topic
                       } else {
-                        alert('Failed to delete post');
+                        alert((await apiError(res, 'Failed to delete post')).message);
                       }
                     });
                 }
@@ -1,6 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate, useParams } from 'react-router-dom';
 import { Topic, Post } from '../types';
+import { fetchAll, fetchPage } from '../services/api';
 
 const TopicDetailPage: React.FC = () => {
   const { id } = useParams<{ id: string }>();
@@ -8,6 +9,7 @@ const TopicDetailPage: React.FC = () => {
 
   const [topic, setTopic] = useState<Topic | null>(null);
   const [posts, setPosts] = useState<Post[]>([]);
+  const [nextCursor, setNextCursor] = useState<string | null>(null);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
 
@@ -20,20 +22,17 @@ const TopicDetailPage: React.FC = () => {
 
     const fetchTopicAndPosts = async () => {
       try {
-        // Fetch all topics to find the one with matching ID
-        const topicRes = await fetch(`http://localhost:8080/topics`);
-        if (!topicRes.ok) throw new Error('Failed to fetch topics');
-        const topics: Topic[] = await topicRes.json();
+        // Fetch all topics to find the one with matching ID, every page of them since it can be on any
+        const topics = await fetchAll<Topic>('/topics?limit=100');
         const foundTopic = topics.find(t => t.id === parseInt(id));
         if (!foundTopic) throw new Error('Topic not found');
 
-        // Fetch posts for this topic
-        const postsRes = await fetch(`http://localhost:8080/topics/${id}/posts`);
-        if (!postsRes.ok) throw new Error('Failed to fetch posts');
-        const postsData: Post[] = await postsRes.json();
+        // Fetch the first page of posts for this topic
+        const postsPage = await fetchPage<Post>(`/topics/${id}/posts`);
 
         setTopic(foundTopic);
-        setPosts(postsData);
+        setPosts(postsPage.items);
+        setNextCursor(postsPage.next_cursor);
       } catch (err: any) {
         setError(err.message || 'Failed to load topic and posts.');
       } finally {
@@ -44,6 +43,16 @@ const TopicDetailPage: React.FC = () => {
     fetchTopicAndPosts();
   }, [id]);
 
+  const loadMore = async () => {
+    try {
+      const page = await fetchPage<Post>(`/topics/${id}/posts`, nextCursor);
+      setPosts([...posts, ...page.items]);
+      setNextCursor(page.next_cursor);
+    } catch (err: any) {
+      alert(err.message || 'Failed to load more posts.');
+    }
+  };
+
   const handleCreatePost = () => {
     navigate(`/topics/${id}/posts/new`);
   };
@@ -158,7 +167,7 @@ const TopicDetailPage: React.FC = () => {
 
         {/* Posts Section */}
         <h3 style={{ color: '#333', marginBottom: '1rem' }}>
-          Posts ({posts.length})
+          Posts ({posts.length}{nextCursor ? '+' : ''})
         </h3>
 
         {posts.length === 0 ? (
@@ -193,6 +202,12 @@ const TopicDetailPage: React.FC = () => {
             ))}
           </ul>
         )}
+
+        {nextCursor && (
+          <button onClick={loadMore} style={{ width: '100%' }}>
+            Load more posts
+          </button>
+        )}
       </div>
     </div>
   );
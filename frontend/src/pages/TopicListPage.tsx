@@ -1,29 +1,32 @@
 import React, { useState, useEffect } from 'react';
 import { Topic } from '../types';
 import { useNavigate } from 'react-router-dom';
+import { apiError, fetchPage, logout } from '../services/api';
 
 const TopicListPage: React.FC = () => {
   const navigate = useNavigate();
 
   const [topics, setTopics] = useState<Topic[]>([]);
+  const [nextCursor, setNextCursor] = useState<string | null>(null);	// null once the last page is loaded
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
 
-  const handleLogout = () => {
-	localStorage.removeItem('currentUser');	// clear user from localstorage
-	navigate('/login');
+  const handleLogout = async () => {
+	try {
+	  await logout();	// drop the session cookie
+	} finally {
+	  localStorage.removeItem('currentUser');	// clear user from localstorage
+	  navigate('/login');
+	}
   };
 
 
   useEffect(() => {
     const fetchTopics = async () => {
       try {
-        const response = await fetch('http://localhost:8080/topics');
-        if (!response.ok) {
-          throw new Error(`No response from backend server: ${response.status}`);
-        }
-        const data: Topic[] = await response.json();
-        setTopics(data);
+        const page = await fetchPage<Topic>('/topics');
+        setTopics(page.items);
+        setNextCursor(page.next_cursor);
       } catch (err: any) {
         setError(err.message || 'Failed to load topics.');
       } finally {
@@ -34,6 +37,16 @@ const TopicListPage: React.FC = () => {
     fetchTopics();
   }, []);
 
+  const loadMore = async () => {
+    try {
+      const page = await fetchPage<Topic>('/topics', nextCursor);
+      setTopics([...topics, ...page.items]);
+      setNextCursor(page.next_cursor);
+    } catch (err: any) {
+      setError(err.message || 'Failed to load more topics.');
+    }
+  };
+
   return (
     <div style={{
       display: 'flex',
@@ -143,12 +156,12 @@ const TopicListPage: React.FC = () => {
      			 onClick={(e) => {
        				 e.stopPropagation(); // prevent triggering navigate
        				 if (window.confirm('delete this topic? This will also delete all posts and comments.')) {
-         				 fetch(`http://localhost:8080/topics/${topic.id}`, { method: 'DELETE' })
-           					 .then(res => {
+         				 fetch(`http://localhost:8080/topics/${topic.id}`, { method: 'DELETE', credentials: 'include' })
+           					 .then(async res => {
              						 if (res.ok) {
                						    setTopics(topics.filter(t => t.id !== topic.id));
              						 } else {
-               						    alert('Failed to delete topic');
+               						    alert((await apiError(res, 'Failed to delete topic')).message);
              						 }
            		    });
        			   }
@@ -170,6 +183,12 @@ const TopicListPage: React.FC = () => {
                 ))}
               </ul>
             )}
+
+            {nextCursor && (
+              <button onClick={loadMore} style={{ marginTop: '1rem', width: '100%' }}>
+                Load more topics
+              </button>
+            )}
           </div>
         )}
       </div>
@@ -1,4 +1,4 @@
-import type { User } from "../types";
+import type { ApiError, ListResponse, User } from "../types";
 
 
 const API_BASE_URL = 'http://localhost:8080';
@@ -6,13 +6,15 @@ const API_BASE_URL = 'http://localhost:8080';
 // DO NOT TOUCH ANYTHING HERE!!!! 
 
 // this part is for POST /login, quite buggy but i got it to work after fixing what the backend responds with.
-export const login = async (username: string): Promise<User> => {
+// credentials: 'include' lets the browser keep the session cookie the backend sets, and send it with every later fetch
+export const login = async (username: string, password: string): Promise<User> => {
   const response = await fetch(`${API_BASE_URL}/login`, {
     method: 'POST',
+    credentials: 'include',
     headers: {
       'Content-Type': 'application/json',	// need this line else get a 400 error 
     },
-    body: JSON.stringify({ username }),	// need this line also, to send over the username as a String to backend
+    body: JSON.stringify({ username, password }),	// need this line also, to send over the username and password to backend
   });
 
 // for easier debugging, DO NOT REMOVE the lines
@@ -22,9 +24,69 @@ export const login = async (username: string): Promise<User> => {
 
 
   if (!response.ok) {
-    const errorText = await response.text();
-    throw new Error(`Login failed: ${response.status} ${errorText}`);
+    throw await apiError(response, 'Login failed');
   }
 
   return response.json();
 };
+
+// POST /register makes the account and logs in straight away, same response as login
+export const register = async (username: string, password: string): Promise<User> => {
+  const response = await fetch(`${API_BASE_URL}/register`, {
+    method: 'POST',
+    credentials: 'include',
+    headers: {
+      'Content-Type': 'application/json',
+    },
+    body: JSON.stringify({ username, password }),
+  });
+
+  if (!response.ok) {
+    throw await apiError(response, 'Registration failed');
+  }
+
+  return response.json();
+};
+
+// POST /logout drops the session cookie, the token itself can't be taken back
+export const logout = async (): Promise<void> => {
+  await fetch(`${API_BASE_URL}/logout`, { method: 'POST', credentials: 'include' });
+};
+
+// apiError turns a failed response into an Error with the message from the backend's {"error": {...}} body
+export const apiError = async (response: Response, what: string): Promise<Error> => {
+  try {
+    const body: ApiError = await response.json();
+    if (body.error?.message) {
+      return new Error(`${what}: ${body.error.message}`);
+    }
+  } catch {
+    // not JSON, e.g. a proxy answered instead of the backend
+  }
+  return new Error(`${what}: ${response.status}`);
+};
+
+// fetchPage gets one page of a listing, pass the next_cursor of the page before to get the one after it
+export const fetchPage = async <T>(path: string, cursor?: string | null): Promise<ListResponse<T>> => {
+  const url = new URL(path, API_BASE_URL);
+  if (cursor) {
+    url.searchParams.set('cursor', cursor);
+  }
+  const response = await fetch(url.toString(), { credentials: 'include' });
+  if (!response.ok) {
+    throw await apiError(response, 'Loading failed');
+  }
+  return response.json();
+};
+
+// fetchAll follows next_cursor to the last page, for when the whole list is needed (e.g. to find one topic in it)
+export const fetchAll = async <T>(path: string): Promise<T[]> => {
+  const items: T[] = [];
+  let cursor: string | null = null;
+  do {
+    const page: ListResponse<T> = await fetchPage<T>(path, cursor);
+    items.push(...page.items);
+    cursor = page.next_cursor;
+  } while (cursor);
+  return items;
+};
@@ -1,6 +1,7 @@
 export interface User {
   id: number;
   username: string;
+  role: 'member' | 'moderator' | 'admin';
 }
 
 // Topic object from /topics
@@ -21,6 +22,22 @@ export interface Post {
   created_at: string;
 }
 
+// every listing comes in pages, pass next_cursor back as ?cursor= for the next one, it is null on the last page
+export interface ListResponse<T> {
+  items: T[];
+  next_cursor: string | null;
+}
+
+// what the backend sends back for any 4xx/5xx
+export interface ApiError {
+  error: {
+    code: string;
+    message: string;
+    details?: { field: string; message: string }[];
+    request_id?: string;
+  };
+}
+
 export interface Comment {
   id: number;
   post_id: number;